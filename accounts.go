@@ -1,9 +1,14 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
+	"fmt"
 	"maps"
+	"os"
 	"slices"
+	"time"
 
 	"cosmossdk.io/math"
 
@@ -19,6 +24,41 @@ type Account struct {
 	StakedAmount math.LegacyDec
 	Vote         govtypes.WeightedVoteOptions
 	Delegations  []Delegation
+	// PendingStakes holds the tokens of the unbonding delegations and of the
+	// redelegations to inactive validators, see getAccounts.
+	PendingStakes []PendingStake `json:",omitempty"`
+	// Vesting is set for the vesting accounts.
+	Vesting *VestingInfo `json:",omitempty"`
+	// TokenizedShares holds the delegations of LSM module accounts attributed
+	// to the account because it holds their share tokens, they are also in
+	// Delegations.
+	TokenizedShares []TokenizedShare `json:",omitempty"`
+}
+
+// TokenizedShare is the part of the delegation of a tokenize share record
+// attributed to a holder of its share tokens.
+type TokenizedShare struct {
+	RecordID         uint64
+	ValidatorAddress string
+	Amount           math.LegacyDec
+}
+
+// VestingInfo holds the vesting amounts of a vesting account at the snapshot
+// time.
+type VestingInfo struct {
+	OriginalVesting math.LegacyDec
+	// Vested is the part of OriginalVesting vested at the snapshot time.
+	Vested math.LegacyDec
+	// DelegatedVesting is the part of the delegated tokens that is still
+	// vesting.
+	DelegatedVesting math.LegacyDec
+	// EndTime is zero for permanent locked accounts.
+	EndTime time.Time
+}
+
+// locked returns the amount still vesting at the snapshot time.
+func (v VestingInfo) locked() math.LegacyDec {
+	return v.OriginalVesting.Sub(v.Vested)
 }
 
 type Delegation struct {
@@ -27,6 +67,23 @@ type Delegation struct {
 	Vote             govtypes.WeightedVoteOptions
 }
 
+const (
+	pendingUnbonding    = "unbonding"
+	pendingRedelegation = "redelegation"
+)
+
+// PendingStake is an amount of tokens of an account that is being unbonded or
+// redelegated.
+type PendingStake struct {
+	// Kind is unbonding or redelegation.
+	Kind string
+	// ValidatorAddress is the source validator.
+	ValidatorAddress string
+	Amount           math.LegacyDec
+	// Treatment is how Amount is counted, see stakeTreatment.
+	Treatment string
+}
+
 // voteWeights returns a consolidated map of votes, merging direct and indirect
 // votes with their respective weight summed.
 // The map also uses the govtypes.OptionEmpty to hold the no-vote weight.
@@ -68,79 +125,292 @@ func (a Account) String() string {
 	return string(bz)
 }
 
+// stakeTreatment defines how getAccounts counts the tokens that are not
+// delegated anymore but still belong to the delegator: unbonding delegations,
+// and redelegations to a validator that isn't active.
+type stakeTreatment int
+
+const (
+	// treatExclude ignores the tokens.
+	treatExclude stakeTreatment = iota
+	// treatLiquid adds the tokens to the liquid amount.
+	treatLiquid
+	// treatStaked adds the tokens to the staked amount, with a delegation to
+	// the source validator, which holds its vote.
+	treatStaked
+)
+
+var stakeTreatments = []stakeTreatment{treatExclude, treatLiquid, treatStaked}
+
+func (t stakeTreatment) String() string {
+	switch t {
+	case treatLiquid:
+		return "liquid"
+	case treatStaked:
+		return "staked"
+	}
+	return "exclude"
+}
+
+func parseStakeTreatment(s string) (stakeTreatment, error) {
+	for _, t := range stakeTreatments {
+		if t.String() == s {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown stake treatment '%s'", s)
+}
+
+// accountsOptions configures getAccounts, the zero value ignores unbonding
+// delegations and redelegations, and uses the default rules.
+type accountsOptions struct {
+	Unbonding    stakeTreatment
+	Redelegation stakeTreatment
+	// Rules excludes accounts, see accountRules.excluded.
+	Rules *accountRules
+}
+
 // getAccounts returns the list of all account with their vote and
 // power, from direct or indirect votes.
-func getAccounts(
-	delegsByAddr map[string][]stakingtypes.Delegation,
-	votesByAddr map[string]govtypes.WeightedVoteOptions,
-	valsByAddr map[string]govtypes.ValidatorGovInfo,
-	balancesByAddr map[string]sdk.Coins,
-	accountTypesPerAddr map[string]string,
-) []Account {
-	accountsByAddr := make(map[string]Account, len(delegsByAddr))
-	// Feed delegations
-	for addr, delegs := range delegsByAddr {
+// Unbonding delegations and redelegations to validators that aren't active
+// (redelegations to active validators are already counted in the
+// delegations) are recorded in Account.PendingStakes and counted following
+// opts.
+// The delegations and balances are read record by record (see
+// Snapshot.delegations and Snapshot.balances), so if they are streamed only
+// the accounts are held in memory.
+func getAccounts(ctx context.Context, snap *Snapshot, opts accountsOptions) ([]Account, error) {
+	var (
+		votesByAddr         = snap.VotesByAddr
+		valsByAddr          = snap.ValsByAddr
+		accountTypesPerAddr = snap.AccountTypesByAddr
+		rules               = opts.Rules
+	)
+	if rules == nil {
+		rules = defaultRules()
+	}
+	accountsByAddr := make(map[string]Account)
+	vesting := func(addr string) *VestingInfo {
+		if v, ok := snap.VestingByAddr[addr]; ok {
+			return &v
+		}
+		return nil
+	}
+	// getAccount returns the account of addr, created without vote if missing.
+	// ok is false if the account is ignored.
+	getAccount := func(addr string) (acc Account, ok bool) {
+		if acc, ok := accountsByAddr[addr]; ok {
+			return acc, true
+		}
 		accType := accountTypesPerAddr[addr]
-		if accType == "/cosmos.auth.v1beta1.ModuleAccount" ||
-			accType == "/ibc.applications.interchain_accounts.v1.InterchainAccount" {
-			// Ignore ModuleAccount & InterchainAccount
-			continue
+		if rules.excluded(addr, accType) {
+			return Account{}, false
 		}
-		account := Account{
+		return Account{
 			Address:      addr,
 			Type:         accType,
 			LiquidAmount: math.LegacyZeroDec(),
 			StakedAmount: math.LegacyZeroDec(),
-			Vote:         votesByAddr[addr],
+			Vesting:      vesting(addr),
+		}, true
+	}
+	// addPendingStake records ps into the account of addr, and counts it
+	// following treatment.
+	addPendingStake := func(addr string, ps PendingStake, treatment stakeTreatment) {
+		account, ok := getAccount(addr)
+		if !ok {
+			return
 		}
-		for _, deleg := range delegs {
-			// Find validator
+		account.Vote = votesByAddr[addr]
+		account.PendingStakes = append(account.PendingStakes, ps)
+		switch treatment {
+		case treatLiquid:
+			account.LiquidAmount = account.LiquidAmount.Add(ps.Amount)
+		case treatStaked:
+			// The source validator has no vote if it isn't active
+			account.StakedAmount = account.StakedAmount.Add(ps.Amount)
+			account.Delegations = append(account.Delegations, Delegation{
+				ValidatorAddress: ps.ValidatorAddress,
+				Amount:           ps.Amount,
+				Vote:             valsByAddr[ps.ValidatorAddress].Vote,
+			})
+		}
+		accountsByAddr[addr] = account
+	}
+	// The delegations of the LSM module accounts are attributed to the
+	// holders of their share tokens, if any.
+	var (
+		tokenizedRecords = make(map[string]tokenizeShareRecord)
+		shareSupplies    = make(map[string]math.Int)
+	)
+	for _, r := range snap.TokenizeShareRecords {
+		supply := math.ZeroInt()
+		for _, amount := range snap.ShareBalancesByDenom[r.shareDenom()] {
+			supply = supply.Add(amount)
+		}
+		if supply.IsPositive() {
+			tokenizedRecords[r.moduleAddress()] = r
+			shareSupplies[r.shareDenom()] = supply
+		}
+	}
+	// Feed delegations
+	moduleDelegs := make(map[string][]stakingtypes.Delegation)
+	for deleg, err := range snap.delegations(ctx) {
+		if err != nil {
+			return nil, err
+		}
+		addr := deleg.DelegatorAddress
+		if _, ok := tokenizedRecords[addr]; ok {
+			// LSM module account, see below
+			moduleDelegs[addr] = append(moduleDelegs[addr], deleg)
+			continue
+		}
+		account, ok := getAccount(addr)
+		if !ok {
+			continue
+		}
+		account.Vote = votesByAddr[addr]
+		// Find validator
+		val, ok := valsByAddr[deleg.ValidatorAddress]
+		if !ok {
+			// Validator isn't in active set or jailed, ignore
+			accountsByAddr[addr] = account
+			continue
+		}
+
+		// Compute delegation voting power
+		delegVotingPower := deleg.GetShares().MulInt(val.BondedTokens).Quo(val.DelegatorShares)
+		account.StakedAmount = account.StakedAmount.Add(delegVotingPower)
+
+		// Populate delegations with validator votes
+		account.Delegations = append(account.Delegations, Delegation{
+			ValidatorAddress: val.Address.String(),
+			Amount:           delegVotingPower,
+			Vote:             val.Vote,
+		})
+		accountsByAddr[addr] = account
+	}
+	// Feed tokenized shares
+	for _, moduleAddr := range slices.Sorted(maps.Keys(tokenizedRecords)) {
+		var (
+			r       = tokenizedRecords[moduleAddr]
+			holders = snap.ShareBalancesByDenom[r.shareDenom()]
+			supply  = shareSupplies[r.shareDenom()]
+		)
+		for _, deleg := range moduleDelegs[moduleAddr] {
 			val, ok := valsByAddr[deleg.ValidatorAddress]
 			if !ok {
 				// Validator isn't in active set or jailed, ignore
 				continue
 			}
-
-			// Compute delegation voting power
 			delegVotingPower := deleg.GetShares().MulInt(val.BondedTokens).Quo(val.DelegatorShares)
-			account.StakedAmount = account.StakedAmount.Add(delegVotingPower)
-
-			// Populate delegations with validator votes
-			account.Delegations = append(account.Delegations, Delegation{
-				ValidatorAddress: val.Address.String(),
-				Amount:           delegVotingPower,
-				Vote:             val.Vote,
-			})
+			for _, holder := range slices.Sorted(maps.Keys(holders)) {
+				account, ok := getAccount(holder)
+				if !ok {
+					continue
+				}
+				amount := delegVotingPower.MulInt(holders[holder]).QuoInt(supply)
+				account.Vote = votesByAddr[holder]
+				account.StakedAmount = account.StakedAmount.Add(amount)
+				account.Delegations = append(account.Delegations, Delegation{
+					ValidatorAddress: val.Address.String(),
+					Amount:           amount,
+					Vote:             val.Vote,
+				})
+				account.TokenizedShares = append(account.TokenizedShares, TokenizedShare{
+					RecordID:         r.ID,
+					ValidatorAddress: val.Address.String(),
+					Amount:           amount,
+				})
+				accountsByAddr[holder] = account
+			}
 		}
-		accountsByAddr[addr] = account
 	}
-	// Feed balances
-	for addr, balance := range balancesByAddr {
-		acc, ok := accountsByAddr[addr]
-		if ok {
-			acc.LiquidAmount = balance[0].Amount.ToLegacyDec()
-			accountsByAddr[addr] = acc
-		} else {
-			accType := accountTypesPerAddr[addr]
-			if accType == "/cosmos.auth.v1beta1.ModuleAccount" ||
-				accType == "/ibc.applications.interchain_accounts.v1.InterchainAccount" {
-				// Ignore ModuleAccount & InterchainAccount
+	// Feed unbonding delegations and redelegations, sorted so the order of the
+	// delegations is deterministic
+	for _, addr := range slices.Sorted(maps.Keys(snap.UnbondingsByAddr)) {
+		for _, ubd := range snap.UnbondingsByAddr[addr] {
+			ps := PendingStake{
+				Kind:             pendingUnbonding,
+				ValidatorAddress: ubd.ValidatorAddress,
+				Amount:           math.LegacyZeroDec(),
+				Treatment:        opts.Unbonding.String(),
+			}
+			for _, entry := range ubd.Entries {
+				ps.Amount = ps.Amount.Add(entry.Balance.ToLegacyDec())
+			}
+			addPendingStake(addr, ps, opts.Unbonding)
+		}
+	}
+	for _, addr := range slices.Sorted(maps.Keys(snap.RedelegationsByAddr)) {
+		for _, red := range snap.RedelegationsByAddr[addr] {
+			if _, ok := valsByAddr[red.ValidatorDstAddress]; ok {
+				// Already counted in the delegations
 				continue
 			}
-			accountsByAddr[addr] = Account{
-				Address:      addr,
-				Type:         accType,
-				LiquidAmount: balance[0].Amount.ToLegacyDec(),
-				StakedAmount: math.LegacyZeroDec(),
+			ps := PendingStake{
+				Kind:             pendingRedelegation,
+				ValidatorAddress: red.ValidatorSrcAddress,
+				Amount:           math.LegacyZeroDec(),
+				Treatment:        opts.Redelegation.String(),
 			}
+			for _, entry := range red.Entries {
+				ps.Amount = ps.Amount.Add(entry.InitialBalance.ToLegacyDec())
+			}
+			addPendingStake(addr, ps, opts.Redelegation)
+		}
+	}
+	// Feed balances
+	for balance, err := range snap.balances(ctx) {
+		if err != nil {
+			return nil, err
+		}
+		account, ok := getAccount(balance.Address)
+		if !ok {
+			continue
 		}
+		account.LiquidAmount = account.LiquidAmount.Add(balance.Coins[0].Amount.ToLegacyDec())
+		accountsByAddr[balance.Address] = account
 	}
 	// Map to slice with deterministic order
 	var accounts []Account
 	for _, addr := range slices.Sorted(maps.Keys(accountsByAddr)) {
 		accounts = append(accounts, accountsByAddr[addr])
 	}
-	return accounts
+	return accounts, nil
+}
+
+// writeAccounts writes accounts into the file at path as a JSON array, one
+// account at a time so the whole JSON isn't held in memory.
+func writeAccounts(path string, accounts []Account) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	w.WriteString("[")
+	for i, acc := range accounts {
+		if i > 0 {
+			w.WriteString(",")
+		}
+		w.WriteString("\n  ")
+		bz, err := json.MarshalIndent(acc, "  ", "  ")
+		if err != nil {
+			f.Close()
+			return err
+		}
+		w.Write(bz)
+	}
+	w.WriteString("\n]\n")
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("%s file created.\n", path)
+	return nil
 }
 
 type GnoAccount struct {
@@ -149,13 +419,16 @@ type GnoAccount struct {
 }
 
 // getGnoAccounts returns the list of all account with their vote and
-// power, from direct or indirect votes.
-func getGnoAccounts(
-	delegsByAddr map[string][]stakingtypes.Delegation,
-	valsByAddr map[string]govtypes.ValidatorGovInfo,
-	balancesByAddr map[string]sdk.Coins,
-	accountTypesPerAddr map[string]string,
-) []GnoAccount {
+// power, from direct or indirect votes. rules are applied to the accounts:
+// excluded and slashed accounts are removed, the coins of the other matched
+// accounts are capped or redirected.
+func getGnoAccounts(snap *Snapshot, rules *accountRules) []GnoAccount {
+	var (
+		delegsByAddr        = snap.DelegsByAddr
+		valsByAddr          = snap.ValsByAddr
+		balancesByAddr      = snap.BalancesByAddr
+		accountTypesPerAddr = snap.AccountTypesByAddr
+	)
 	accountsByAddr := make(map[string]GnoAccount, len(delegsByAddr))
 	// Feed delegations
 	for addr, delegs := range delegsByAddr {
@@ -163,10 +436,7 @@ func getGnoAccounts(
 			Address: addr,
 			Coins:   sdk.NewCoins(),
 		}
-		accType := accountTypesPerAddr[addr]
-		if accType == "/cosmos.auth.v1beta1.ModuleAccount" ||
-			accType == "/ibc.applications.interchain_accounts.v1.InterchainAccount" {
-			// Ignore ModuleAccount & InterchainAccount
+		if rules.excluded(addr, accountTypesPerAddr[addr]) {
 			continue
 		}
 		for _, deleg := range delegs {
@@ -190,10 +460,7 @@ func getGnoAccounts(
 			acc.Coins = acc.Coins.Add(balance...)
 			accountsByAddr[addr] = acc
 		} else {
-			accType := accountTypesPerAddr[addr]
-			if accType == "/cosmos.auth.v1beta1.ModuleAccount" ||
-				accType == "/ibc.applications.interchain_accounts.v1.InterchainAccount" {
-				// Ignore ModuleAccount & InterchainAccount
+			if rules.excluded(addr, accountTypesPerAddr[addr]) {
 				continue
 			}
 			accountsByAddr[addr] = GnoAccount{
@@ -202,6 +469,39 @@ func getGnoAccounts(
 			}
 		}
 	}
+	// Apply the other rules, sorted so redirections are deterministic
+	for _, addr := range slices.Sorted(maps.Keys(accountsByAddr)) {
+		accType := accountTypesPerAddr[addr]
+		r := rules.match(addr, accType)
+		if r == nil {
+			continue
+		}
+		acc := accountsByAddr[addr]
+		switch r.Action {
+		case actionSlash:
+			rules.record(addr, accType, r, acc.Coins.String())
+			delete(accountsByAddr, addr)
+		case actionCap:
+			capped := sdk.NewCoins()
+			for _, c := range acc.Coins {
+				capped = capped.Add(sdk.NewCoin(c.Denom, math.MinInt(c.Amount, *r.Cap)))
+			}
+			if excess := acc.Coins.Sub(capped...); !excess.IsZero() {
+				rules.record(addr, accType, r, excess.String())
+			}
+			acc.Coins = capped
+			accountsByAddr[addr] = acc
+		case actionRedirect:
+			rules.record(addr, accType, r, acc.Coins.String())
+			delete(accountsByAddr, addr)
+			target, ok := accountsByAddr[r.RedirectTo]
+			if !ok {
+				target = GnoAccount{Address: r.RedirectTo, Coins: sdk.NewCoins()}
+			}
+			target.Coins = target.Coins.Add(acc.Coins...)
+			accountsByAddr[r.RedirectTo] = target
+		}
+	}
 	// Map to slice with deterministic order
 	var accounts []GnoAccount
 	for _, addr := range slices.Sorted(maps.Keys(accountsByAddr)) {
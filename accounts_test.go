@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"sort"
 	"testing"
@@ -586,7 +587,14 @@ func TestGetAccounts(t *testing.T) {
 			assert := assert.New(t)
 			require := require.New(t)
 
-			accounts := getAccounts(tt.delegsByAddr, tt.votesByAddr, tt.valsByAddr, balancesByAddr, accountTypesByAddr)
+			accounts, err := getAccounts(context.Background(), &Snapshot{
+				VotesByAddr:        tt.votesByAddr,
+				ValsByAddr:         tt.valsByAddr,
+				DelegsByAddr:       tt.delegsByAddr,
+				BalancesByAddr:     balancesByAddr,
+				AccountTypesByAddr: accountTypesByAddr,
+			}, accountsOptions{})
+			require.NoError(err)
 
 			// order is not determistic, sort to have it
 			sort.Slice(accounts, func(i, j int) bool {
@@ -605,6 +613,116 @@ func TestGetAccounts(t *testing.T) {
 	}
 }
 
+func TestGetAccountsPendingStakes(t *testing.T) {
+	var (
+		accAddrs    = createAccountAddrs(2)
+		accAddr1    = accAddrs[0].String()
+		accAddr2    = accAddrs[1].String()
+		valAddrs    = createValidatorAddrs(2)
+		valAddr     = valAddrs[0].String()
+		inactiveVal = valAddrs[1].String()
+		voteYes     = govtypes.NewNonSplitVoteOption(govtypes.OptionYes)
+		snap        = &Snapshot{
+			ValsByAddr: map[string]govtypes.ValidatorGovInfo{
+				valAddr: govtypes.NewValidatorGovInfo(valAddrs[0], math.NewInt(100),
+					math.LegacyNewDec(100), math.LegacyZeroDec(), voteYes),
+			},
+			DelegsByAddr: map[string][]stakingtypes.Delegation{
+				accAddr1: {{DelegatorAddress: accAddr1, ValidatorAddress: valAddr, Shares: math.LegacyNewDec(10)}},
+			},
+			UnbondingsByAddr: map[string][]stakingtypes.UnbondingDelegation{
+				accAddr1: {{
+					DelegatorAddress: accAddr1,
+					ValidatorAddress: valAddr,
+					Entries: []stakingtypes.UnbondingDelegationEntry{
+						{InitialBalance: math.NewInt(5), Balance: math.NewInt(4)},
+						{InitialBalance: math.NewInt(3), Balance: math.NewInt(3)},
+					},
+				}},
+			},
+			RedelegationsByAddr: map[string][]stakingtypes.Redelegation{
+				accAddr2: {
+					{
+						DelegatorAddress:    accAddr2,
+						ValidatorSrcAddress: valAddr,
+						ValidatorDstAddress: inactiveVal,
+						Entries:             []stakingtypes.RedelegationEntry{{InitialBalance: math.NewInt(5)}},
+					},
+					{
+						// Counted in the delegations of the active destination
+						DelegatorAddress:    accAddr2,
+						ValidatorSrcAddress: inactiveVal,
+						ValidatorDstAddress: valAddr,
+						Entries:             []stakingtypes.RedelegationEntry{{InitialBalance: math.NewInt(50)}},
+					},
+				},
+			},
+			BalancesByAddr: map[string]sdk.Coins{
+				accAddr1: sdk.NewCoins(sdk.NewInt64Coin("uatom", 100)),
+			},
+		}
+	)
+	tests := []struct {
+		name               string
+		opts               accountsOptions
+		expectedLiquid     [2]int64
+		expectedStaked     [2]int64
+		expectedDelegCount [2]int
+	}{
+		{
+			name:               "exclude",
+			expectedLiquid:     [2]int64{100, 0},
+			expectedStaked:     [2]int64{10, 0},
+			expectedDelegCount: [2]int{1, 0},
+		},
+		{
+			name:               "liquid",
+			opts:               accountsOptions{Unbonding: treatLiquid, Redelegation: treatLiquid},
+			expectedLiquid:     [2]int64{107, 5},
+			expectedStaked:     [2]int64{10, 0},
+			expectedDelegCount: [2]int{1, 0},
+		},
+		{
+			name:               "staked",
+			opts:               accountsOptions{Unbonding: treatStaked, Redelegation: treatStaked},
+			expectedLiquid:     [2]int64{100, 0},
+			expectedStaked:     [2]int64{17, 5},
+			expectedDelegCount: [2]int{2, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			accounts, err := getAccounts(context.Background(), snap, tt.opts)
+			require.NoError(t, err)
+
+			require.Len(t, accounts, 2)
+			byAddr := map[string]Account{accounts[0].Address: accounts[0], accounts[1].Address: accounts[1]}
+			for i, addr := range []string{accAddr1, accAddr2} {
+				acc := byAddr[addr]
+				assert.Equal(t, math.LegacyNewDec(tt.expectedLiquid[i]), acc.LiquidAmount, "liquid %d", i)
+				assert.Equal(t, math.LegacyNewDec(tt.expectedStaked[i]), acc.StakedAmount, "staked %d", i)
+				assert.Len(t, acc.Delegations, tt.expectedDelegCount[i], "delegations %d", i)
+			}
+			assert.Equal(t, []PendingStake{{
+				Kind:             pendingUnbonding,
+				ValidatorAddress: valAddr,
+				Amount:           math.LegacyNewDec(7),
+				Treatment:        tt.opts.Unbonding.String(),
+			}}, byAddr[accAddr1].PendingStakes)
+			assert.Equal(t, []PendingStake{{
+				Kind:             pendingRedelegation,
+				ValidatorAddress: valAddr,
+				Amount:           math.LegacyNewDec(5),
+				Treatment:        tt.opts.Redelegation.String(),
+			}}, byAddr[accAddr2].PendingStakes)
+			if tt.opts.Redelegation == treatStaked {
+				// Staked with the vote of the source validator
+				assert.Equal(t, math.LegacyOneDec(), byAddr[accAddr2].voteWeights()[govtypes.OptionYes])
+			}
+		})
+	}
+}
+
 func createAccountAddrs(accNum int) []sdk.AccAddress {
 	addrs := make([]sdk.AccAddress, accNum)
 	for i := 0; i < accNum; i++ {
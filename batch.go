@@ -0,0 +1,258 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"cosmossdk.io/math"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types/v1beta1"
+	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
+)
+
+// batchReport is the result of tallyBatch.
+type batchReport struct {
+	// Height is the height of the export.
+	Height int64 `json:"height"`
+	// BondedTokens is the total voting power at the export height.
+	BondedTokens math.Int             `json:"bonded_tokens"`
+	Proposals    []batchProposalEntry `json:"proposals"`
+}
+
+// batchProposalEntry is the tally of a proposal of a batchReport.
+type batchProposalEntry struct {
+	ProposalID    uint64    `json:"proposal_id"`
+	Format        string    `json:"format"`
+	Status        string    `json:"status"`
+	VotingEndTime time.Time `json:"voting_end_time"`
+	// Computed is true if the tally has been computed from the votes of the
+	// export (proposals in voting period), false if it is the final tally
+	// result of the proposal (votes are removed once tallied).
+	Computed bool `json:"computed"`
+	// Voters is the number of direct voters, only for computed tallies.
+	Voters           int                 `json:"voters,omitempty"`
+	Tally            map[string]math.Int `json:"tally"`
+	TotalVotingPower math.Int            `json:"total_voting_power"`
+	// Turnout is the share of the bonded tokens that voted, only for computed
+	// tallies since the bonded tokens at the end of the other proposals are
+	// unknown.
+	Turnout *math.LegacyDec `json:"turnout,omitempty"`
+	// Outcome is the computed outcome, if the tally is computed.
+	Outcome string `json:"outcome,omitempty"`
+}
+
+// tallyBatch computes the tally of each proposal of the gov export file at
+// path, using the tally mode of the gov format of the proposals.
+func tallyBatch(path string) (batchReport, error) {
+	var (
+		rawProps      []json.RawMessage
+		votes         []voteJSON
+		paramsGenesis govParamsGenesis
+		rawValidators []json.RawMessage
+		delegations   []stakingtypes.Delegation
+		maxValidators int
+		report        batchReport
+		err           error
+		foundGov      bool
+	)
+	report.Height, err = streamAppState(path, map[string]func(*json.Decoder) error{
+		"gov": func(dec *json.Decoder) error {
+			var gov struct {
+				Proposals []json.RawMessage `json:"proposals"`
+				Votes     []voteJSON        `json:"votes"`
+				govParamsGenesis
+			}
+			if err := dec.Decode(&gov); err != nil {
+				return err
+			}
+			rawProps, votes, paramsGenesis = gov.Proposals, gov.Votes, gov.govParamsGenesis
+			foundGov = true
+			return nil
+		},
+		"staking": func(dec *json.Decoder) error {
+			var staking struct {
+				Params struct {
+					MaxValidators int `json:"max_validators"`
+				} `json:"params"`
+				Validators  []json.RawMessage         `json:"validators"`
+				Delegations []stakingtypes.Delegation `json:"delegations"`
+			}
+			if err := dec.Decode(&staking); err != nil {
+				return err
+			}
+			rawValidators, delegations = staking.Validators, staking.Delegations
+			maxValidators = staking.Params.MaxValidators
+			return nil
+		},
+	})
+	if err != nil {
+		return batchReport{}, err
+	}
+	if !foundGov {
+		return batchReport{}, fmt.Errorf("%s: gov module not found", path)
+	}
+	props := make([]govProposal, len(rawProps))
+	for i, raw := range rawProps {
+		if props[i], err = decodeProposal(raw, path); err != nil {
+			return batchReport{}, err
+		}
+	}
+	if len(props) == 0 {
+		return report, nil
+	}
+	if props[0].Format == govAtomOne {
+		setAtomOneBech32Prefixes()
+	}
+	params, err := paramsGenesis.govParams(path)
+	if err != nil {
+		return batchReport{}, err
+	}
+
+	// Validators and delegations are shared by all the proposals
+	activeVals, err := activeValidators(rawValidators, maxValidators)
+	if err != nil {
+		return batchReport{}, err
+	}
+	var (
+		valsByAddr   = make(map[string]govtypes.ValidatorGovInfo)
+		delegsByAddr = make(map[string][]stakingtypes.Delegation)
+	)
+	for _, raw := range activeVals {
+		var val struct {
+			OperatorAddress string         `json:"operator_address"`
+			Tokens          math.Int       `json:"tokens"`
+			DelegatorShares math.LegacyDec `json:"delegator_shares"`
+		}
+		if err := json.Unmarshal(raw, &val); err != nil {
+			return batchReport{}, fmt.Errorf("%s: validator: %w", path, err)
+		}
+		valAddr, err := sdk.ValAddressFromBech32(val.OperatorAddress)
+		if err != nil {
+			return batchReport{}, fmt.Errorf("%s: validator: %w", path, err)
+		}
+		valsByAddr[val.OperatorAddress] = govtypes.NewValidatorGovInfo(
+			valAddr, val.Tokens, val.DelegatorShares, math.LegacyZeroDec(), nil,
+		)
+	}
+	for _, d := range delegations {
+		delegsByAddr[d.DelegatorAddress] = append(delegsByAddr[d.DelegatorAddress], d)
+	}
+	snap := &Snapshot{ValsByAddr: valsByAddr, DelegsByAddr: delegsByAddr}
+	bondedTokens := totalBondedTokens(snap)
+	report.BondedTokens = bondedTokens.TruncateInt()
+
+	votesByProp := make(map[uint64]map[string]govtypes.WeightedVoteOptions)
+	for _, vj := range votes {
+		vote, err := vj.toVote()
+		if err != nil {
+			return batchReport{}, fmt.Errorf("%s: %w", path, err)
+		}
+		if votesByProp[vote.ProposalId] == nil {
+			votesByProp[vote.ProposalId] = make(map[string]govtypes.WeightedVoteOptions)
+		}
+		votesByProp[vote.ProposalId][vote.Voter] = vote.Options
+	}
+
+	slices.SortFunc(props, func(a, b govProposal) int { return cmp.Compare(a.ID, b.ID) })
+	for _, prop := range props {
+		entry := batchProposalEntry{
+			ProposalID:    prop.ID,
+			Format:        prop.Format.String(),
+			Status:        prop.Status,
+			VotingEndTime: prop.VotingEndTime,
+			Tally:         make(map[string]math.Int),
+		}
+		switch prop.Status {
+		case "PROPOSAL_STATUS_DEPOSIT_PERIOD":
+			// Not voted yet
+			continue
+
+		case "PROPOSAL_STATUS_VOTING_PERIOD":
+			propSnap := *snap
+			propSnap.VotesByAddr = votesByProp[prop.ID]
+			// Set the validator votes of the proposal
+			propSnap.ValsByAddr = maps.Clone(valsByAddr)
+			for addr, val := range propSnap.ValsByAddr {
+				val.Vote = propSnap.VotesByAddr[sdk.AccAddress(val.Address).String()]
+				propSnap.ValsByAddr[addr] = val
+			}
+			tr := tally(&propSnap, prop.Format.tallyMode())
+			for _, o := range voteOptions(prop.Format) {
+				entry.Tally[voteOptionName(o)] = tr.Results[o].TruncateInt()
+			}
+			entry.Computed = true
+			entry.Voters = len(propSnap.VotesByAddr)
+			entry.TotalVotingPower = tr.TotalVotingPower.TruncateInt()
+			turnout := math.LegacyZeroDec()
+			if bondedTokens.IsPositive() {
+				turnout = tr.TotalVotingPower.Quo(bondedTokens)
+			}
+			entry.Turnout = &turnout
+			entry.Outcome = evaluateTally(tr.Results, tr.TotalVotingPower, bondedTokens, params, prop).Outcome
+
+		default:
+			entry.TotalVotingPower = math.ZeroInt()
+			for _, o := range voteOptions(prop.Format) {
+				amount, ok := prop.FinalTallyResult[o]
+				if !ok {
+					amount = math.ZeroInt()
+				}
+				entry.Tally[voteOptionName(o)] = amount
+				entry.TotalVotingPower = entry.TotalVotingPower.Add(amount)
+			}
+		}
+		report.Proposals = append(report.Proposals, entry)
+	}
+	return report, nil
+}
+
+// printBatchReport prints report as a markdown table, with amounts in
+// millions.
+func printBatchReport(report batchReport) {
+	fmt.Printf("--- TALLY BATCH (height %d, bonded tokens %s) ---\n", report.Height, human(report.BondedTokens))
+	table := newMarkdownTable("ID", "Status", "Voting end", "Voters", "Yes", "No", "NoWithVeto", "Abstain",
+		"Total", "Turnout", "Computed outcome")
+	for _, e := range report.Proposals {
+		var (
+			voters, turnout = "-", "-"
+			outcome         = "-"
+			amount          = func(option string) string {
+				if amt, ok := e.Tally[option]; ok {
+					return human(amt)
+				}
+				return "-"
+			}
+		)
+		if e.Computed {
+			voters = strconv.Itoa(e.Voters)
+			turnout = humanPercent(*e.Turnout)
+			outcome = e.Outcome
+		}
+		table.Append([]string{
+			strconv.FormatUint(e.ProposalID, 10), e.Status, e.VotingEndTime.Format(time.DateOnly), voters,
+			amount("Yes"), amount("No"), amount("NoWithVeto"), amount("Abstain"),
+			human(e.TotalVotingPower), turnout, outcome,
+		})
+	}
+	table.Render()
+}
+
+// writeBatchReport writes report as JSON into the file at path.
+func writeBatchReport(path string, report batchReport) error {
+	bz, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(bz, '\n'), 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("%s file created.\n", path)
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cosmossdk.io/math"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+)
+
+func TestTallyBatch(t *testing.T) {
+	var (
+		dir        = t.TempDir()
+		exportFile = filepath.Join(dir, "export.json")
+		reportFile = filepath.Join(dir, "report.json")
+		accAddrs   = createAccountAddrs(2)
+		valAddr    = createValidatorAddrs(1)[0]
+		valAccAddr = sdk.AccAddress(valAddr).String()
+	)
+	require.NoError(t, os.WriteFile(exportFile, []byte(`{
+		"app_state": {
+			"gov": {
+				"proposals": [
+					{"proposal_id": "2", "status": "PROPOSAL_STATUS_VOTING_PERIOD", "voting_end_time": "2024-02-01T00:00:00Z"},
+					{"proposal_id": "1", "status": "PROPOSAL_STATUS_PASSED", "voting_end_time": "2024-01-01T00:00:00Z",
+					 "final_tally_result": {"yes": "60", "abstain": "0", "no": "10", "no_with_veto": "5"}},
+					{"proposal_id": "3", "status": "PROPOSAL_STATUS_DEPOSIT_PERIOD"}
+				],
+				"votes": [
+					{"proposal_id": "2", "voter": "`+valAccAddr+`", "option": "VOTE_OPTION_YES"},
+					{"proposal_id": "2", "voter": "`+accAddrs[0].String()+`", "option": "VOTE_OPTION_NO"}
+				],
+				"tally_params": {"quorum": "0.4", "threshold": "0.5", "veto_threshold": "0.334"}
+			},
+			"staking": {
+				"params": {"max_validators": 10},
+				"validators": [
+					{"operator_address": "`+valAddr.String()+`", "status": "BOND_STATUS_BONDED",
+					 "tokens": "100", "delegator_shares": "100.000000000000000000"}
+				],
+				"delegations": [
+					{"delegator_address": "`+valAccAddr+`", "validator_address": "`+valAddr.String()+`", "shares": "50.000000000000000000"},
+					{"delegator_address": "`+accAddrs[0].String()+`", "validator_address": "`+valAddr.String()+`", "shares": "30.000000000000000000"},
+					{"delegator_address": "`+accAddrs[1].String()+`", "validator_address": "`+valAddr.String()+`", "shares": "20.000000000000000000"}
+				]
+			}
+		},
+		"initial_height": "101"
+	}`), 0o644))
+
+	report, err := tallyBatch(exportFile)
+
+	require.NoError(t, err)
+	assert.EqualValues(t, 100, report.Height)
+	assert.Equal(t, math.NewInt(100), report.BondedTokens)
+	require.Len(t, report.Proposals, 2)
+	prop1 := report.Proposals[0]
+	assert.EqualValues(t, 1, prop1.ProposalID)
+	assert.False(t, prop1.Computed)
+	assert.Equal(t, map[string]math.Int{
+		"Yes": math.NewInt(60), "No": math.NewInt(10), "NoWithVeto": math.NewInt(5), "Abstain": math.ZeroInt(),
+	}, prop1.Tally)
+	assert.Equal(t, math.NewInt(75), prop1.TotalVotingPower)
+	assert.Nil(t, prop1.Turnout)
+	prop2 := report.Proposals[1]
+	assert.EqualValues(t, 2, prop2.ProposalID)
+	assert.True(t, prop2.Computed)
+	assert.Equal(t, 2, prop2.Voters)
+	// The validator votes with its self-delegation and the delegation of the
+	// non-voter
+	assert.Equal(t, map[string]math.Int{
+		"Yes": math.NewInt(70), "No": math.NewInt(30), "NoWithVeto": math.ZeroInt(), "Abstain": math.ZeroInt(),
+	}, prop2.Tally)
+	assert.Equal(t, math.NewInt(100), prop2.TotalVotingPower)
+	assert.Equal(t, math.LegacyOneDec(), *prop2.Turnout)
+	assert.Equal(t, outcomePassed, prop2.Outcome)
+
+	require.NoError(t, writeBatchReport(reportFile, report))
+	bz, err := os.ReadFile(reportFile)
+	require.NoError(t, err)
+	var decoded batchReport
+	require.NoError(t, json.Unmarshal(bz, &decoded))
+	assert.Equal(t, report.Proposals[1].Tally, decoded.Proposals[1].Tally)
+	assert.Equal(t, report.Proposals[1].Outcome, decoded.Proposals[1].Outcome)
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	dbm "github.com/cometbft/cometbft-db"
+	rpchttp "github.com/cometbft/cometbft/rpc/client/http"
+	sm "github.com/cometbft/cometbft/state"
+	"github.com/cometbft/cometbft/store"
+
+	"cosmossdk.io/math"
+
+	codectypes "github.com/cosmos/cosmos-sdk/codec/types"
+	txtypes "github.com/cosmos/cosmos-sdk/types/tx"
+	"github.com/cosmos/cosmos-sdk/x/authz"
+	govv1 "github.com/cosmos/cosmos-sdk/x/gov/types/v1"
+	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types/v1beta1"
+)
+
+// blockTx is a tx of a block with its result code.
+type blockTx struct {
+	Tx   []byte
+	Code uint32
+}
+
+// blockSource gives access to the txs of the blocks of a chain.
+type blockSource interface {
+	blockTxs(ctx context.Context, height int64) ([]blockTx, error)
+	Close() error
+}
+
+// rpcBlockSource reads the blocks from a CometBFT RPC endpoint.
+type rpcBlockSource struct {
+	client *rpchttp.HTTP
+}
+
+func newRPCBlockSource(rpcEndpoint string) (*rpcBlockSource, error) {
+	client, err := rpchttp.New(rpcEndpoint, "/websocket")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create RPC client: %w", err)
+	}
+	return &rpcBlockSource{client: client}, nil
+}
+
+func (s *rpcBlockSource) blockTxs(ctx context.Context, height int64) ([]blockTx, error) {
+	block, err := s.client.Block(ctx, &height)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch block %d: %w", height, err)
+	}
+	results, err := s.client.BlockResults(ctx, &height)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch block results %d: %w", height, err)
+	}
+	if len(results.TxsResults) != len(block.Block.Txs) {
+		return nil, fmt.Errorf("block %d has %d txs but %d tx results", height, len(block.Block.Txs), len(results.TxsResults))
+	}
+	txs := make([]blockTx, len(block.Block.Txs))
+	for i, tx := range block.Block.Txs {
+		txs[i] = blockTx{Tx: tx, Code: results.TxsResults[i].Code}
+	}
+	return txs, nil
+}
+
+func (s *rpcBlockSource) Close() error { return nil }
+
+// storeBlockSource reads the blocks from the block store and the state store
+// of a stopped CometBFT node.
+type storeBlockSource struct {
+	blockDB, stateDB dbm.DB
+	blockStore       *store.BlockStore
+	stateStore       sm.Store
+}
+
+// newStoreBlockSource opens the databases of the CometBFT data directory dir
+// (usually ~/.gaia/data) using the database backend.
+func newStoreBlockSource(dir string, backend dbm.BackendType) (*storeBlockSource, error) {
+	blockDB, err := dbm.NewDB("blockstore", backend, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open block store: %w", err)
+	}
+	stateDB, err := dbm.NewDB("state", backend, dir)
+	if err != nil {
+		blockDB.Close()
+		return nil, fmt.Errorf("failed to open state store: %w", err)
+	}
+	return &storeBlockSource{
+		blockDB:    blockDB,
+		stateDB:    stateDB,
+		blockStore: store.NewBlockStore(blockDB),
+		stateStore: sm.NewStore(stateDB, sm.StoreOptions{}),
+	}, nil
+}
+
+func (s *storeBlockSource) blockTxs(_ context.Context, height int64) ([]blockTx, error) {
+	block := s.blockStore.LoadBlock(height)
+	if block == nil {
+		return nil, fmt.Errorf("block %d not found in block store (base=%d, height=%d)",
+			height, s.blockStore.Base(), s.blockStore.Height())
+	}
+	resp, err := s.stateStore.LoadFinalizeBlockResponse(height)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load block results %d: %w", height, err)
+	}
+	if len(resp.TxResults) != len(block.Txs) {
+		return nil, fmt.Errorf("block %d has %d txs but %d tx results", height, len(block.Txs), len(resp.TxResults))
+	}
+	txs := make([]blockTx, len(block.Txs))
+	for i, tx := range block.Txs {
+		txs[i] = blockTx{Tx: tx, Code: resp.TxResults[i].Code}
+	}
+	return txs, nil
+}
+
+func (s *storeBlockSource) Close() error {
+	return errors.Join(s.blockDB.Close(), s.stateDB.Close())
+}
+
+// fetchBlockVotes returns the votes for proposalID of the successful txs of the
+// blocks from fromHeight to toHeight (included).
+func fetchBlockVotes(ctx context.Context, src blockSource, proposalID uint64, fromHeight, toHeight int64) ([]blockVote, error) {
+	var blockVotes []blockVote
+	for height := fromHeight; height <= toHeight; height++ {
+		txs, err := src.blockTxs(ctx, height)
+		if err != nil {
+			return nil, err
+		}
+		for i, tx := range txs {
+			if tx.Code != 0 {
+				// Failed tx, its votes haven't been recorded
+				continue
+			}
+			votes, err := decodeTxVotes(tx.Tx)
+			if err != nil {
+				return nil, fmt.Errorf("block %d tx %d: %w", height, i, err)
+			}
+			for _, vote := range votes {
+				if vote.ProposalId != proposalID {
+					continue
+				}
+				bz, err := json.Marshal(newVoteJSON(vote))
+				if err != nil {
+					return nil, err
+				}
+				blockVotes = append(blockVotes, blockVote{
+					Height:  height,
+					TxIndex: i,
+					Vote:    bz,
+				})
+			}
+		}
+	}
+	return blockVotes, nil
+}
+
+// decodeTxVotes returns the votes of the messages of tx, including the ones
+// wrapped in authz MsgExec. Votes are returned in their gov v1beta1 form.
+func decodeTxVotes(tx []byte) ([]govtypes.Vote, error) {
+	var raw txtypes.TxRaw
+	if err := raw.Unmarshal(tx); err != nil {
+		return nil, fmt.Errorf("decode tx: %w", err)
+	}
+	var body txtypes.TxBody
+	if err := body.Unmarshal(raw.BodyBytes); err != nil {
+		return nil, fmt.Errorf("decode tx body: %w", err)
+	}
+	return decodeMsgsVotes(body.Messages)
+}
+
+func decodeMsgsVotes(msgs []*codectypes.Any) ([]govtypes.Vote, error) {
+	var votes []govtypes.Vote
+	for _, msg := range msgs {
+		// The gov messages are only decoded from their binary form, so the
+		// package of the type URL doesn't matter (cosmos.gov or atomone.gov).
+		pkg, name, _ := strings.Cut(strings.TrimPrefix(msg.TypeUrl, "/"), ".Msg")
+		switch {
+		case msg.TypeUrl == "/cosmos.authz.v1beta1.MsgExec":
+			var exec authz.MsgExec
+			if err := exec.Unmarshal(msg.Value); err != nil {
+				return nil, fmt.Errorf("decode %s: %w", msg.TypeUrl, err)
+			}
+			execVotes, err := decodeMsgsVotes(exec.Msgs)
+			if err != nil {
+				return nil, err
+			}
+			votes = append(votes, execVotes...)
+
+		case strings.HasSuffix(pkg, ".gov.v1beta1") && name == "Vote":
+			var m govtypes.MsgVote
+			if err := m.Unmarshal(msg.Value); err != nil {
+				return nil, fmt.Errorf("decode %s: %w", msg.TypeUrl, err)
+			}
+			votes = append(votes, govtypes.Vote{
+				ProposalId: m.ProposalId,
+				Voter:      m.Voter,
+				Options:    govtypes.NewNonSplitVoteOption(m.Option),
+			})
+
+		case strings.HasSuffix(pkg, ".gov.v1beta1") && name == "VoteWeighted":
+			var m govtypes.MsgVoteWeighted
+			if err := m.Unmarshal(msg.Value); err != nil {
+				return nil, fmt.Errorf("decode %s: %w", msg.TypeUrl, err)
+			}
+			votes = append(votes, govtypes.Vote{
+				ProposalId: m.ProposalId,
+				Voter:      m.Voter,
+				Options:    m.Options,
+			})
+
+		case strings.HasSuffix(pkg, ".gov.v1") && name == "Vote":
+			var m govv1.MsgVote
+			if err := m.Unmarshal(msg.Value); err != nil {
+				return nil, fmt.Errorf("decode %s: %w", msg.TypeUrl, err)
+			}
+			votes = append(votes, govtypes.Vote{
+				ProposalId: m.ProposalId,
+				Voter:      m.Voter,
+				// gov v1 and v1beta1 vote options share the same values
+				Options: govtypes.NewNonSplitVoteOption(govtypes.VoteOption(m.Option)),
+			})
+
+		case strings.HasSuffix(pkg, ".gov.v1") && name == "VoteWeighted":
+			var m govv1.MsgVoteWeighted
+			if err := m.Unmarshal(msg.Value); err != nil {
+				return nil, fmt.Errorf("decode %s: %w", msg.TypeUrl, err)
+			}
+			options := make(govtypes.WeightedVoteOptions, len(m.Options))
+			for i, o := range m.Options {
+				weight, err := math.LegacyNewDecFromStr(o.Weight)
+				if err != nil {
+					return nil, fmt.Errorf("decode %s: weight: %w", msg.TypeUrl, err)
+				}
+				options[i] = govtypes.WeightedVoteOption{
+					Option: govtypes.VoteOption(o.Option),
+					Weight: weight,
+				}
+			}
+			votes = append(votes, govtypes.Vote{
+				ProposalId: m.ProposalId,
+				Voter:      m.Voter,
+				Options:    options,
+			})
+		}
+	}
+	return votes, nil
+}
+
+// importBlockVotes writes into the block_votes.json file of the snapshot
+// directory path the votes for proposalID of the blocks from fromHeight to
+// toHeight, read from src. The votes of other heights already in the file are
+// kept, and the manifest is updated with the new checksum of the file.
+func importBlockVotes(ctx context.Context, src blockSource, proposalID uint64, fromHeight, toHeight int64, path string) error {
+	// Fail early if the manifest can't be updated
+	if _, err := readManifest(path); err != nil {
+		return err
+	}
+	file := filepath.Join(path, "block_votes.json")
+	var blockVotes []blockVote
+	bz, err := os.ReadFile(file)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		if err := json.Unmarshal(bz, &blockVotes); err != nil {
+			return fmt.Errorf("cannot json decode block votes from file %s: %w", file, err)
+		}
+		blockVotes = slices.DeleteFunc(blockVotes, func(bv blockVote) bool {
+			return bv.Height >= fromHeight && bv.Height <= toHeight
+		})
+	}
+	fetched, err := fetchBlockVotes(ctx, src, proposalID, fromHeight, toHeight)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d votes found in blocks %d to %d\n", len(fetched), fromHeight, toHeight)
+	blockVotes = append(blockVotes, fetched...)
+	slices.SortStableFunc(blockVotes, func(a, b blockVote) int {
+		return cmp.Or(cmp.Compare(a.Height, b.Height), cmp.Compare(a.TxIndex, b.TxIndex))
+	})
+	items := make([]json.RawMessage, len(blockVotes))
+	for i, bv := range blockVotes {
+		if items[i], err = json.Marshal(bv); err != nil {
+			return err
+		}
+	}
+	if err := writeJSONArray(file, items); err != nil {
+		return err
+	}
+	return addManifestFile(path, "block_votes.json")
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	abci "github.com/cometbft/cometbft/abci/types"
+	ctypes "github.com/cometbft/cometbft/rpc/core/types"
+	rpctypes "github.com/cometbft/cometbft/rpc/jsonrpc/types"
+	cmttypes "github.com/cometbft/cometbft/types"
+
+	"github.com/cosmos/gogoproto/proto"
+
+	"cosmossdk.io/math"
+
+	codectypes "github.com/cosmos/cosmos-sdk/codec/types"
+	txtypes "github.com/cosmos/cosmos-sdk/types/tx"
+	"github.com/cosmos/cosmos-sdk/x/authz"
+	govv1 "github.com/cosmos/cosmos-sdk/x/gov/types/v1"
+	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types/v1beta1"
+)
+
+// fakeRPCBlock is a block served by newFakeRPCServer.
+type fakeRPCBlock struct {
+	txs   []cmttypes.Tx
+	codes []uint32
+}
+
+// newFakeRPCServer returns an in-process CometBFT JSON-RPC server, which
+// serves the block and block_results methods for blocks.
+func newFakeRPCServer(t *testing.T, blocks map[int64]fakeRPCBlock) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req rpctypes.RPCRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var params struct {
+			Height string `json:"height"`
+		}
+		json.Unmarshal(req.Params, &params)
+		height, _ := strconv.ParseInt(params.Height, 10, 64)
+		block, ok := blocks[height]
+		var resp rpctypes.RPCResponse
+		switch {
+		case !ok:
+			resp = rpctypes.RPCInvalidParamsError(req.ID, nil)
+		case req.Method == "block":
+			resp = rpctypes.NewRPCSuccessResponse(req.ID, &ctypes.ResultBlock{
+				Block: &cmttypes.Block{
+					Header: cmttypes.Header{Height: height},
+					Data:   cmttypes.Data{Txs: block.txs},
+				},
+			})
+		case req.Method == "block_results":
+			results := &ctypes.ResultBlockResults{Height: height}
+			for _, code := range block.codes {
+				results.TxsResults = append(results.TxsResults, &abci.ExecTxResult{Code: code})
+			}
+			resp = rpctypes.NewRPCSuccessResponse(req.ID, results)
+		default:
+			resp = rpctypes.RPCMethodNotFoundError(req.ID)
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestTx(t *testing.T, msgs ...proto.Message) cmttypes.Tx {
+	t.Helper()
+	var body txtypes.TxBody
+	for _, msg := range msgs {
+		any, err := codectypes.NewAnyWithValue(msg)
+		require.NoError(t, err)
+		body.Messages = append(body.Messages, any)
+	}
+	bodyBytes, err := body.Marshal()
+	require.NoError(t, err)
+	tx, err := (&txtypes.TxRaw{BodyBytes: bodyBytes}).Marshal()
+	require.NoError(t, err)
+	return tx
+}
+
+func TestImportBlockVotes(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		datapath = t.TempDir()
+	)
+	execMsg, err := codectypes.NewAnyWithValue(&govtypes.MsgVote{ProposalId: 1, Voter: "addr4", Option: govtypes.OptionNo})
+	require.NoError(t, err)
+	srv := newFakeRPCServer(t, map[int64]fakeRPCBlock{
+		10: {
+			txs: []cmttypes.Tx{
+				newTestTx(t, &govtypes.MsgVote{ProposalId: 1, Voter: "addr1", Option: govtypes.OptionYes}),
+				// failed tx
+				newTestTx(t, &govtypes.MsgVote{ProposalId: 1, Voter: "addr2", Option: govtypes.OptionYes}),
+				// other proposal
+				newTestTx(t, &govtypes.MsgVote{ProposalId: 2, Voter: "addr2", Option: govtypes.OptionYes}),
+			},
+			codes: []uint32{0, 5, 0},
+		},
+		11: {},
+		12: {
+			txs: []cmttypes.Tx{
+				newTestTx(t,
+					&govv1.MsgVoteWeighted{ProposalId: 1, Voter: "addr3", Options: []*govv1.WeightedVoteOption{
+						{Option: govv1.OptionYes, Weight: "0.4"},
+						{Option: govv1.OptionAbstain, Weight: "0.6"},
+					}},
+					&authz.MsgExec{Grantee: "addr5", Msgs: []*codectypes.Any{execMsg}},
+				),
+				newTestTx(t, &govv1.MsgVote{ProposalId: 1, Voter: "addr1", Option: govv1.OptionNo}),
+			},
+			codes: []uint32{0, 0},
+		},
+	})
+	require.NoError(t, os.WriteFile(filepath.Join(datapath, "votes.json"), []byte(`[]`), 0o644))
+	m, err := createManifest(datapath, 9, "1")
+	require.NoError(t, err)
+	require.NoError(t, m.write(datapath))
+	src, err := newRPCBlockSource(srv.URL)
+	require.NoError(t, err)
+
+	err = importBlockVotes(ctx, src, 1, 10, 12, datapath)
+
+	require.NoError(t, err)
+	require.NoError(t, verifyManifest(datapath, "block_votes.json"))
+	records, err := parseVoteRecords(ctx, datapath, false)
+	require.NoError(t, err)
+	type vote struct {
+		voter   string
+		height  int64
+		txIndex int
+		options govtypes.WeightedVoteOptions
+	}
+	var votes []vote
+	for _, r := range records {
+		votes = append(votes, vote{r.Voter, r.Height, r.TxIndex, r.Options})
+	}
+	assert.Equal(t, []vote{
+		{"addr1", 10, 0, govtypes.NewNonSplitVoteOption(govtypes.OptionYes)},
+		{"addr3", 12, 0, govtypes.WeightedVoteOptions{
+			{Option: govtypes.OptionYes, Weight: math.LegacyNewDecWithPrec(4, 1)},
+			{Option: govtypes.OptionAbstain, Weight: math.LegacyNewDecWithPrec(6, 1)},
+		}},
+		{"addr4", 12, 0, govtypes.NewNonSplitVoteOption(govtypes.OptionNo)},
+		{"addr1", 12, 1, govtypes.NewNonSplitVoteOption(govtypes.OptionNo)},
+	}, votes)
+
+	// Import again a single block, the votes of the other blocks are kept
+	err = importBlockVotes(ctx, src, 1, 12, 12, datapath)
+
+	require.NoError(t, err)
+	records, err = parseVoteRecords(ctx, datapath, false)
+	require.NoError(t, err)
+	assert.Len(t, records, 4)
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"cosmossdk.io/math"
+
+	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types/v1beta1"
+)
+
+// bucketSource is the amount of an account a bucket selects from.
+type bucketSource string
+
+const (
+	sourceStaked bucketSource = "staked"
+	sourceLiquid bucketSource = "liquid"
+)
+
+// bucketSelector selects the $ATOM amount of an account that falls into a
+// bucket.
+type bucketSelector struct {
+	Source bucketSource
+	// Options selects the part of the staked amount weighted by these vote
+	// options (OptionEmpty for the accounts that didn't vote), all the staked
+	// amount if empty. Only valid with sourceStaked.
+	Options []govtypes.VoteOption
+}
+
+// amount returns the $ATOM amount of acc selected by s, voteWeights being
+// acc.voteWeights().
+func (s bucketSelector) amount(acc Account, voteWeights voteMap) math.LegacyDec {
+	if s.Source == sourceLiquid {
+		return acc.LiquidAmount
+	}
+	if len(s.Options) == 0 {
+		return acc.StakedAmount
+	}
+	weight := math.LegacyZeroDec()
+	for _, o := range s.Options {
+		weight = weight.Add(voteWeights[o])
+	}
+	return weight.Mul(acc.StakedAmount)
+}
+
+// bucket is a part of the airdrop: the $ATOM amounts selected by Select are
+// multiplied by Multiplier and BonusMalus.
+type bucket struct {
+	Name       string
+	Select     bucketSelector
+	Multiplier math.LegacyDec
+	BonusMalus math.LegacyDec
+	// Target is the name of the normalization target of the bucket, empty if
+	// the bucket has a fixed Multiplier. The buckets of a target share a
+	// multiplier, computed so that they get the target share of the airdrop
+	// (bonus and malus excluded), see solveTargetMultipliers.
+	Target string
+}
+
+// prop001Buckets returns the buckets of GovGen PROP 001: Yes votes get x yes,
+// No and NoWithVeto votes get x no (with bonus for NoWithVeto), while the
+// abstain, did not vote (with malus) and liquid (with malus) amounts share the
+// non_voters target.
+func prop001Buckets(yes, no, bonus, malus math.LegacyDec) []bucket {
+	var (
+		one    = math.LegacyOneDec()
+		staked = func(o govtypes.VoteOption) bucketSelector {
+			return bucketSelector{Source: sourceStaked, Options: []govtypes.VoteOption{o}}
+		}
+	)
+	return []bucket{
+		{Name: "yes", Select: staked(govtypes.OptionYes), Multiplier: yes, BonusMalus: one},
+		{Name: "no", Select: staked(govtypes.OptionNo), Multiplier: no, BonusMalus: one},
+		{Name: "nwv", Select: staked(govtypes.OptionNoWithVeto), Multiplier: no, BonusMalus: bonus},
+		{Name: "abs", Select: staked(govtypes.OptionAbstain), BonusMalus: one, Target: "non_voters"},
+		{Name: "dnv", Select: staked(govtypes.OptionEmpty), BonusMalus: malus, Target: "non_voters"},
+		{Name: "liquid", Select: bucketSelector{Source: sourceLiquid}, BonusMalus: malus, Target: "non_voters"},
+	}
+}
+
+// parseBucketOption parses a vote option name of a bucket selector, like yes,
+// no_with_veto or did_not_vote.
+func parseBucketOption(name string) (govtypes.VoteOption, error) {
+	if name == "did_not_vote" {
+		return govtypes.OptionEmpty, nil
+	}
+	option, ok := govtypes.VoteOption_value["VOTE_OPTION_"+strings.ToUpper(name)]
+	if !ok || option == int32(govtypes.OptionEmpty) {
+		return 0, fmt.Errorf("unknown vote option '%s'", name)
+	}
+	return govtypes.VoteOption(option), nil
+}
+
+// bucketOptions are the vote options a staked bucket can select, OptionEmpty
+// standing for the accounts that didn't vote.
+var bucketOptions = []govtypes.VoteOption{
+	govtypes.OptionYes, govtypes.OptionAbstain, govtypes.OptionNo,
+	govtypes.OptionNoWithVeto, govtypes.OptionEmpty,
+}
+
+// bucketOptionName returns the name of o in a bucket selector, the reverse of
+// parseBucketOption.
+func bucketOptionName(o govtypes.VoteOption) string {
+	if o == govtypes.OptionEmpty {
+		return "did_not_vote"
+	}
+	return strings.ToLower(strings.TrimPrefix(o.String(), "VOTE_OPTION_"))
+}
+
+// validateBuckets checks the buckets and their normalization targets. The
+// buckets must select each staked vote option and the liquid amount exactly
+// once, so no $ATOM is counted twice or dropped.
+func validateBuckets(buckets []bucket, targets map[string]math.LegacyDec) error {
+	if len(buckets) == 0 {
+		return errors.New("no buckets")
+	}
+	var (
+		names       = make(map[string]bool)
+		usedTargets = make(map[string]bool)
+		fixed       bool
+		// bucket names by selected part: the name of a staked option or
+		// liquid
+		selectedBy = make(map[string]string)
+		selects    = func(b bucket, part string) error {
+			if other, ok := selectedBy[part]; ok {
+				return fmt.Errorf("buckets '%s' and '%s' both select %s", other, b.Name, part)
+			}
+			selectedBy[part] = b.Name
+			return nil
+		}
+	)
+	for _, b := range buckets {
+		if b.Name == "" {
+			return errors.New("bucket without name")
+		}
+		if names[b.Name] {
+			return fmt.Errorf("duplicate bucket '%s'", b.Name)
+		}
+		names[b.Name] = true
+		switch b.Select.Source {
+		case sourceStaked:
+			options := b.Select.Options
+			if len(options) == 0 {
+				options = bucketOptions
+			}
+			for _, o := range options {
+				if err := selects(b, bucketOptionName(o)); err != nil {
+					return err
+				}
+			}
+		case sourceLiquid:
+			if len(b.Select.Options) > 0 {
+				return fmt.Errorf("bucket '%s': vote options require the staked source", b.Name)
+			}
+			if err := selects(b, string(sourceLiquid)); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("bucket '%s': unknown source '%s'", b.Name, b.Select.Source)
+		}
+		if b.BonusMalus.IsNil() || b.BonusMalus.IsNegative() {
+			return fmt.Errorf("bucket '%s': invalid bonus_malus", b.Name)
+		}
+		if b.Target == "" {
+			if b.Multiplier.IsNil() || b.Multiplier.IsNegative() {
+				return fmt.Errorf("bucket '%s': missing multiplier or target", b.Name)
+			}
+			fixed = true
+			continue
+		}
+		if !b.Multiplier.IsNil() {
+			return fmt.Errorf("bucket '%s': multiplier and target are exclusive", b.Name)
+		}
+		if _, ok := targets[b.Target]; !ok {
+			return fmt.Errorf("bucket '%s': unknown target '%s'", b.Name, b.Target)
+		}
+		usedTargets[b.Target] = true
+	}
+	total := math.LegacyZeroDec()
+	for name, share := range targets {
+		if !usedTargets[name] {
+			return fmt.Errorf("target '%s' has no bucket", name)
+		}
+		if !share.IsPositive() {
+			return fmt.Errorf("target '%s' must be positive", name)
+		}
+		total = total.Add(share)
+	}
+	if len(targets) > 0 && (!fixed || total.GTE(math.LegacyOneDec())) {
+		return errors.New("targets require buckets with a fixed multiplier and must sum below 1")
+	}
+	for _, o := range bucketOptions {
+		if _, ok := selectedBy[bucketOptionName(o)]; !ok {
+			return fmt.Errorf("no bucket selects %s", bucketOptionName(o))
+		}
+	}
+	if _, ok := selectedBy[string(sourceLiquid)]; !ok {
+		return fmt.Errorf("no bucket selects %s", sourceLiquid)
+	}
+	return nil
+}
+
+// solveTargetMultipliers returns the multipliers of the normalization targets,
+// atomAmts being the $ATOM amounts of buckets. With F the sum of the amounts
+// of the fixed buckets times their multiplier, S the sum of the target shares,
+// and A the amount of the buckets of a target of share s:
+//
+//	multiplier = (s x F) / ((1 - S) x A)
+//
+// so that each target gets its share of the airdrop, bonus and malus
+// excluded. The multiplier is zero if A is zero.
+func solveTargetMultipliers(buckets []bucket, atomAmts []math.LegacyDec, targets map[string]math.LegacyDec) map[string]math.LegacyDec {
+	var (
+		fixed      = math.LegacyZeroDec()
+		targetAmts = make(map[string]math.LegacyDec, len(targets))
+		totalShare = math.LegacyZeroDec()
+	)
+	for name, share := range targets {
+		targetAmts[name] = math.LegacyZeroDec()
+		totalShare = totalShare.Add(share)
+	}
+	for i, b := range buckets {
+		if b.Target == "" {
+			fixed = fixed.Add(atomAmts[i].Mul(b.Multiplier))
+			continue
+		}
+		targetAmts[b.Target] = targetAmts[b.Target].Add(atomAmts[i])
+	}
+	multipliers := make(map[string]math.LegacyDec, len(targets))
+	for name, share := range targets {
+		if targetAmts[name].IsZero() {
+			multipliers[name] = math.LegacyZeroDec()
+			continue
+		}
+		multipliers[name] = share.Mul(fixed).
+			Quo(math.LegacyOneDec().Sub(totalShare).Mul(targetAmts[name]))
+	}
+	return multipliers
+}
+
+// writeAirdropDetailCSV writes the per address detail of a into the CSV file
+// at path, with 4 columns per bucket.
+func writeAirdropDetailCSV(path string, a airdrop) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	header := []string{"address", "factor"}
+	for _, b := range a.params.buckets {
+		header = append(header, b.Name+"AtomAmt", b.Name+"Multiplier", b.Name+"BonusMalus", b.Name+"AtoneAmt")
+	}
+	w.Write(append(header, "totalAtoneAmt"))
+	for _, v := range a.addressesDetail {
+		row := []string{v.Address, a.params.supplyFactor.String()}
+		for _, d := range v.Buckets {
+			row = append(row, d.AtomAmt.String(), d.Multiplier.String(), d.BonusMalus.String(), d.AtoneAmt.String())
+		}
+		w.Write(append(row, v.Total.String()))
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// bucketIndex returns the index of the bucket named name in buckets, -1 if
+// there is none.
+func bucketIndex(buckets []bucket, name string) int {
+	return slices.IndexFunc(buckets, func(b bucket) bool { return b.Name == name })
+}
+
+// withMultipliers returns the combinations of paramss with each of the comma
+// separated multipliers set to the buckets named names.
+func withMultipliers(paramss []distriParams, multipliers string, names ...string) ([]distriParams, error) {
+	var res []distriParams
+	for _, params := range paramss {
+		for _, s := range strings.Split(multipliers, ",") {
+			m, err := math.LegacyNewDecFromStr(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid multiplier '%s': %w", s, err)
+			}
+			p, err := params.withMultiplier(m, names...)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, p)
+		}
+	}
+	return res, nil
+}
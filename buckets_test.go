@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cosmossdk.io/math"
+
+	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types/v1beta1"
+)
+
+func TestBucketSelectorAmount(t *testing.T) {
+	acc := Account{
+		LiquidAmount: math.LegacyNewDec(10),
+		StakedAmount: math.LegacyNewDec(100),
+		Vote: govtypes.WeightedVoteOptions{
+			{Option: govtypes.OptionYes, Weight: math.LegacyNewDecWithPrec(7, 1)},
+			{Option: govtypes.OptionNo, Weight: math.LegacyNewDecWithPrec(3, 1)},
+		},
+	}
+	tests := []struct {
+		name           string
+		selector       bucketSelector
+		expectedAmount math.LegacyDec
+	}{
+		{
+			name:           "liquid",
+			selector:       bucketSelector{Source: sourceLiquid},
+			expectedAmount: math.LegacyNewDec(10),
+		},
+		{
+			name:           "staked",
+			selector:       bucketSelector{Source: sourceStaked},
+			expectedAmount: math.LegacyNewDec(100),
+		},
+		{
+			name:           "staked yes",
+			selector:       bucketSelector{Source: sourceStaked, Options: []govtypes.VoteOption{govtypes.OptionYes}},
+			expectedAmount: math.LegacyNewDec(70),
+		},
+		{
+			name: "staked yes and no",
+			selector: bucketSelector{Source: sourceStaked, Options: []govtypes.VoteOption{
+				govtypes.OptionYes, govtypes.OptionNo,
+			}},
+			expectedAmount: math.LegacyNewDec(100),
+		},
+		{
+			name:           "staked did not vote",
+			selector:       bucketSelector{Source: sourceStaked, Options: []govtypes.VoteOption{govtypes.OptionEmpty}},
+			expectedAmount: math.LegacyZeroDec(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			amount := tt.selector.amount(acc, acc.voteWeights())
+
+			assert.Equal(t, tt.expectedAmount.String(), amount.String())
+		})
+	}
+}
+
+func TestValidateBuckets(t *testing.T) {
+	var (
+		one    = math.LegacyOneDec()
+		fixed  = bucket{Name: "fixed", Select: bucketSelector{Source: sourceStaked}, Multiplier: one, BonusMalus: one}
+		target = bucket{Name: "target", Select: bucketSelector{Source: sourceLiquid}, BonusMalus: one, Target: "t"}
+		half   = map[string]math.LegacyDec{"t": math.LegacyNewDecWithPrec(5, 1)}
+	)
+	tests := []struct {
+		name          string
+		buckets       []bucket
+		targets       map[string]math.LegacyDec
+		expectedError string
+	}{
+		{
+			name:    "ok",
+			buckets: []bucket{fixed, target},
+			targets: half,
+		},
+		{
+			name:          "no buckets",
+			expectedError: "no buckets",
+		},
+		{
+			name:          "duplicate",
+			buckets:       []bucket{fixed, fixed},
+			expectedError: "duplicate bucket 'fixed'",
+		},
+		{
+			name:          "missing multiplier",
+			buckets:       []bucket{{Name: "b", Select: bucketSelector{Source: sourceStaked}, BonusMalus: one}},
+			expectedError: "bucket 'b': missing multiplier or target",
+		},
+		{
+			name:          "unknown source",
+			buckets:       []bucket{{Name: "b", Select: bucketSelector{Source: "foo"}, Multiplier: one, BonusMalus: one}},
+			expectedError: "bucket 'b': unknown source 'foo'",
+		},
+		{
+			name:          "unused target",
+			buckets:       []bucket{fixed},
+			targets:       half,
+			expectedError: "target 't' has no bucket",
+		},
+		{
+			name:          "only targets",
+			buckets:       []bucket{target},
+			targets:       half,
+			expectedError: "targets require buckets with a fixed multiplier and must sum below 1",
+		},
+		{
+			name: "overlapping options",
+			buckets: []bucket{
+				{Name: "yes", Select: bucketSelector{Source: sourceStaked, Options: []govtypes.VoteOption{govtypes.OptionYes}}, Multiplier: one, BonusMalus: one},
+				{Name: "yes2", Select: bucketSelector{Source: sourceStaked, Options: []govtypes.VoteOption{govtypes.OptionYes}}, Multiplier: one, BonusMalus: one},
+			},
+			expectedError: "buckets 'yes' and 'yes2' both select yes",
+		},
+		{
+			name: "staked bucket next to option buckets",
+			buckets: []bucket{
+				{Name: "nwv", Select: bucketSelector{Source: sourceStaked, Options: []govtypes.VoteOption{govtypes.OptionNoWithVeto}}, Multiplier: one, BonusMalus: one},
+				fixed,
+			},
+			expectedError: "buckets 'nwv' and 'fixed' both select no_with_veto",
+		},
+		{
+			name: "missing option",
+			buckets: []bucket{
+				{Name: "voters", Select: bucketSelector{Source: sourceStaked, Options: []govtypes.VoteOption{
+					govtypes.OptionYes, govtypes.OptionAbstain, govtypes.OptionNo, govtypes.OptionNoWithVeto,
+				}}, Multiplier: one, BonusMalus: one},
+				target,
+			},
+			targets:       half,
+			expectedError: "no bucket selects did_not_vote",
+		},
+		{
+			name:          "missing liquid",
+			buckets:       []bucket{fixed},
+			expectedError: "no bucket selects liquid",
+		},
+		{
+			name:          "targets sum to 1",
+			buckets:       []bucket{fixed, target},
+			targets:       map[string]math.LegacyDec{"t": one},
+			expectedError: "targets require buckets with a fixed multiplier and must sum below 1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateBuckets(tt.buckets, tt.targets)
+
+			if tt.expectedError != "" {
+				require.EqualError(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestSolveTargetMultipliers(t *testing.T) {
+	var (
+		one     = math.LegacyOneDec()
+		buckets = []bucket{
+			{Name: "a", Multiplier: math.LegacyNewDec(2)},
+			{Name: "b", Multiplier: one},
+			{Name: "c", Target: "t1"},
+			{Name: "d", Target: "t2"},
+			{Name: "e", Target: "t2"},
+			{Name: "f", Target: "t3"},
+		}
+		atomAmts = []math.LegacyDec{
+			math.LegacyNewDec(100), math.LegacyNewDec(100), math.LegacyNewDec(50),
+			math.LegacyNewDec(100), math.LegacyNewDec(100), math.LegacyZeroDec(),
+		}
+		targets = map[string]math.LegacyDec{
+			"t1": math.LegacyNewDecWithPrec(2, 1),
+			"t2": math.LegacyNewDecWithPrec(3, 1),
+			"t3": math.LegacyNewDecWithPrec(1, 1),
+		}
+	)
+
+	multipliers := solveTargetMultipliers(buckets, atomAmts, targets)
+
+	// fixed buckets get 300, i.e. 40% of the airdrop (750), so t1 gets 150 and
+	// t2 225.
+	assert.Equal(t, map[string]math.LegacyDec{
+		"t1": math.LegacyNewDec(3),
+		"t2": math.LegacyMustNewDecFromStr("1.125"),
+		"t3": math.LegacyZeroDec(),
+	}, multipliers)
+}
+
+func TestDistributionBuckets(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	var (
+		one    = math.LegacyOneDec()
+		params = distriParams{
+			buckets: []bucket{
+				{
+					Name: "voters",
+					Select: bucketSelector{Source: sourceStaked, Options: []govtypes.VoteOption{
+						govtypes.OptionYes, govtypes.OptionNo,
+					}},
+					Multiplier: math.LegacyNewDec(2),
+					BonusMalus: one,
+				},
+				{
+					Name: "others",
+					Select: bucketSelector{Source: sourceStaked, Options: []govtypes.VoteOption{
+						govtypes.OptionAbstain, govtypes.OptionNoWithVeto, govtypes.OptionEmpty,
+					}},
+					BonusMalus: one,
+					Target:     "rest",
+				},
+				{Name: "liquid", Select: bucketSelector{Source: sourceLiquid}, Multiplier: one, BonusMalus: one},
+			},
+			targets:            map[string]math.LegacyDec{"rest": math.LegacyNewDecWithPrec(2, 1)},
+			supplyFactor:       one,
+			supplyMintFactor:   math.LegacyZeroDec(),
+			communityPoolShare: one,
+		}
+		accounts = []Account{
+			{
+				Address:      "voter",
+				LiquidAmount: math.LegacyZeroDec(),
+				StakedAmount: math.LegacyNewDec(100),
+				Vote:         govtypes.NewNonSplitVoteOption(govtypes.OptionYes),
+			},
+			{
+				Address:      "other",
+				LiquidAmount: math.LegacyNewDec(60),
+				StakedAmount: math.LegacyNewDec(100),
+				Delegations:  []Delegation{{Amount: math.LegacyNewDec(100)}},
+			},
+		}
+	)
+
+	airdrop, err := distribution(accounts, params, "", defaultRules())
+
+	require.NoError(err)
+	// rest multiplier = 0.2 x (100 x 2 + 60) / (0.8 x 100)
+	assert.Equal(math.LegacyMustNewDecFromStr("0.65"), airdrop.targetMultipliers["rest"])
+	assert.Equal(math.NewInt(200), airdrop.addresses["voter"])
+	assert.Equal(math.NewInt(125), airdrop.addresses["other"])
+	assert.Equal(int64(325), airdrop.atone.supply.RoundInt64())
+	assert.Equal(int64(65), airdrop.atone.buckets[1].RoundInt64())
+
+	path := filepath.Join(t.TempDir(), "airdrop_detail.csv")
+	require.NoError(writeAirdropDetailCSV(path, airdrop))
+	f, err := os.Open(path)
+	require.NoError(err)
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	require.NoError(err)
+	require.Len(records, 3)
+	assert.Equal([]string{
+		"address", "factor",
+		"votersAtomAmt", "votersMultiplier", "votersBonusMalus", "votersAtoneAmt",
+		"othersAtomAmt", "othersMultiplier", "othersBonusMalus", "othersAtoneAmt",
+		"liquidAtomAmt", "liquidMultiplier", "liquidBonusMalus", "liquidAtoneAmt",
+		"totalAtoneAmt",
+	}, records[0])
+}
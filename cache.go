@@ -0,0 +1,480 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"cosmossdk.io/math"
+
+	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types/v1beta1"
+)
+
+// cacheMagic starts every cache file, it must be changed whenever the binary
+// form of a cached record changes.
+const cacheMagic = "govbox-cache-v4\n"
+
+// cacheRecord is the constraint of the types that can be stored in the cache.
+// It is satisfied by all the gogoproto generated types.
+type cacheRecord[T any] interface {
+	*T
+	Marshal() ([]byte, error)
+	Unmarshal([]byte) error
+}
+
+// readCachedRecords is like readRecords, but the records are read from a
+// binary cache file when available, which is much faster than JSON decoding.
+// The cache file is stored in the directory <dir>.cache next to the directory
+// of path, and its name includes the SHA-256 of the file at path, so any change
+// of the input file invalidates the cache. On cache miss, the records decoded
+// from path are written to a new cache file, and the stale cache files of path
+// are removed.
+// If useCache is false, this is strictly equivalent to readRecords.
+func readCachedRecords[T any, PT cacheRecord[T]](ctx context.Context, path, key string, decodeNext func(*json.Decoder, *T) error, useCache bool) iter.Seq2[T, error] {
+	if !useCache {
+		return readRecords(ctx, path, key, decodeNext)
+	}
+	return func(yield func(T, error) bool) {
+		var zero T
+		cacheFile, err := cacheFilename(path, key)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		if _, err := os.Stat(cacheFile); err == nil {
+			for v, err := range readCacheFile[T, PT](ctx, cacheFile) {
+				if err != nil {
+					err = fmt.Errorf("%w (remove the file or use -no-cache)", err)
+				}
+				if !yield(v, err) || err != nil {
+					return
+				}
+			}
+			return
+		}
+		w, err := newCacheWriter(cacheFile)
+		if err != nil {
+			// Not being able to write the cache isn't fatal
+			fmt.Printf("Warning: cannot create cache for %s: %v\n", path, err)
+			for v, err := range readRecords(ctx, path, key, decodeNext) {
+				if !yield(v, err) {
+					return
+				}
+			}
+			return
+		}
+		// Discard the cache file unless all records have been written
+		defer w.abort()
+		for v, err := range readRecords(ctx, path, key, decodeNext) {
+			if err == nil {
+				err = w.write(PT(&v))
+			}
+			if !yield(v, err) || err != nil {
+				return
+			}
+		}
+		if err := w.commit(); err != nil {
+			fmt.Printf("Warning: cannot save cache for %s: %v\n", path, err)
+			return
+		}
+		removeStaleCacheFiles(cacheFile)
+	}
+}
+
+// cacheFilename returns the path of the cache file of the records of path,
+// located in its top-level field key if key isn't empty.
+func cacheFilename(path, key string) (string, error) {
+	sum, err := sha256File(path)
+	if err != nil {
+		return "", err
+	}
+	name := filepath.Base(path)
+	if key != "" {
+		name += "." + key
+	}
+	dir := filepath.Clean(filepath.Dir(path)) + ".cache"
+	return filepath.Join(dir, name+"-"+sum+".bin"), nil
+}
+
+// fileSums memoizes the results of sha256File, since the manifest
+// verification and the cache both need the checksums of the same files.
+var fileSums sync.Map // map[string]fileSum
+
+type fileSum struct {
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+// sha256File returns the hex encoded SHA-256 of the content of the file at
+// path. The result is memoized as long as the size and the modification time
+// of the file don't change.
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if v, ok := fileSums.Load(path); ok {
+		if s := v.(fileSum); s.size == fi.Size() && s.modTime.Equal(fi.ModTime()) {
+			return s.sum, nil
+		}
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	fileSums.Store(path, fileSum{size: fi.Size(), modTime: fi.ModTime(), sum: sum})
+	return sum, nil
+}
+
+// removeStaleCacheFiles removes the cache files of the same input than
+// cacheFile, which have been created from a previous version of the input.
+func removeStaleCacheFiles(cacheFile string) {
+	name := filepath.Base(cacheFile)
+	prefix := name[:strings.LastIndexByte(name, '-')+1]
+	matches, _ := filepath.Glob(filepath.Join(filepath.Dir(cacheFile), prefix+"*.bin"))
+	for _, m := range matches {
+		if m != cacheFile {
+			os.Remove(m)
+		}
+	}
+}
+
+// readCacheFile returns an iterator over the records of the cache file at
+// path. Records are stored as their binary form prefixed by their length.
+func readCacheFile[T any, PT cacheRecord[T]](ctx context.Context, path string) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		f, err := os.Open(path)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		defer f.Close()
+		r := bufio.NewReader(f)
+		magic := make([]byte, len(cacheMagic))
+		if _, err := io.ReadFull(r, magic); err != nil || string(magic) != cacheMagic {
+			yield(zero, fmt.Errorf("%s: invalid cache file", path))
+			return
+		}
+		var buf []byte
+		for {
+			if err := ctx.Err(); err != nil {
+				yield(zero, err)
+				return
+			}
+			n, err := binary.ReadUvarint(r)
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				yield(zero, fmt.Errorf("%s: %w", path, err))
+				return
+			}
+			if uint64(cap(buf)) < n {
+				buf = make([]byte, n)
+			}
+			buf = buf[:n]
+			if _, err := io.ReadFull(r, buf); err != nil {
+				yield(zero, fmt.Errorf("%s: %w", path, err))
+				return
+			}
+			var v T
+			if err := PT(&v).Unmarshal(buf); err != nil {
+				yield(zero, fmt.Errorf("%s: %w", path, err))
+				return
+			}
+			if !yield(v, nil) {
+				return
+			}
+		}
+	}
+}
+
+// cacheWriter writes records into a temporary file, which is renamed to the
+// cache file once all records are written, so an interrupted run never leaves
+// a partial cache file.
+type cacheWriter struct {
+	path string
+	f    *os.File
+	w    *bufio.Writer
+	buf  []byte
+}
+
+func newCacheWriter(path string) (*cacheWriter, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(f)
+	w.WriteString(cacheMagic)
+	return &cacheWriter{path: path, f: f, w: w}, nil
+}
+
+func (c *cacheWriter) write(v interface{ Marshal() ([]byte, error) }) error {
+	bz, err := v.Marshal()
+	if err != nil {
+		return err
+	}
+	c.buf = binary.AppendUvarint(c.buf[:0], uint64(len(bz)))
+	c.w.Write(c.buf)
+	_, err = c.w.Write(bz)
+	return err
+}
+
+func (c *cacheWriter) commit() error {
+	if err := c.w.Flush(); err != nil {
+		return err
+	}
+	if err := c.f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(c.f.Name(), c.path); err != nil {
+		return err
+	}
+	c.f = nil
+	return nil
+}
+
+// abort removes the temporary file if commit hasn't been called.
+func (c *cacheWriter) abort() {
+	if c.f == nil {
+		return
+	}
+	c.f.Close()
+	os.Remove(c.f.Name())
+}
+
+// Marshal returns the binary form of a, for the cache of accounts.json.
+func (a Account) Marshal() ([]byte, error) {
+	var e binEncoder
+	e.string(a.Address)
+	e.string(a.Type)
+	e.dec(a.LiquidAmount)
+	e.dec(a.StakedAmount)
+	e.vote(a.Vote)
+	e.uvarint(uint64(len(a.Delegations)))
+	for _, d := range a.Delegations {
+		e.dec(d.Amount)
+		e.string(d.ValidatorAddress)
+		e.vote(d.Vote)
+	}
+	e.uvarint(uint64(len(a.PendingStakes)))
+	for _, ps := range a.PendingStakes {
+		e.string(ps.Kind)
+		e.string(ps.ValidatorAddress)
+		e.dec(ps.Amount)
+		e.string(ps.Treatment)
+	}
+	if a.Vesting == nil {
+		e.uvarint(0)
+	} else {
+		e.uvarint(1)
+		e.dec(a.Vesting.OriginalVesting)
+		e.dec(a.Vesting.Vested)
+		e.dec(a.Vesting.DelegatedVesting)
+		e.time(a.Vesting.EndTime)
+	}
+	e.uvarint(uint64(len(a.TokenizedShares)))
+	for _, ts := range a.TokenizedShares {
+		e.uvarint(ts.RecordID)
+		e.string(ts.ValidatorAddress)
+		e.dec(ts.Amount)
+	}
+	return e.buf, e.err
+}
+
+// Unmarshal decodes the binary form of an account returned by Marshal.
+func (a *Account) Unmarshal(bz []byte) error {
+	d := binDecoder{buf: bz}
+	a.Address = d.string()
+	a.Type = d.string()
+	a.LiquidAmount = d.dec()
+	a.StakedAmount = d.dec()
+	a.Vote = d.vote()
+	a.Delegations = nil
+	if n := d.uvarint(); n > 0 && d.err == nil {
+		a.Delegations = make([]Delegation, n)
+		for i := range a.Delegations {
+			a.Delegations[i].Amount = d.dec()
+			a.Delegations[i].ValidatorAddress = d.string()
+			a.Delegations[i].Vote = d.vote()
+		}
+	}
+	a.PendingStakes = nil
+	if n := d.uvarint(); n > 0 && d.err == nil {
+		a.PendingStakes = make([]PendingStake, n)
+		for i := range a.PendingStakes {
+			a.PendingStakes[i].Kind = d.string()
+			a.PendingStakes[i].ValidatorAddress = d.string()
+			a.PendingStakes[i].Amount = d.dec()
+			a.PendingStakes[i].Treatment = d.string()
+		}
+	}
+	a.Vesting = nil
+	if d.uvarint() == 1 {
+		a.Vesting = &VestingInfo{
+			OriginalVesting:  d.dec(),
+			Vested:           d.dec(),
+			DelegatedVesting: d.dec(),
+			EndTime:          d.time(),
+		}
+	}
+	a.TokenizedShares = nil
+	if n := d.uvarint(); n > 0 && d.err == nil {
+		a.TokenizedShares = make([]TokenizedShare, n)
+		for i := range a.TokenizedShares {
+			a.TokenizedShares[i].RecordID = d.uvarint()
+			a.TokenizedShares[i].ValidatorAddress = d.string()
+			a.TokenizedShares[i].Amount = d.dec()
+		}
+	}
+	return d.err
+}
+
+// binEncoder appends length-prefixed values to buf, the first error is kept in
+// err and stops the encoding.
+type binEncoder struct {
+	buf []byte
+	err error
+}
+
+func (e *binEncoder) uvarint(n uint64) {
+	e.buf = binary.AppendUvarint(e.buf, n)
+}
+
+func (e *binEncoder) bytes(bz []byte) {
+	e.uvarint(uint64(len(bz)))
+	e.buf = append(e.buf, bz...)
+}
+
+func (e *binEncoder) string(s string) {
+	e.bytes([]byte(s))
+}
+
+func (e *binEncoder) dec(d math.LegacyDec) {
+	if e.err != nil {
+		return
+	}
+	if d.IsNil() {
+		// LegacyDec.Marshal doesn't support nil value
+		d = math.LegacyZeroDec()
+	}
+	bz, err := d.Marshal()
+	e.err = err
+	e.bytes(bz)
+}
+
+// time encodes t in seconds, the zero time is kept.
+func (e *binEncoder) time(t time.Time) {
+	if t.IsZero() {
+		e.uvarint(0)
+		return
+	}
+	e.uvarint(uint64(t.Unix()) + 1)
+}
+
+func (e *binEncoder) vote(v govtypes.WeightedVoteOptions) {
+	e.uvarint(uint64(len(v)))
+	for _, o := range v {
+		if e.err != nil {
+			return
+		}
+		bz, err := o.Marshal()
+		e.err = err
+		e.bytes(bz)
+	}
+}
+
+// binDecoder reads the values appended by binEncoder, the first error is kept
+// in err and stops the decoding.
+type binDecoder struct {
+	buf []byte
+	err error
+}
+
+func (d *binDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	n, l := binary.Uvarint(d.buf)
+	if l <= 0 {
+		d.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	d.buf = d.buf[l:]
+	return n
+}
+
+func (d *binDecoder) bytes() []byte {
+	n := d.uvarint()
+	if d.err != nil {
+		return nil
+	}
+	if uint64(len(d.buf)) < n {
+		d.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	bz := d.buf[:n]
+	d.buf = d.buf[n:]
+	return bz
+}
+
+func (d *binDecoder) string() string {
+	return string(d.bytes())
+}
+
+func (d *binDecoder) dec() math.LegacyDec {
+	bz := d.bytes()
+	if d.err != nil {
+		return math.LegacyDec{}
+	}
+	var v math.LegacyDec
+	d.err = v.Unmarshal(bz)
+	return v
+}
+
+func (d *binDecoder) time() time.Time {
+	n := d.uvarint()
+	if n == 0 || d.err != nil {
+		return time.Time{}
+	}
+	return time.Unix(int64(n-1), 0).UTC()
+}
+
+func (d *binDecoder) vote() govtypes.WeightedVoteOptions {
+	n := d.uvarint()
+	if n == 0 || d.err != nil {
+		return nil
+	}
+	v := make(govtypes.WeightedVoteOptions, n)
+	for i := range v {
+		bz := d.bytes()
+		if d.err != nil {
+			return nil
+		}
+		d.err = v[i].Unmarshal(bz)
+	}
+	return v
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cosmossdk.io/math"
+
+	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types/v1beta1"
+)
+
+func TestReadCachedRecords(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		dir      = t.TempDir()
+		datapath = filepath.Join(dir, "prop")
+		file     = filepath.Join(datapath, "votes.json")
+		cacheDir = filepath.Join(dir, "prop.cache")
+	)
+	require.NoError(t, os.Mkdir(datapath, 0o755))
+	writeVotes := func(voters ...string) {
+		content := "["
+		for i, v := range voters {
+			if i > 0 {
+				content += ","
+			}
+			content += `{"proposal_id": "1", "voter": "` + v + `", "options": [{"option": "VOTE_OPTION_YES", "weight": "1.0"}]}`
+		}
+		require.NoError(t, os.WriteFile(file, []byte(content+"]"), 0o644))
+	}
+	readVoters := func(useCache bool) []string {
+		var voters []string
+		for v, err := range readCachedRecords(ctx, file, "", protoDecodeNext[govtypes.Vote], useCache) {
+			require.NoError(t, err)
+			assert.Equal(t, govtypes.OptionYes, v.Options[0].Option)
+			voters = append(voters, v.Voter)
+		}
+		return voters
+	}
+	cacheFiles := func() []string {
+		matches, err := filepath.Glob(filepath.Join(cacheDir, "*"))
+		require.NoError(t, err)
+		return matches
+	}
+	writeVotes("addr1", "addr2")
+
+	// no cache
+	assert.Equal(t, []string{"addr1", "addr2"}, readVoters(false))
+	assert.Empty(t, cacheFiles())
+	// cache miss creates the cache file
+	assert.Equal(t, []string{"addr1", "addr2"}, readVoters(true))
+	require.Len(t, cacheFiles(), 1)
+	firstCacheFile := cacheFiles()[0]
+	// cache hit reads the cache file, so a broken cache file is reported
+	assert.Equal(t, []string{"addr1", "addr2"}, readVoters(true))
+	assert.Equal(t, []string{firstCacheFile}, cacheFiles())
+	require.NoError(t, os.WriteFile(firstCacheFile, []byte("broken"), 0o644))
+	for _, err := range readCachedRecords(ctx, file, "", protoDecodeNext[govtypes.Vote], true) {
+		require.ErrorContains(t, err, "invalid cache file")
+	}
+	// input change invalidates the cache
+	writeVotes("addr3")
+	assert.Equal(t, []string{"addr3"}, readVoters(true))
+	require.Len(t, cacheFiles(), 1)
+	assert.NotEqual(t, firstCacheFile, cacheFiles()[0])
+}
+
+func TestAccountMarshal(t *testing.T) {
+	acc := Account{
+		Address:      "addr1",
+		Type:         "/cosmos.auth.v1beta1.BaseAccount",
+		LiquidAmount: math.LegacyNewDec(42),
+		StakedAmount: math.LegacyNewDecWithPrec(15, 1),
+		Vote: govtypes.WeightedVoteOptions{
+			{Option: govtypes.OptionYes, Weight: math.LegacyNewDecWithPrec(7, 1)},
+			{Option: govtypes.OptionNo, Weight: math.LegacyNewDecWithPrec(3, 1)},
+		},
+		Delegations: []Delegation{
+			{Amount: math.LegacyNewDec(1), ValidatorAddress: "val1"},
+			{
+				Amount:           math.LegacyNewDec(2),
+				ValidatorAddress: "val2",
+				Vote:             govtypes.WeightedVoteOptions{{Option: govtypes.OptionAbstain, Weight: math.LegacyOneDec()}},
+			},
+		},
+		PendingStakes: []PendingStake{
+			{Kind: pendingUnbonding, ValidatorAddress: "val1", Amount: math.LegacyNewDec(3), Treatment: "liquid"},
+		},
+		Vesting: &VestingInfo{
+			OriginalVesting:  math.LegacyNewDec(10),
+			Vested:           math.LegacyNewDec(4),
+			DelegatedVesting: math.LegacyNewDec(6),
+			EndTime:          time.Unix(1700000000, 0).UTC(),
+		},
+		TokenizedShares: []TokenizedShare{
+			{RecordID: 7, ValidatorAddress: "val2", Amount: math.LegacyNewDec(2)},
+		},
+	}
+
+	bz, err := acc.Marshal()
+	require.NoError(t, err)
+	var got Account
+	require.NoError(t, got.Unmarshal(bz))
+
+	assert.Equal(t, acc, got)
+	require.Error(t, got.Unmarshal(bz[:len(bz)-1]))
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"cosmossdk.io/math"
+)
+
+var (
+	// concentrationTopN are the numbers of top holders whose share is reported.
+	concentrationTopN = []int{1, 10, 100}
+	// concentrationPercentiles are the reported percentiles of the holdings.
+	concentrationPercentiles = []int{10, 25, 75, 90, 99}
+	// dustThreshold is the amount under which a holding is counted as dust: 1
+	// $ATOM or 1 $ATONE.
+	dustThreshold = math.NewInt(1_000_000)
+)
+
+// concentration holds the inequality metrics of the holdings of a supply.
+type concentration struct {
+	Holders int
+	Total   math.Int
+	Gini    math.LegacyDec
+	// Nakamoto is the smallest number of holders holding more than half of
+	// the supply.
+	Nakamoto int
+	// TopShares holds the share of the supply of the concentrationTopN top
+	// holders.
+	TopShares []math.LegacyDec
+	Median    math.LegacyDec
+	// Percentiles holds the holdings at concentrationPercentiles, with the
+	// nearest-rank method.
+	Percentiles []math.Int
+	// Dust is the number of holdings under dustThreshold.
+	Dust int
+}
+
+// newConcentration returns the concentration of amounts, the zero amounts
+// being ignored.
+func newConcentration(amounts []math.Int) concentration {
+	amounts = slices.DeleteFunc(slices.Clone(amounts), math.Int.IsZero)
+	slices.SortFunc(amounts, func(a, b math.Int) int {
+		return b.BigInt().Cmp(a.BigInt())
+	})
+	c := concentration{
+		Holders:  len(amounts),
+		Total:    sumAmounts(amounts),
+		Gini:     giniCoefficient(amounts),
+		Nakamoto: nakamotoCoefficient(amounts),
+		Median:   median(amounts),
+	}
+	for _, n := range concentrationTopN {
+		c.TopShares = append(c.TopShares, topShare(amounts, c.Total, n))
+	}
+	for _, p := range concentrationPercentiles {
+		c.Percentiles = append(c.Percentiles, percentile(amounts, p))
+	}
+	for _, amt := range slices.Backward(amounts) {
+		if amt.GTE(dustThreshold) {
+			break
+		}
+		c.Dust++
+	}
+	return c
+}
+
+// sortedAmounts returns the amounts of addresses sorted in descending order.
+func sortedAmounts(addresses map[string]math.Int) []math.Int {
+	return slices.SortedFunc(maps.Values(addresses), func(a, b math.Int) int {
+		return b.BigInt().Cmp(a.BigInt())
+	})
+}
+
+// giniCoefficient returns the Gini coefficient of amounts sorted in
+// descending order: 0 if all the amounts are equal, close to 1 if a single
+// amount holds everything.
+func giniCoefficient(amounts []math.Int) math.LegacyDec {
+	var (
+		n        = int64(len(amounts))
+		total    = math.ZeroInt()
+		weighted = math.ZeroInt()
+	)
+	for j, amt := range amounts {
+		// i is the rank of amt in ascending order
+		i := n - int64(j)
+		total = total.Add(amt)
+		weighted = weighted.Add(amt.MulRaw(i))
+	}
+	if total.IsZero() {
+		return math.LegacyZeroDec()
+	}
+	// G = 2 x sum(i x amount_i) / (n x total) - (n + 1) / n
+	return math.LegacyNewDecFromInt(weighted.MulRaw(2)).QuoInt(total.MulRaw(n)).
+		Sub(math.LegacyNewDec(n + 1).QuoInt64(n))
+}
+
+// topShare returns the share of total held by the n first amounts of amounts,
+// sorted in descending order.
+func topShare(amounts []math.Int, total math.Int, n int) math.LegacyDec {
+	if total.IsZero() {
+		return math.LegacyZeroDec()
+	}
+	sum := math.ZeroInt()
+	for _, amt := range amounts[:min(n, len(amounts))] {
+		sum = sum.Add(amt)
+	}
+	return math.LegacyNewDecFromInt(sum).QuoInt(total)
+}
+
+// sumAmounts returns the sum of amounts.
+func sumAmounts(amounts []math.Int) math.Int {
+	total := math.ZeroInt()
+	for _, amt := range amounts {
+		total = total.Add(amt)
+	}
+	return total
+}
+
+// nakamotoCoefficient returns the smallest number of the first amounts of
+// amounts, sorted in descending order, which sum to more than half of the
+// total.
+func nakamotoCoefficient(amounts []math.Int) int {
+	var (
+		half = sumAmounts(amounts).ToLegacyDec().QuoInt64(2)
+		sum  = math.ZeroInt()
+	)
+	for i, amt := range amounts {
+		sum = sum.Add(amt)
+		if sum.ToLegacyDec().GT(half) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// median returns the median of amounts, sorted in descending order.
+func median(amounts []math.Int) math.LegacyDec {
+	n := len(amounts)
+	if n == 0 {
+		return math.LegacyZeroDec()
+	}
+	if n%2 == 1 {
+		return amounts[n/2].ToLegacyDec()
+	}
+	return amounts[n/2-1].Add(amounts[n/2]).ToLegacyDec().QuoInt64(2)
+}
+
+// percentile returns the p-th percentile of amounts, sorted in descending
+// order, with the nearest-rank method.
+func percentile(amounts []math.Int, p int) math.Int {
+	n := len(amounts)
+	if n == 0 {
+		return math.ZeroInt()
+	}
+	// rank in ascending order is ceil(p x n / 100)
+	rank := max((p*n+99)/100, 1)
+	return amounts[n-rank]
+}
+
+// printConcentrations prints the atom and atone concentrations side by side.
+func printConcentrations(atom, atone concentration) {
+	table := newMarkdownTable("", "$ATOM", "$ATONE")
+	table.Append([]string{"Holders", fmt.Sprint(atom.Holders), fmt.Sprint(atone.Holders)})
+	table.Append([]string{"Gini", fmt.Sprintf("%.4f", atom.Gini.MustFloat64()), fmt.Sprintf("%.4f", atone.Gini.MustFloat64())})
+	table.Append([]string{"Nakamoto", fmt.Sprint(atom.Nakamoto), fmt.Sprint(atone.Nakamoto)})
+	for i, n := range concentrationTopN {
+		table.Append([]string{fmt.Sprintf("Top %d share", n), humanPercent(atom.TopShares[i]), humanPercent(atone.TopShares[i])})
+	}
+	table.Append([]string{"Median", humanf(atom.Median), humanf(atone.Median)})
+	for i, p := range concentrationPercentiles {
+		table.Append([]string{fmt.Sprintf("P%d", p), humanf(atom.Percentiles[i].ToLegacyDec()), humanf(atone.Percentiles[i].ToLegacyDec())})
+	}
+	table.Append([]string{"Dust (< " + human(dustThreshold) + ")", fmt.Sprint(atom.Dust), fmt.Sprint(atone.Dust)})
+	table.Render()
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"cosmossdk.io/math"
+)
+
+func TestGiniCoefficient(t *testing.T) {
+	ints := func(vs ...int64) []math.Int {
+		amounts := make([]math.Int, len(vs))
+		for i, v := range vs {
+			amounts[i] = math.NewInt(v)
+		}
+		return amounts
+	}
+	tests := []struct {
+		name         string
+		amounts      []math.Int
+		expectedGini math.LegacyDec
+	}{
+		{
+			name:         "empty",
+			expectedGini: math.LegacyZeroDec(),
+		},
+		{
+			name:         "equal",
+			amounts:      ints(5, 5, 5, 5),
+			expectedGini: math.LegacyZeroDec(),
+		},
+		{
+			name:    "single holder",
+			amounts: ints(100, 0, 0, 0),
+			// (n - 1) / n
+			expectedGini: math.LegacyNewDecWithPrec(75, 2),
+		},
+		{
+			name:    "unequal",
+			amounts: ints(3, 2, 1),
+			// 2 x (1x1 + 2x2 + 3x3) / (3 x 6) - 4/3
+			expectedGini: math.LegacyNewDec(28).QuoInt64(18).Sub(math.LegacyNewDec(4).QuoInt64(3)),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gini := giniCoefficient(tt.amounts)
+
+			assert.Equal(t, tt.expectedGini.String(), gini.String())
+		})
+	}
+}
+
+func TestTopShare(t *testing.T) {
+	amounts := []math.Int{math.NewInt(50), math.NewInt(30), math.NewInt(20)}
+	total := sumAmounts(amounts)
+
+	assert.Equal(t, math.LegacyNewDecWithPrec(5, 1), topShare(amounts, total, 1))
+	assert.Equal(t, math.LegacyNewDecWithPrec(8, 1), topShare(amounts, total, 2))
+	assert.Equal(t, math.LegacyOneDec(), topShare(amounts, total, 10))
+	assert.Equal(t, math.LegacyZeroDec(), topShare(nil, math.ZeroInt(), 10))
+}
+
+func TestNewConcentration(t *testing.T) {
+	var (
+		M       = int64(1_000_000)
+		amounts = []math.Int{
+			math.NewInt(2 * M), math.ZeroInt(), math.NewInt(10 * M), math.NewInt(M / 2),
+			math.NewInt(6 * M), math.NewInt(M),
+		}
+	)
+
+	c := newConcentration(amounts)
+
+	assert.Equal(t, 5, c.Holders)
+	assert.Equal(t, math.NewInt(39*M/2), c.Total)
+	assert.Equal(t, giniCoefficient([]math.Int{
+		math.NewInt(10 * M), math.NewInt(6 * M), math.NewInt(2 * M), math.NewInt(M), math.NewInt(M / 2),
+	}), c.Gini)
+	assert.Equal(t, 1, c.Nakamoto)
+	assert.Equal(t, []math.LegacyDec{
+		math.LegacyNewDec(20).QuoInt64(39), math.LegacyOneDec(), math.LegacyOneDec(),
+	}, c.TopShares)
+	assert.Equal(t, math.LegacyNewDec(2*M), c.Median)
+	// P10, P25, P75, P90 and P99
+	assert.Equal(t, []math.Int{
+		math.NewInt(M / 2), math.NewInt(M), math.NewInt(6 * M), math.NewInt(10 * M), math.NewInt(10 * M),
+	}, c.Percentiles)
+	assert.Equal(t, 1, c.Dust)
+	// amounts is unchanged
+	assert.Equal(t, math.ZeroInt(), amounts[1])
+}
+
+func TestNakamotoCoefficient(t *testing.T) {
+	ints := []math.Int{math.NewInt(30), math.NewInt(20), math.NewInt(20), math.NewInt(20), math.NewInt(10)}
+
+	// 30 + 20 = 50 isn't more than half of 100
+	assert.Equal(t, 3, nakamotoCoefficient(ints))
+	assert.Equal(t, 0, nakamotoCoefficient(nil))
+}
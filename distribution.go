@@ -2,8 +2,10 @@ package main
 
 import (
 	"fmt"
+	"maps"
 	"os"
 	"slices"
+	"strings"
 
 	"github.com/go-echarts/go-echarts/v2/charts"
 	"github.com/go-echarts/go-echarts/v2/components"
@@ -15,36 +17,28 @@ import (
 	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types/v1beta1"
 )
 
-// Some constants
-var (
-	// list of ICF wallets
-	icfWallets = []string{
-		// Source https://github.com/gnolang/bounties/issues/18#issuecomment-1034700230
-		"cosmos1z8mzakma7vnaajysmtkwt4wgjqr2m84tzvyfkz",
-		"cosmos1unc788q8md2jymsns24eyhua58palg5kc7cstv",
-		// The 2 addresses above have been emptied in favour of the following 2
-		"cosmos1sufkm72dw7ua9crpfhhp0dqpyuggtlhdse98e7",
-		"cosmos1z6czaavlk6kjd48rpf58kqqw9ssad2uaxnazgl",
-		// From other investigations
-		"cosmos17u903qxqc6dzn3chvmc9zzp9fl4xja0pwggfj7",
-	}
-)
-
 type airdrop struct {
 	// params hold the distribution parameters that resulted in this airdrop
 	params distriParams
 	// addresses contains the airdrop amount per address.
 	addresses       map[string]math.Int
 	addressesDetail []addrAmtDetail
-	// nonVotersMultiplier ensures that non-voters don't hold more than 1/3 of
-	// the supply
-	nonVotersMultiplier math.LegacyDec
+	// targetMultipliers holds the multipliers of the normalization targets of
+	// params, for instance the non_voters multiplier ensures that non-voters
+	// don't hold more than 1/3 of the supply.
+	targetMultipliers map[string]math.LegacyDec
 	// $ATOM distribution
 	atom distrib
 	// $ATONE distribution
 	atone distrib
-	// Amount of $ATOM slashed for the ICF
-	icfSlash math.LegacyDec
+	// Concentration of the $ATOM holdings of the accounts and of the $ATONE
+	// airdrop amounts
+	atomConcentration  concentration
+	atoneConcentration concentration
+	// Amount of $ATOM slashed by the rules
+	slashed math.LegacyDec
+	// Amounts of the accounts labeled in the rules labels, by category
+	categories map[labelCategory]*categoryAmounts
 	// Amount minted for CP
 	communityPool math.LegacyDec
 	// Amount minted for reserved address
@@ -52,14 +46,10 @@ type airdrop struct {
 }
 
 type addrAmtDetail struct {
-	Address      string    `json:"address"`
-	YesDetail    amtDetail `json:"yesDetail"`
-	NoDetail     amtDetail `json:"noDetail"`
-	NWVDetail    amtDetail `json:"nwvDetail"`
-	AbsDetail    amtDetail `json:"absDetail"`
-	DnvDetail    amtDetail `json:"dnvDetail"`
-	LiquidDetail amtDetail `json:"liquidDetail"`
-	Total        math.LegacyDec   `json:"total"`
+	Address string `json:"address"`
+	// Buckets holds the detail of each bucket of the distribution params.
+	Buckets []amtDetail    `json:"buckets"`
+	Total   math.LegacyDec `json:"total"`
 }
 
 type amtDetail struct {
@@ -73,210 +63,227 @@ type amtDetail struct {
 type distrib struct {
 	// total supply of the distrib
 	supply math.LegacyDec
-	// votes holds the part of the distrib per vote.
-	votes voteMap
-	// unstaked is part of the distrib for unstaked amounts.
-	unstaked math.LegacyDec
+	// buckets holds the part of the distrib per bucket, in the order of the
+	// distribution params buckets.
+	buckets []math.LegacyDec
 }
 
 type distriParams struct {
-	yesVotesMultiplier math.LegacyDec
-	noVotesMultiplier  math.LegacyDec
-	bonus              math.LegacyDec
-	malus              math.LegacyDec
-	supplyFactor       math.LegacyDec
-	supplyMintFactor   math.LegacyDec
+	buckets []bucket
+	// targets holds the share of the airdrop of the normalization targets of
+	// the buckets, by name.
+	targets          map[string]math.LegacyDec
+	supplyFactor     math.LegacyDec
+	supplyMintFactor math.LegacyDec
+	// communityPoolShare is the part of the minted supply that goes to the
+	// community pool, the rest goes to the reserved address.
+	communityPoolShare math.LegacyDec
+	// accountCap is the maximum airdrop of an account, no cap if nil.
+	accountCap math.Int
 }
 
+// String returns the multipliers of the fixed buckets of d.
 func (d distriParams) String() string {
-	return fmt.Sprintf("Yes x%.1f / No x%.1f",
-		d.yesVotesMultiplier.MustFloat64(), d.noVotesMultiplier.MustFloat64())
+	var parts []string
+	for _, b := range d.buckets {
+		if b.Target == "" {
+			parts = append(parts, fmt.Sprintf("%s x%.1f", b.Name, b.Multiplier.MustFloat64()))
+		}
+	}
+	return strings.Join(parts, " / ")
+}
+
+// withMultiplier returns a copy of d where the buckets named names have the
+// fixed multiplier m.
+func (d distriParams) withMultiplier(m math.LegacyDec, names ...string) (distriParams, error) {
+	d.buckets = slices.Clone(d.buckets)
+	for _, name := range names {
+		i := bucketIndex(d.buckets, name)
+		if i < 0 || d.buckets[i].Target != "" {
+			return d, fmt.Errorf("no bucket '%s' with a fixed multiplier", name)
+		}
+		d.buckets[i].Multiplier = m
+	}
+	return d, nil
 }
 
 func defaultDistriParams() distriParams {
 	return distriParams{
-		yesVotesMultiplier: math.LegacyOneDec(),                    // Y get x1
-		noVotesMultiplier:  math.LegacyNewDec(9),                   // N & NWV get x9
-		bonus:              math.LegacyNewDecWithPrec(103, 2),      // 3% bonus
-		malus:              math.LegacyNewDecWithPrec(97, 2),       // -3% malus
-		supplyFactor:       math.LegacyNewDecWithPrec(1, 1),        // Decrease final supply by a factor of 10
+		buckets: prop001Buckets(
+			math.LegacyOneDec(),               // Y get x1
+			math.LegacyNewDec(9),              // N & NWV get x9
+			math.LegacyNewDecWithPrec(103, 2), // 3% bonus
+			math.LegacyNewDecWithPrec(97, 2),  // -3% malus
+		),
+		targets: map[string]math.LegacyDec{
+			"non_voters": math.LegacyNewDecWithPrec(33, 2), // non-voters get at most 33% of the airdrop
+		},
+		supplyFactor:       math.LegacyNewDecWithPrec(1, 1),               // Decrease final supply by a factor of 10
 		supplyMintFactor:   math.LegacyOneDec().Quo(math.LegacyNewDec(9)), // 1/9 of the total supply is minted for the CP and a reserved address
+		communityPoolShare: math.LegacyNewDecWithPrec(5, 1),               // minted supply is split 50/50 between the CP and the reserved address
 	}
 }
 
-func (d distrib) votePercentages() map[govtypes.VoteOption]math.LegacyDec {
-	percs := make(map[govtypes.VoteOption]math.LegacyDec)
-	for k, v := range d.votes {
-		percs[k] = v.Quo(d.supply)
+func newDistrib(buckets int) distrib {
+	d := distrib{
+		supply:  math.LegacyZeroDec(),
+		buckets: make([]math.LegacyDec, buckets),
+	}
+	for i := range d.buckets {
+		d.buckets[i] = math.LegacyZeroDec()
+	}
+	return d
+}
+
+func (d distrib) bucketPercentages() []math.LegacyDec {
+	percs := make([]math.LegacyDec, len(d.buckets))
+	for i, v := range d.buckets {
+		percs[i] = v.Quo(d.supply)
 	}
 	return percs
 }
 
-func distribution(accounts []Account, params distriParams, prefix string) (airdrop, error) {
+// distribution computes the airdrop of accounts following params, and applies
+// rules: excluded accounts are ignored, slashed accounts are only counted in
+// the $ATOM distribution, and the airdrop of the other matched accounts is
+// capped or redirected.
+func distribution(accounts []Account, params distriParams, prefix string, rules *accountRules) (airdrop, error) {
 	airdrop := airdrop{
-		params:    params,
-		addresses: make(map[string]math.Int),
-		icfSlash:  math.LegacyZeroDec(),
-		atom: distrib{
-			supply:   math.LegacyZeroDec(),
-			votes:    newVoteMap(),
-			unstaked: math.LegacyZeroDec(),
-		},
-		atone: distrib{
-			supply:   math.LegacyZeroDec(),
-			votes:    newVoteMap(),
-			unstaked: math.LegacyZeroDec(),
-		},
+		params:     params,
+		addresses:  make(map[string]math.Int),
+		slashed:    math.LegacyZeroDec(),
+		categories: make(map[labelCategory]*categoryAmounts),
+		atom:       newDistrib(len(params.buckets)),
+		atone:      newDistrib(len(params.buckets)),
 	}
+	var atomAmounts []math.Int
 	for _, acc := range accounts {
-		var (
-			voteWeights = acc.voteWeights()
-
-			// Detail of vote distribution for $ATOM
-			yesAtomAmt        = voteWeights[govtypes.OptionYes].Mul(acc.StakedAmount)
-			noAtomAmt         = voteWeights[govtypes.OptionNo].Mul(acc.StakedAmount)
-			noWithVetoAtomAmt = voteWeights[govtypes.OptionNoWithVeto].Mul(acc.StakedAmount)
-			abstainAtomAmt    = voteWeights[govtypes.OptionAbstain].Mul(acc.StakedAmount)
-			noVoteAtomAmt     = voteWeights[govtypes.OptionEmpty].Mul(acc.StakedAmount)
-		)
-		// increment $ATOM votes
-		airdrop.atom.votes.add(govtypes.OptionYes, yesAtomAmt)
-		airdrop.atom.votes.add(govtypes.OptionNo, noAtomAmt)
-		airdrop.atom.votes.add(govtypes.OptionNoWithVeto, noWithVetoAtomAmt)
-		airdrop.atom.votes.add(govtypes.OptionAbstain, abstainAtomAmt)
-		airdrop.atom.votes.add(govtypes.OptionEmpty, noVoteAtomAmt)
+		if rules.excluded(acc.Address, acc.Type) {
+			continue
+		}
+		atomAmounts = append(atomAmounts, acc.StakedAmount.Add(acc.LiquidAmount).TruncateInt())
+		voteWeights := acc.voteWeights()
+		// increment $ATOM buckets
+		for i, b := range params.buckets {
+			airdrop.atom.buckets[i] = airdrop.atom.buckets[i].Add(b.Select.amount(acc, voteWeights))
+		}
 		// increment $ATOM supply
 		airdrop.atom.supply = airdrop.atom.supply.Add(acc.StakedAmount.Add(acc.LiquidAmount))
-		airdrop.atom.unstaked = airdrop.atom.unstaked.Add(acc.LiquidAmount)
 	}
 
-	// Compute nonVotersMultiplier to have non-voters <= 33%
-	var (
-		yesAtoneTotalAmt     = airdrop.atom.votes[govtypes.OptionYes].Mul(params.yesVotesMultiplier)
-		noAtoneTotalAmt      = airdrop.atom.votes[govtypes.OptionNo].Add(airdrop.atom.votes[govtypes.OptionNoWithVeto]).Mul(params.noVotesMultiplier)
-		noVotersAtomTotalAmt = airdrop.atom.votes[govtypes.OptionAbstain].Add(airdrop.atom.votes[govtypes.OptionEmpty]).Add(airdrop.atom.unstaked)
-		targetNonVotersPerc  = math.LegacyNewDecWithPrec(33, 2)
-	)
-	// Formula is:
-	// nonVotersMultiplier = (t x (yesAtone + noAtone)) / ((1 - t) x nonVoterAtom)
-	// where t is the targetNonVotersPerc
-	airdrop.nonVotersMultiplier = targetNonVotersPerc.Mul(yesAtoneTotalAmt.Add(noAtoneTotalAmt)).
-		Quo((math.LegacyOneDec().Sub(targetNonVotersPerc)).Mul(noVotersAtomTotalAmt))
+	// Compute the multipliers of the normalized buckets, for instance to have
+	// non-voters <= 33%
+	airdrop.targetMultipliers = solveTargetMultipliers(params.buckets, airdrop.atom.buckets, params.targets)
+	multipliers := make([]math.LegacyDec, len(params.buckets))
+	for i, b := range params.buckets {
+		multipliers[i] = b.Multiplier
+		if b.Target != "" {
+			multipliers[i] = airdrop.targetMultipliers[b.Target]
+		}
+	}
 
+	// indexes of addressesDetail by address
+	detailIndexes := make(map[string]int)
 	for _, acc := range accounts {
-		if slices.Contains(icfWallets, acc.Address) {
-			// Slash ICF
-			airdrop.icfSlash = airdrop.icfSlash.Add(acc.LiquidAmount).Add(acc.StakedAmount)
+		r := rules.match(acc.Address, acc.Type)
+		if r != nil && r.Action == actionExclude {
+			continue
+		}
+		if r != nil && r.Action == actionSlash {
+			slashed := acc.LiquidAmount.Add(acc.StakedAmount)
+			airdrop.slashed = airdrop.slashed.Add(slashed)
+			rules.record(acc.Address, acc.Type, r, slashed.String())
+			addCategoryAmounts(airdrop.categories, rules.labels, acc, math.LegacyZeroDec())
 			continue
 		}
 
+		// Apply the bucket multipliers and bonus/malus
 		var (
-			voteWeights       = acc.voteWeights()
-			yesAtomAmt        = voteWeights[govtypes.OptionYes].Mul(acc.StakedAmount)
-			noAtomAmt         = voteWeights[govtypes.OptionNo].Mul(acc.StakedAmount)
-			noWithVetoAtomAmt = voteWeights[govtypes.OptionNoWithVeto].Mul(acc.StakedAmount)
-			abstainAtomAmt    = voteWeights[govtypes.OptionAbstain].Mul(acc.StakedAmount)
-			noVoteAtomAmt     = voteWeights[govtypes.OptionEmpty].Mul(acc.StakedAmount)
-			// Apply airdrop multipliers:
-			// Yes:         x yesVotesMultiplier
-			// No:         	x noVotesMultiplier
-			// NoWithVeto: 	x noVotesMultiplier x bonus
-			// Abstain:    	x nonVotersMultiplier
-			// Didn't vote: x nonVotersMultiplier x malus
-			yesAirdropAmt        = yesAtomAmt.Mul(params.yesVotesMultiplier).Mul(params.supplyFactor)
-			noAirdropAmt         = noAtomAmt.Mul(params.noVotesMultiplier).Mul(params.supplyFactor)
-			noWithVetoAirdropAmt = noWithVetoAtomAmt.Mul(params.noVotesMultiplier).Mul(params.bonus).Mul(params.supplyFactor)
-			abstainAirdropAmt    = abstainAtomAmt.Mul(airdrop.nonVotersMultiplier).Mul(params.supplyFactor)
-			noVoteAirdropAmt     = noVoteAtomAmt.Mul(airdrop.nonVotersMultiplier).Mul(params.malus).Mul(params.supplyFactor)
-
-			// Liquid amount gets the same multiplier as those who didn't vote.
-			liquidMultiplier = airdrop.nonVotersMultiplier.Mul(params.malus)
-
-			// total airdrop for this account
-			liquidAirdropAmt = acc.LiquidAmount.Mul(liquidMultiplier).Mul(params.supplyFactor)
-			stakedAirdropAmt = yesAirdropAmt.Add(noAirdropAmt).Add(noWithVetoAirdropAmt).
-						Add(abstainAirdropAmt).Add(noVoteAirdropAmt)
-			airdropAmt = liquidAirdropAmt.Add(stakedAirdropAmt)
+			voteWeights = acc.voteWeights()
+			details     = make([]amtDetail, len(params.buckets))
+			airdropAmt  = math.LegacyZeroDec()
 		)
-		// increment airdrop votes
-		airdrop.atone.votes.add(govtypes.OptionYes, yesAirdropAmt)
-		airdrop.atone.votes.add(govtypes.OptionNo, noAirdropAmt)
-		airdrop.atone.votes.add(govtypes.OptionNoWithVeto, noWithVetoAirdropAmt)
-		airdrop.atone.votes.add(govtypes.OptionAbstain, abstainAirdropAmt)
-		airdrop.atone.votes.add(govtypes.OptionEmpty, noVoteAirdropAmt)
+		for i, b := range params.buckets {
+			atomAmt := b.Select.amount(acc, voteWeights)
+			details[i] = amtDetail{
+				AtomAmt:    atomAmt,
+				Multiplier: multipliers[i],
+				BonusMalus: b.BonusMalus,
+				Factor:     params.supplyFactor,
+				AtoneAmt:   atomAmt.Mul(multipliers[i]).Mul(b.BonusMalus).Mul(params.supplyFactor),
+			}
+			airdropAmt = airdropAmt.Add(details[i].AtoneAmt)
+		}
+		// Apply the lowest of the rule cap and the account cap
+		airdropCap := params.accountCap
+		if r != nil && r.Action == actionCap && (airdropCap.IsNil() || r.Cap.LT(airdropCap)) {
+			airdropCap = *r.Cap
+		}
+		if !airdropCap.IsNil() && airdropAmt.GT(airdropCap.ToLegacyDec()) {
+			// Scale down every part of the airdrop
+			ratio := airdropCap.ToLegacyDec().Quo(airdropAmt)
+			if r != nil && r.Action == actionCap {
+				rules.record(acc.Address, acc.Type, r, airdropAmt.Sub(airdropCap.ToLegacyDec()).String())
+			}
+			airdropAmt = math.LegacyZeroDec()
+			for i := range details {
+				details[i].AtoneAmt = details[i].AtoneAmt.Mul(ratio)
+				airdropAmt = airdropAmt.Add(details[i].AtoneAmt)
+			}
+		}
+		addCategoryAmounts(airdrop.categories, rules.labels, acc, airdropAmt)
+		// increment airdrop buckets
+		for i, d := range details {
+			airdrop.atone.buckets[i] = airdrop.atone.buckets[i].Add(d.AtoneAmt)
+		}
 		// increment airdrop supply
 		airdrop.atone.supply = airdrop.atone.supply.Add(airdropAmt)
-		airdrop.atone.unstaked = airdrop.atone.unstaked.Add(liquidAirdropAmt)
 		// add address and amount (skipping 0 balance)
 		if amtInt := airdropAmt.RoundInt(); !amtInt.IsZero() {
 			addr := acc.Address
+			if r != nil && r.Action == actionRedirect {
+				addr = r.RedirectTo
+				rules.record(acc.Address, acc.Type, r, airdropAmt.String())
+			}
 			if prefix != "" {
 				// Derive address from "cosmos" to prefix parameter
 				var err error
-				addr, err = convertBech32(acc.Address, "cosmos", prefix)
+				addr, err = convertBech32(addr, "cosmos", prefix)
 				if err != nil {
 					return airdrop, err
 				}
 			}
 			// Fill with "cosmos" prefixed address
-			airdrop.addresses[addr] = amtInt
-			ad := addrAmtDetail{
-				Address: addr,
-				YesDetail: amtDetail{
-					AtomAmt:    yesAtomAmt,
-					Multiplier: params.yesVotesMultiplier,
-					BonusMalus: math.LegacyOneDec(),
-					Factor:     params.supplyFactor,
-					AtoneAmt:   yesAirdropAmt,
-				},
-				NoDetail: amtDetail{
-					AtomAmt:    noAtomAmt,
-					Multiplier: params.noVotesMultiplier,
-					BonusMalus: math.LegacyOneDec(),
-					Factor:     params.supplyFactor,
-					AtoneAmt:   noAirdropAmt,
-				},
-				NWVDetail: amtDetail{
-					AtomAmt:    noWithVetoAtomAmt,
-					Multiplier: params.noVotesMultiplier,
-					BonusMalus: params.bonus,
-					Factor:     params.supplyFactor,
-					AtoneAmt:   noWithVetoAirdropAmt,
-				},
-				AbsDetail: amtDetail{
-					AtomAmt:    abstainAtomAmt,
-					Multiplier: airdrop.nonVotersMultiplier,
-					BonusMalus: math.LegacyOneDec(),
-					Factor:     params.supplyFactor,
-					AtoneAmt:   abstainAirdropAmt,
-				},
-				DnvDetail: amtDetail{
-					AtomAmt:    noVoteAtomAmt,
-					Multiplier: airdrop.nonVotersMultiplier,
-					BonusMalus: params.malus,
-					Factor:     params.supplyFactor,
-					AtoneAmt:   noVoteAirdropAmt,
-				},
-				LiquidDetail: amtDetail{
-					AtomAmt:    acc.LiquidAmount,
-					Multiplier: airdrop.nonVotersMultiplier,
-					BonusMalus: params.malus,
-					Factor:     params.supplyFactor,
-					AtoneAmt:   liquidAirdropAmt,
-				},
-				Total: airdropAmt,
+			if prev, ok := airdrop.addresses[addr]; ok {
+				// Redirected airdrop
+				amtInt = amtInt.Add(prev)
 			}
-			airdrop.addressesDetail = append(airdrop.addressesDetail, ad)
-			amt := yesAirdropAmt.Add(noAirdropAmt).Add(noWithVetoAirdropAmt).Add(abstainAirdropAmt).Add(noVoteAirdropAmt).Add(liquidAirdropAmt)
-			if !amt.Equal(airdropAmt) {
-				panic(fmt.Sprintf("WRONG %+v\n", ad))
+			airdrop.addresses[addr] = amtInt
+			if i, ok := detailIndexes[addr]; ok {
+				// Redirected airdrop, merge the details so there is one row
+				// per address
+				d := &airdrop.addressesDetail[i]
+				for j := range d.Buckets {
+					d.Buckets[j].AtomAmt = d.Buckets[j].AtomAmt.Add(details[j].AtomAmt)
+					d.Buckets[j].AtoneAmt = d.Buckets[j].AtoneAmt.Add(details[j].AtoneAmt)
+				}
+				d.Total = d.Total.Add(airdropAmt)
+				continue
 			}
+			detailIndexes[addr] = len(airdrop.addressesDetail)
+			airdrop.addressesDetail = append(airdrop.addressesDetail, addrAmtDetail{
+				Address: addr,
+				Buckets: details,
+				Total:   airdropAmt,
+			})
 		}
 	}
+	airdrop.atomConcentration = newConcentration(atomAmounts)
+	airdrop.atoneConcentration = newConcentration(slices.Collect(maps.Values(airdrop.addresses)))
 	// Compute minted part
 	minted := airdrop.atone.supply.Mul(params.supplyMintFactor)
-	airdrop.communityPool = minted.Quo(math.LegacyNewDec(2))
-	airdrop.reservedAddr = minted.Quo(math.LegacyNewDec(2))
+	airdrop.communityPool = minted.Mul(params.communityPoolShare)
+	airdrop.reservedAddr = minted.Sub(airdrop.communityPool)
 	return airdrop, nil
 }
 
@@ -321,11 +328,11 @@ func printAirdropsStats(chartMode bool, airdrops []airdrop) error {
 		page.PageTitle = "$ATONE distributions"
 		page.AddCharts(
 			newBarChart(airdrops),
-			newPieChart("$ATOM distribution", airdrops[0].atom),
+			newPieChart("$ATOM distribution", airdrops[0].params.buckets, airdrops[0].atom),
 		)
 		for _, airdrop := range airdrops {
 			page.AddCharts(
-				newPieChart(fmt.Sprintf("$ATONE distribution %s", airdrop.params), airdrop.atone),
+				newPieChart(fmt.Sprintf("$ATONE distribution %s", airdrop.params), airdrop.params.buckets, airdrop.atone),
 			)
 		}
 		page.Render(f)
@@ -334,47 +341,63 @@ func printAirdropsStats(chartMode bool, airdrops []airdrop) error {
 		return nil
 	}
 
-	printDistrib := func(d distrib) {
-		table := newMarkdownTable("", "TOTAL", "DID NOT VOTE", "YES", "NO", "NOWITHVETO", "ABSTAIN", "NOT STAKED")
-		table.Append([]string{
-			"Distributed",
-			humand(d.supply),
-			humand(d.votes[govtypes.OptionEmpty]),
-			humand(d.votes[govtypes.OptionYes]),
-			humand(d.votes[govtypes.OptionNo]),
-			humand(d.votes[govtypes.OptionNoWithVeto]),
-			humand(d.votes[govtypes.OptionAbstain]),
-			humand(d.unstaked),
-		})
-		votePercs := d.votePercentages()
-		table.Append([]string{
-			"Percentage over total",
-			"",
-			humanPercentI(votePercs[govtypes.OptionEmpty]),
-			humanPercentI(votePercs[govtypes.OptionYes]),
-			humanPercentI(votePercs[govtypes.OptionNo]),
-			humanPercentI(votePercs[govtypes.OptionNoWithVeto]),
-			humanPercentI(votePercs[govtypes.OptionAbstain]),
-			humanPercentI(d.unstaked.Quo(d.supply)),
-		})
+	printDistrib := func(buckets []bucket, d distrib) {
+		header := []string{"", "TOTAL"}
+		for _, b := range buckets {
+			header = append(header, strings.ToUpper(b.Name))
+		}
+		table := newMarkdownTable(header...)
+		distributed := []string{"Distributed", humand(d.supply)}
+		percentages := []string{"Percentage over total", ""}
+		for i, perc := range d.bucketPercentages() {
+			distributed = append(distributed, humand(d.buckets[i]))
+			percentages = append(percentages, humanPercentI(perc))
+		}
+		table.Append(distributed)
+		table.Append(percentages)
 		table.Render()
 		fmt.Println()
 	}
 	fmt.Println("$ATOM distribution")
-	printDistrib(airdrops[0].atom)
+	printDistrib(airdrops[0].params.buckets, airdrops[0].atom)
 	for _, airdrop := range airdrops {
-		fmt.Printf("$ATONE distribution (params: %s) (ratio: x%.3f, nonVotersMultiplier: %.3f, icfSlash: %s $ATOM)\n",
+		var multipliers []string
+		for _, name := range slices.Sorted(maps.Keys(airdrop.targetMultipliers)) {
+			multipliers = append(multipliers, fmt.Sprintf("%s multiplier: %.3f", name, airdrop.targetMultipliers[name].MustFloat64()))
+		}
+		fmt.Printf("$ATONE distribution (params: %s) (ratio: x%.3f, %s, slashed: %s $ATOM)\n",
 			airdrop.params,
 			airdrop.atone.supply.Quo(airdrop.atom.supply).MustFloat64(),
-			airdrop.nonVotersMultiplier.MustFloat64(),
-			humand(airdrop.icfSlash),
+			strings.Join(multipliers, ", "),
+			humand(airdrop.slashed),
 		)
-		printDistrib(airdrop.atone)
+		printDistrib(airdrop.params.buckets, airdrop.atone)
 		fmt.Printf(
 			"ATONE TOTAL SUPPLY = DISTRIBUTED(%s) + COMMUNITY_POOL(%s) + RESERVED_ADDRESS(%s) = %s\n",
 			humand(airdrop.atone.supply), humand(airdrop.communityPool), humand(airdrop.reservedAddr),
 			humand(airdrop.atone.supply.Add(airdrop.communityPool).Add(airdrop.reservedAddr)),
 		)
+		fmt.Println()
+		fmt.Println("Concentration")
+		printConcentrations(airdrop.atomConcentration, airdrop.atoneConcentration)
+		if len(airdrop.categories) > 0 {
+			fmt.Println()
+			fmt.Println("Labeled accounts by category")
+			table := newMarkdownTable("Category", "Accounts", "$ATOM", "$ATOM %", "$ATONE", "$ATONE %")
+			for _, c := range slices.Sorted(maps.Keys(airdrop.categories)) {
+				a := airdrop.categories[c]
+				table.Append([]string{
+					string(c),
+					fmt.Sprint(a.Accounts),
+					humand(a.atom()),
+					humanPercent(a.atom().Quo(airdrop.atom.supply)),
+					humand(a.Atone),
+					humanPercent(a.Atone.Quo(airdrop.atone.supply)),
+				})
+			}
+			table.Render()
+			fmt.Println()
+		}
 	}
 	return nil
 }
@@ -382,7 +405,7 @@ func printAirdropsStats(chartMode bool, airdrops []airdrop) error {
 func newBarChart(airdrops []airdrop) *charts.Bar {
 	bar := charts.NewBar()
 	bar.SetGlobalOptions(
-		charts.WithTitleOpts(opts.Title{Title: "Votes distribution"}),
+		charts.WithTitleOpts(opts.Title{Title: "Buckets distribution"}),
 		charts.WithLegendOpts(opts.Legend{Show: true, Right: "right", Orient: "vertical"}),
 		charts.WithTooltipOpts(opts.Tooltip{
 			Show:      true,
@@ -390,36 +413,22 @@ func newBarChart(airdrops []airdrop) *charts.Bar {
 		}),
 	)
 
-	bar.SetXAxis([]string{"Yes", "No", "NWV", "Abstain", "DNV", "Unstaked"})
+	buckets := airdrops[0].params.buckets
+	names := make([]string, len(buckets))
+	for i, b := range buckets {
+		names[i] = b.Name
+	}
+	bar.SetXAxis(names)
 	generateData := func(d distrib) []opts.BarData {
 		var (
-			votePercs  = d.votePercentages()
-			data       = make([]opts.BarData, 6)
+			data       = make([]opts.BarData, len(buckets))
 			oneHundred = math.LegacyNewDec(100)
 		)
-		data[0] = opts.BarData{
-			Name:  "Yes",
-			Value: votePercs[govtypes.OptionYes].Mul(oneHundred).MustFloat64(),
-		}
-		data[1] = opts.BarData{
-			Name:  "No",
-			Value: votePercs[govtypes.OptionNo].Mul(oneHundred).MustFloat64(),
-		}
-		data[2] = opts.BarData{
-			Name:  "NWV",
-			Value: votePercs[govtypes.OptionNoWithVeto].Mul(oneHundred).MustFloat64(),
-		}
-		data[3] = opts.BarData{
-			Name:  "Abstain",
-			Value: votePercs[govtypes.OptionAbstain].Mul(oneHundred).MustFloat64(),
-		}
-		data[4] = opts.BarData{
-			Name:  "DNV",
-			Value: votePercs[govtypes.OptionEmpty].Mul(oneHundred).MustFloat64(),
-		}
-		data[5] = opts.BarData{
-			Name:  "Unstaked",
-			Value: d.unstaked.Quo(d.supply).Mul(oneHundred).MustFloat64(),
+		for i, perc := range d.bucketPercentages() {
+			data[i] = opts.BarData{
+				Name:  names[i],
+				Value: perc.Mul(oneHundred).MustFloat64(),
+			}
 		}
 		return data
 	}
@@ -430,7 +439,9 @@ func newBarChart(airdrops []airdrop) *charts.Bar {
 	return bar
 }
 
-func newPieChart(title string, d distrib) *charts.Pie {
+// newPieChart returns a pie chart of d, with the buckets in the outer ring,
+// and the buckets grouped by normalization target in the inner ring.
+func newPieChart(title string, buckets []bucket, d distrib) *charts.Pie {
 	pie := charts.NewPie()
 	pie.SetGlobalOptions(
 		charts.WithTitleOpts(opts.Title{
@@ -445,55 +456,23 @@ func newPieChart(title string, d distrib) *charts.Pie {
 		}),
 	)
 	var (
-		data       = make([]opts.PieData, 6)
-		dataSum    = make([]opts.PieData, 3)
-		votePercs  = d.votePercentages()
+		data       = make([]opts.PieData, len(buckets))
+		dataSum    []opts.PieData
 		oneHundred = math.LegacyNewDec(100)
 	)
-	data[0] = opts.PieData{
-		Name:      "Yes",
-		ItemStyle: &opts.ItemStyle{Color: "#ff8b87"},
-		Value:     votePercs[govtypes.OptionYes].Mul(oneHundred).MustFloat64(),
-	}
-	dataSum[0] = opts.PieData{
-		Name:      "Yes",
-		ItemStyle: &opts.ItemStyle{Color: "#ff8b87"},
-		Value:     data[0].Value,
-	}
-	data[1] = opts.PieData{
-		Name:      "No",
-		ItemStyle: &opts.ItemStyle{Color: "#9FDFBF"},
-		Value:     votePercs[govtypes.OptionNo].Mul(oneHundred).MustFloat64(),
-	}
-	data[2] = opts.PieData{
-		Name:      "NWV",
-		ItemStyle: &opts.ItemStyle{Color: "#88d8b0"},
-		Value:     votePercs[govtypes.OptionNoWithVeto].Mul(oneHundred).MustFloat64(),
-	}
-	dataSum[1] = opts.PieData{
-		Name:      "No+NWV",
-		ItemStyle: &opts.ItemStyle{Color: "#6cac8c"},
-		Value:     data[1].Value.(float64) + data[2].Value.(float64),
-	}
-	data[3] = opts.PieData{
-		Name:      "Abstain",
-		ItemStyle: &opts.ItemStyle{Color: "#eac086"},
-		Value:     votePercs[govtypes.OptionAbstain].Mul(oneHundred).MustFloat64(),
-	}
-	data[4] = opts.PieData{
-		Name:      "DNV",
-		ItemStyle: &opts.ItemStyle{Color: "#ffcd94"},
-		Value:     votePercs[govtypes.OptionEmpty].Mul(oneHundred).MustFloat64(),
-	}
-	data[5] = opts.PieData{
-		Name:      "Unstaked",
-		ItemStyle: &opts.ItemStyle{Color: "#ffe0bd"},
-		Value:     d.unstaked.Quo(d.supply).Mul(oneHundred).MustFloat64(),
-	}
-	dataSum[2] = opts.PieData{
-		Name:      "Non voters",
-		ItemStyle: &opts.ItemStyle{Color: "#ffad60"},
-		Value:     data[3].Value.(float64) + data[4].Value.(float64) + data[5].Value.(float64),
+	for i, perc := range d.bucketPercentages() {
+		value := perc.Mul(oneHundred).MustFloat64()
+		data[i] = opts.PieData{Name: buckets[i].Name, Value: value}
+		name := buckets[i].Name
+		if buckets[i].Target != "" {
+			name = buckets[i].Target
+		}
+		j := slices.IndexFunc(dataSum, func(p opts.PieData) bool { return p.Name == name })
+		if j < 0 {
+			dataSum = append(dataSum, opts.PieData{Name: name, Value: value})
+			continue
+		}
+		dataSum[j].Value = dataSum[j].Value.(float64) + value
 	}
 	pie.AddSeries("pie", data,
 		charts.WithLabelOpts(opts.Label{
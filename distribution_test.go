@@ -29,9 +29,18 @@ func TestDistribution(t *testing.T) {
 			Option: govtypes.OptionNoWithVeto,
 			Weight: math.LegacyNewDec(1),
 		}}
-		noVotesMultiplier = defaultDistriParams().noVotesMultiplier
-		bonus             = defaultDistriParams().bonus
-		malus             = defaultDistriParams().malus
+		buckets           = defaultDistriParams().buckets
+		noVotesMultiplier = buckets[bucketIndex(buckets, "no")].Multiplier
+		bonus             = buckets[bucketIndex(buckets, "nwv")].BonusMalus
+		malus             = buckets[bucketIndex(buckets, "dnv")].BonusMalus
+		// vote option of the expectedVotes to bucket name
+		voteBuckets = map[govtypes.VoteOption]string{
+			govtypes.OptionEmpty:      "dnv",
+			govtypes.OptionYes:        "yes",
+			govtypes.OptionAbstain:    "abs",
+			govtypes.OptionNo:         "no",
+			govtypes.OptionNoWithVeto: "nwv",
+		}
 	)
 
 	tests := []struct {
@@ -361,10 +370,10 @@ func TestDistribution(t *testing.T) {
 			require := require.New(t)
 			assert := assert.New(t)
 
-			airdrop, err := distribution(tt.accounts, defaultDistriParams(), "")
+			airdrop, err := distribution(tt.accounts, defaultDistriParams(), "", defaultRules())
 
 			require.NoError(err)
-			expectedRes := tt.expectedAddresses(airdrop.nonVotersMultiplier)
+			expectedRes := tt.expectedAddresses(airdrop.targetMultipliers["non_voters"])
 			assert.Equal(len(expectedRes), len(airdrop.addresses), "unexpected number of res")
 			for k, v := range airdrop.addresses {
 				ev, ok := expectedRes[k]
@@ -373,9 +382,9 @@ func TestDistribution(t *testing.T) {
 				}
 			}
 			assert.Equal(tt.expectedTotal, airdrop.atone.supply.RoundInt64(), "unexpected airdrop.total")
-			assert.Equal(tt.expectedUnstaked, airdrop.atone.unstaked.RoundInt64(), "unexpected airdrop.unstaked")
+			assert.Equal(tt.expectedUnstaked, airdrop.atone.buckets[bucketIndex(buckets, "liquid")].RoundInt64(), "unexpected airdrop.unstaked")
 			for _, v := range allVoteOptions {
-				assert.Equal(tt.expectedVotes[v], airdrop.atone.votes[v].RoundInt64(), "unexpected airdrop.votes[%s]", v)
+				assert.Equal(tt.expectedVotes[v], airdrop.atone.buckets[bucketIndex(buckets, voteBuckets[v])].RoundInt64(), "unexpected airdrop.votes[%s]", v)
 			}
 		})
 	}
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	h "github.com/dustin/go-humanize"
+
+	"cosmossdk.io/math"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/types/bech32"
+)
+
+// extractSnapshot reads the pre-tally and tally exports and writes in datapath
+// the files required by the other commands, following the procedure described
+// in SNAPSHOT-EXTRACT.md:
+//   - votes.json from the pre-tally export.
+//   - block_votes.json from finalVotesFile if any, see copyBlockVotes.
+//   - prop.json, gov_params.json, active_validators.json, delegations.json,
+//     unbonding_delegations.json, redelegations.json,
+//     tokenize_share_records.json, balances.json and auth_genesis.json from
+//     the tally export.
+//   - manifest.json with the checksums of the files above.
+func extractSnapshot(preTallyFile, tallyFile, proposalID, finalVotesFile, datapath string) error {
+	if err := os.MkdirAll(datapath, 0o755); err != nil {
+		return err
+	}
+
+	// Votes are removed from the state during the tally, so they have to be
+	// fetched from the pre-tally export.
+	var votes []json.RawMessage
+	preTallyHeight, err := streamAppState(preTallyFile, map[string]func(*json.Decoder) error{
+		"gov": func(dec *json.Decoder) error {
+			var gov struct {
+				Votes []json.RawMessage `json:"votes"`
+			}
+			if err := dec.Decode(&gov); err != nil {
+				return err
+			}
+			for _, v := range gov.Votes {
+				var vote struct {
+					ProposalID string `json:"proposal_id"`
+				}
+				if err := json.Unmarshal(v, &vote); err != nil {
+					return err
+				}
+				if vote.ProposalID == proposalID {
+					votes = append(votes, v)
+				}
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeJSONArray(filepath.Join(datapath, "votes.json"), votes); err != nil {
+		return err
+	}
+	fmt.Printf("%s votes\n", h.Comma(int64(len(votes))))
+	if finalVotesFile != "" {
+		if err := copyBlockVotes(finalVotesFile, filepath.Join(datapath, "block_votes.json"), preTallyHeight); err != nil {
+			return err
+		}
+	}
+
+	// Everything else comes from the tally export.
+	var (
+		prop json.RawMessage
+		// The LSM records are in the staking module of the Cosmos Hub before
+		// v20, and in the liquid module after.
+		tokenizeShareRecords []json.RawMessage
+	)
+	height, err := streamAppState(tallyFile, map[string]func(*json.Decoder) error{
+		"liquid": func(dec *json.Decoder) error {
+			var liquid struct {
+				TokenizeShareRecords []json.RawMessage `json:"tokenize_share_records"`
+			}
+			if err := dec.Decode(&liquid); err != nil {
+				return err
+			}
+			tokenizeShareRecords = liquid.TokenizeShareRecords
+			return nil
+		},
+		"auth": func(dec *json.Decoder) error {
+			var auth json.RawMessage
+			if err := dec.Decode(&auth); err != nil {
+				return err
+			}
+			return writeJSON(filepath.Join(datapath, "auth_genesis.json"), auth)
+		},
+		"bank": func(dec *json.Decoder) error {
+			var bank struct {
+				Balances []json.RawMessage `json:"balances"`
+			}
+			if err := dec.Decode(&bank); err != nil {
+				return err
+			}
+			fmt.Printf("%s account balances\n", h.Comma(int64(len(bank.Balances))))
+			return writeJSONArray(filepath.Join(datapath, "balances.json"), bank.Balances)
+		},
+		"gov": func(dec *json.Decoder) error {
+			var gov struct {
+				Proposals []json.RawMessage `json:"proposals"`
+				govParamsGenesis
+			}
+			if err := dec.Decode(&gov); err != nil {
+				return err
+			}
+			bz, err := json.Marshal(gov.govParamsGenesis)
+			if err != nil {
+				return err
+			}
+			if err := writeJSON(filepath.Join(datapath, "gov_params.json"), bz); err != nil {
+				return err
+			}
+			for _, p := range gov.Proposals {
+				// gov v1beta1 uses proposal_id while gov v1 uses id
+				var id struct {
+					ProposalID string `json:"proposal_id"`
+					ID         string `json:"id"`
+				}
+				if err := json.Unmarshal(p, &id); err != nil {
+					return err
+				}
+				if id.ProposalID == proposalID || id.ID == proposalID {
+					prop = p
+					break
+				}
+			}
+			return nil
+		},
+		"staking": func(dec *json.Decoder) error {
+			var staking struct {
+				Params struct {
+					MaxValidators int `json:"max_validators"`
+				} `json:"params"`
+				Validators           []json.RawMessage `json:"validators"`
+				Delegations          []json.RawMessage `json:"delegations"`
+				UnbondingDelegations []json.RawMessage `json:"unbonding_delegations"`
+				Redelegations        []json.RawMessage `json:"redelegations"`
+				TokenizeShareRecords []json.RawMessage `json:"tokenize_share_records"`
+			}
+			if err := dec.Decode(&staking); err != nil {
+				return err
+			}
+			vals, err := activeValidators(staking.Validators, staking.Params.MaxValidators)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%d active validators (max_validators=%d)\n", len(vals), staking.Params.MaxValidators)
+			if err := writeJSONArray(filepath.Join(datapath, "active_validators.json"), vals); err != nil {
+				return err
+			}
+			fmt.Printf("%s delegations\n", h.Comma(int64(len(staking.Delegations))))
+			if err := writeJSONArray(filepath.Join(datapath, "delegations.json"), staking.Delegations); err != nil {
+				return err
+			}
+			if staking.TokenizeShareRecords != nil {
+				tokenizeShareRecords = staking.TokenizeShareRecords
+			}
+			fmt.Printf("%s unbonding delegations, %s redelegations\n", h.Comma(int64(len(staking.UnbondingDelegations))),
+				h.Comma(int64(len(staking.Redelegations))))
+			if err := writeJSONArray(filepath.Join(datapath, "unbonding_delegations.json"), staking.UnbondingDelegations); err != nil {
+				return err
+			}
+			return writeJSONArray(filepath.Join(datapath, "redelegations.json"), staking.Redelegations)
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if prop == nil {
+		return fmt.Errorf("proposal %s not found in %s", proposalID, tallyFile)
+	}
+	if err := writeJSON(filepath.Join(datapath, "prop.json"), prop); err != nil {
+		return err
+	}
+	fmt.Printf("%s tokenize share records\n", h.Comma(int64(len(tokenizeShareRecords))))
+	if err := writeJSONArray(filepath.Join(datapath, "tokenize_share_records.json"), tokenizeShareRecords); err != nil {
+		return err
+	}
+	m, err := createManifest(datapath, height, proposalID)
+	if err != nil {
+		return err
+	}
+	if err := m.write(datapath); err != nil {
+		return err
+	}
+	fmt.Printf("Snapshot of proposal %s extracted in %s\n", proposalID, datapath)
+	return nil
+}
+
+// activeValidators returns the active set from validators, like
+// staking.Keeper.IterateBondedValidatorsByPower() does: bonded validators
+// sorted by consensus power (descending) then by operator address bytes
+// (ascending), and limited to maxValidators.
+func activeValidators(validators []json.RawMessage, maxValidators int) ([]json.RawMessage, error) {
+	type bondedVal struct {
+		raw     json.RawMessage
+		power   int64
+		valAddr []byte
+	}
+	var bonded []bondedVal
+	for _, v := range validators {
+		var val struct {
+			OperatorAddress string `json:"operator_address"`
+			Status          string `json:"status"`
+			Tokens          string `json:"tokens"`
+		}
+		if err := json.Unmarshal(v, &val); err != nil {
+			return nil, err
+		}
+		if val.Status != "BOND_STATUS_BONDED" {
+			continue
+		}
+		tokens, ok := math.NewIntFromString(val.Tokens)
+		if !ok {
+			return nil, fmt.Errorf("invalid validator tokens '%s'", val.Tokens)
+		}
+		_, valAddr, err := bech32.DecodeAndConvert(val.OperatorAddress)
+		if err != nil {
+			return nil, fmt.Errorf("invalid validator operator address '%s': %w", val.OperatorAddress, err)
+		}
+		bonded = append(bonded, bondedVal{
+			raw:     v,
+			power:   sdk.TokensToConsensusPower(tokens, sdk.DefaultPowerReduction),
+			valAddr: valAddr,
+		})
+	}
+	slices.SortFunc(bonded, func(a, b bondedVal) int {
+		return cmp.Or(cmp.Compare(b.power, a.power), bytes.Compare(a.valAddr, b.valAddr))
+	})
+	if len(bonded) > maxValidators {
+		bonded = bonded[:maxValidators]
+	}
+	active := make([]json.RawMessage, len(bonded))
+	for i, v := range bonded {
+		active[i] = v.raw
+	}
+	return active, nil
+}
+
+// copyBlockVotes copies the block votes of src into dst, once ensured they are
+// valid. Votes are resolved later by height and tx index when the snapshot is
+// loaded, so duplicates don't have to be removed.
+// src holds either block votes (see blockVote) or plain votes, the format of
+// the final votes files written before block_votes.json existed. Plain votes
+// are given the height following exportHeight, the height of the export
+// holding votes.json, and their position in src as tx index, so they override
+// the votes of the export and the last vote of a voter wins.
+func copyBlockVotes(src, dst string, exportHeight int64) error {
+	bz, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	var raws []json.RawMessage
+	if err := json.Unmarshal(bz, &raws); err != nil {
+		return fmt.Errorf("cannot json decode block votes from file %s: %w", src, err)
+	}
+	items := make([]json.RawMessage, len(raws))
+	for i, raw := range raws {
+		var bv blockVote
+		if err := json.Unmarshal(raw, &bv); err != nil {
+			return fmt.Errorf("cannot json decode block votes from file %s: %w", src, err)
+		}
+		if bv.Vote == nil {
+			// Plain vote
+			bv = blockVote{Height: exportHeight + 1, TxIndex: i, Vote: raw}
+		}
+		if _, err := bv.decode(); err != nil {
+			return fmt.Errorf("%s: %w", src, err)
+		}
+		if items[i], err = json.Marshal(bv); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("%d block votes\n", len(items))
+	return writeJSONArray(dst, items)
+}
+
+// streamAppState decodes the export file at path and calls the handler
+// registered for each module found in "app_state", with the decoder positioned
+// at the start of the module genesis. Modules without handler are skipped, so
+// only the requested modules are held in memory.
+// The height of the exported state is returned, derived from the
+// "initial_height" field of the export (0 if missing).
+func streamAppState(path string, handlers map[string]func(*json.Decoder) error) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(bufio.NewReader(f))
+	if err := expectDelim(dec, '{'); err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+	var (
+		foundAppState bool
+		height        int64
+	)
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", path, err)
+		}
+		switch key {
+		case "app_state":
+			if err := streamModules(dec, handlers); err != nil {
+				return 0, fmt.Errorf("%s: app_state: %w", path, err)
+			}
+			foundAppState = true
+		case "initial_height":
+			// The export is made at the last committed height, and the
+			// chain restarted from the export starts at the next height.
+			// json.Number accepts both numbers and strings (used by gaiad).
+			var initialHeight json.Number
+			if err := dec.Decode(&initialHeight); err != nil {
+				return 0, fmt.Errorf("%s: initial_height: %w", path, err)
+			}
+			h, err := initialHeight.Int64()
+			if err != nil {
+				return 0, fmt.Errorf("%s: initial_height: %w", path, err)
+			}
+			height = h - 1
+		default:
+			if err := skipValue(dec); err != nil {
+				return 0, fmt.Errorf("%s: %w", path, err)
+			}
+		}
+	}
+	if !foundAppState {
+		return 0, fmt.Errorf("%s: app_state not found", path)
+	}
+	return height, nil
+}
+
+// streamModules calls the handlers of the modules of the app_state object read
+// by dec.
+func streamModules(dec *json.Decoder, handlers map[string]func(*json.Decoder) error) error {
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		module, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		handler, ok := handlers[module.(string)]
+		if !ok {
+			if err := skipValue(dec); err != nil {
+				return fmt.Errorf("%s: %w", module, err)
+			}
+			continue
+		}
+		if err := handler(dec); err != nil {
+			return fmt.Errorf("%s: %w", module, err)
+		}
+	}
+	return expectDelim(dec, '}')
+}
+
+// expectDelim reads the next token of dec and ensures it is delim.
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := t.(json.Delim); !ok || d != delim {
+		return fmt.Errorf("expected '%s', got '%v'", delim, t)
+	}
+	return nil
+}
+
+// skipValue consumes the next value of dec.
+func skipValue(dec *json.Decoder) error {
+	var raw json.RawMessage
+	return dec.Decode(&raw)
+}
+
+// writeJSON writes the indented form of raw into the file at path.
+func writeJSON(path string, raw json.RawMessage) error {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, raw, "", "  "); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	buf.WriteString("\n")
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := buf.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("%s file created.\n", path)
+	return nil
+}
+
+// writeJSONArray writes items as an indented JSON array into the file at path.
+// Items are written one by one to avoid building the whole array in memory.
+func writeJSONArray(path string, items []json.RawMessage) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	var (
+		w   = bufio.NewWriter(f)
+		buf bytes.Buffer
+	)
+	w.WriteString("[")
+	for i, item := range items {
+		if i > 0 {
+			w.WriteString(",")
+		}
+		w.WriteString("\n  ")
+		buf.Reset()
+		if err := json.Indent(&buf, item, "  ", "  "); err != nil {
+			f.Close()
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		buf.WriteTo(w)
+	}
+	w.WriteString("\n]\n")
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("%s file created.\n", path)
+	return nil
+}
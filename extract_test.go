@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+)
+
+func TestExtractSnapshot(t *testing.T) {
+	var (
+		dir          = t.TempDir()
+		datapath     = filepath.Join(dir, "prop2")
+		preTallyFile = filepath.Join(dir, "export-1.json")
+		tallyFile    = filepath.Join(dir, "export-2.json")
+		finalVotes   = filepath.Join(dir, "final_votes.json")
+		valAddrs     = fixedValidatorAddrs(4)
+	)
+	writeFile := func(path, content string) {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	writeFile(preTallyFile, `{
+		"app_name": "gaiad",
+		"app_state": {
+			"bank": {"balances": []},
+			"gov": {
+				"votes": [
+					{"proposal_id": "1", "voter": "addr1", "option": "VOTE_OPTION_NO"},
+					{"proposal_id": "2", "voter": "addr1", "option": "VOTE_OPTION_YES"},
+					{"proposal_id": "2", "voter": "addr2", "option": "VOTE_OPTION_NO"}
+				]
+			}
+		},
+		"initial_height": "11"
+	}`)
+	writeFile(tallyFile, `{
+		"app_state": {
+			"auth": {"accounts": [{"@type": "/cosmos.auth.v1beta1.BaseAccount", "address": "addr1"}]},
+			"liquid": {"tokenize_share_records": [{"id": "1", "owner": "addr1", "module_account": "tokenizeshare_1", "validator": "val1"}]},
+			"bank": {"balances": [{"address": "addr1", "coins": [{"denom": "uatom", "amount": "1"}]}]},
+			"gov": {
+				"proposals": [
+					{"proposal_id": "1", "status": "PROPOSAL_STATUS_REJECTED"},
+					{"proposal_id": "2", "status": "PROPOSAL_STATUS_PASSED"}
+				],
+				"votes": [],
+				"tally_params": {"quorum": "0.4", "threshold": "0.5", "veto_threshold": "0.334"}
+			},
+			"staking": {
+				"params": {"max_validators": 2},
+				"validators": [
+					{"operator_address": "`+valAddrs[0]+`", "status": "BOND_STATUS_BONDED", "tokens": "100000000"},
+					{"operator_address": "`+valAddrs[1]+`", "status": "BOND_STATUS_UNBONDED", "tokens": "1000000000"},
+					{"operator_address": "`+valAddrs[2]+`", "status": "BOND_STATUS_BONDED", "tokens": "300000000"},
+					{"operator_address": "`+valAddrs[3]+`", "status": "BOND_STATUS_BONDED", "tokens": "50000000"}
+				],
+				"delegations": [
+					{"delegator_address": "addr1", "validator_address": "val1", "shares": "10"}
+				]
+			}
+		},
+		"initial_height": "12"
+	}`)
+	writeFile(finalVotes, `[
+		{"height": 12, "tx_index": 0, "vote": {"proposal_id": "2", "voter": "addr2", "option": "VOTE_OPTION_ABSTAIN"}},
+		{"height": 12, "tx_index": 1, "vote": {"proposal_id": "2", "voter": "addr3", "option": "VOTE_OPTION_YES"}}
+	]`)
+
+	err := extractSnapshot(preTallyFile, tallyFile, "2", finalVotes, datapath)
+
+	require.NoError(t, err)
+	readField := func(file, field string) []string {
+		bz, err := os.ReadFile(filepath.Join(datapath, file))
+		require.NoError(t, err)
+		var items []map[string]any
+		require.NoError(t, json.Unmarshal(bz, &items))
+		var values []string
+		for _, item := range items {
+			values = append(values, item[field].(string))
+		}
+		return values
+	}
+	assert.Equal(t, []string{"addr1", "addr2"}, readField("votes.json", "voter"))
+	assert.Equal(t, []string{"VOTE_OPTION_YES", "VOTE_OPTION_NO"}, readField("votes.json", "option"))
+	records, err := parseVoteRecords(context.Background(), datapath, false)
+	require.NoError(t, err)
+	votes, overrides := resolveVotes(records)
+	assert.Len(t, votes, 3)
+	if assert.Len(t, overrides, 1) {
+		assert.Equal(t, "addr2", overrides[0].New.Voter)
+		assert.EqualValues(t, 12, overrides[0].New.Height)
+	}
+	assert.Equal(t, []string{valAddrs[2], valAddrs[0]}, readField("active_validators.json", "operator_address"))
+	assert.Equal(t, []string{"addr1"}, readField("delegations.json", "delegator_address"))
+	assert.Equal(t, []string{"addr1"}, readField("balances.json", "address"))
+	assert.Equal(t, []string{"tokenizeshare_1"}, readField("tokenize_share_records.json", "module_account"))
+	bz, err := os.ReadFile(filepath.Join(datapath, "prop.json"))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"proposal_id": "2", "status": "PROPOSAL_STATUS_PASSED"}`, string(bz))
+	bz, err = os.ReadFile(filepath.Join(datapath, "gov_params.json"))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"tally_params": {"quorum": "0.4", "threshold": "0.5", "veto_threshold": "0.334"}}`, string(bz))
+	bz, err = os.ReadFile(filepath.Join(datapath, "auth_genesis.json"))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"accounts": [{"@type": "/cosmos.auth.v1beta1.BaseAccount", "address": "addr1"}]}`, string(bz))
+	m, err := readManifest(datapath)
+	require.NoError(t, err)
+	assert.Equal(t, "2", m.ProposalID)
+	assert.EqualValues(t, 11, m.Height)
+	assert.ElementsMatch(t, snapshotFiles, slices.Collect(maps.Keys(m.Files)))
+	require.NoError(t, verifyManifest(datapath, snapshotFiles...))
+}
+
+func TestCopyBlockVotesPlainVotes(t *testing.T) {
+	var (
+		dir = t.TempDir()
+		src = filepath.Join(dir, "final_votes.json")
+		dst = filepath.Join(dir, "block_votes.json")
+	)
+	require.NoError(t, os.WriteFile(src, []byte(`[
+		{"proposal_id": "2", "voter": "addr2", "option": "VOTE_OPTION_ABSTAIN"},
+		{"proposal_id": "2", "voter": "addr2", "option": "VOTE_OPTION_YES"},
+		{"height": 13, "tx_index": 4, "vote": {"proposal_id": "2", "voter": "addr3", "option": "VOTE_OPTION_NO"}}
+	]`), 0o644))
+
+	err := copyBlockVotes(src, dst, 11)
+
+	require.NoError(t, err)
+	bz, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	var blockVotes []blockVote
+	require.NoError(t, json.Unmarshal(bz, &blockVotes))
+	if assert.Len(t, blockVotes, 3) {
+		assert.EqualValues(t, 12, blockVotes[0].Height)
+		assert.Equal(t, 0, blockVotes[0].TxIndex)
+		assert.EqualValues(t, 12, blockVotes[1].Height)
+		assert.Equal(t, 1, blockVotes[1].TxIndex)
+		assert.EqualValues(t, 13, blockVotes[2].Height)
+		assert.Equal(t, 4, blockVotes[2].TxIndex)
+	}
+	// The plain votes override the votes of the export, the last one wins
+	records := []voteRecord{{Voter: "addr2", Source: "votes.json"}}
+	for _, bv := range blockVotes {
+		vote, err := bv.decode()
+		require.NoError(t, err)
+		records = append(records, voteRecord{Voter: vote.Voter, Options: vote.Options, Height: bv.Height, TxIndex: bv.TxIndex})
+	}
+	votes, _ := resolveVotes(records)
+	assert.Equal(t, blockVotes[1].Height, votes["addr2"].Height)
+	assert.Equal(t, 1, votes["addr2"].TxIndex)
+}
+
+func TestActiveValidators(t *testing.T) {
+	valAddrs := fixedValidatorAddrs(4)
+	validator := func(addr, status, tokens string) json.RawMessage {
+		return json.RawMessage(`{"operator_address": "` + addr + `", "status": "` + status + `", "tokens": "` + tokens + `"}`)
+	}
+	validators := []json.RawMessage{
+		// Same consensus power (2) as the others, tokens below the power
+		// reduction are ignored
+		validator(valAddrs[3], "BOND_STATUS_BONDED", "2900000"),
+		validator(valAddrs[2], "BOND_STATUS_BONDED", "2000000"),
+		validator(valAddrs[0], "BOND_STATUS_UNBONDED", "9000000"),
+		validator(valAddrs[1], "BOND_STATUS_BONDED", "2500000"),
+	}
+
+	active, err := activeValidators(validators, 2)
+
+	require.NoError(t, err)
+	// Ties are sorted by operator address bytes
+	assert.Equal(t, []json.RawMessage{validators[3], validators[1]}, active)
+
+	_, err = activeValidators([]json.RawMessage{validator("val1", "BOND_STATUS_BONDED", "1")}, 2)
+	require.ErrorContains(t, err, "invalid validator operator address 'val1'")
+}
+
+// fixedValidatorAddrs returns n validator addresses sorted by their bytes.
+func fixedValidatorAddrs(n int) []string {
+	addrs := make([]string, n)
+	for i := range addrs {
+		addrs[i] = sdk.ValAddress(bytes.Repeat([]byte{byte(i + 1)}, 20)).String()
+	}
+	return addrs
+}
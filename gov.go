@@ -0,0 +1,441 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	appparams "github.com/atomone-hub/atomone/app/params"
+
+	"cosmossdk.io/math"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types/v1beta1"
+)
+
+// govFormat is the format of the gov module of the snapshot, which determines
+// the tally rules.
+type govFormat int
+
+const (
+	// govV1beta1 is the cosmos-sdk x/gov v1beta1 format.
+	govV1beta1 govFormat = iota
+	// govV1 is the cosmos-sdk x/gov v1 format.
+	govV1
+	// govAtomOne is the AtomOne x/gov v1 format, without the NoWithVeto
+	// option and without vote inheritance from validators.
+	govAtomOne
+)
+
+func (f govFormat) String() string {
+	switch f {
+	case govV1beta1:
+		return "cosmos.gov.v1beta1"
+	case govV1:
+		return "cosmos.gov.v1"
+	case govAtomOne:
+		return "atomone.gov.v1"
+	}
+	return "unknown"
+}
+
+// hasVeto returns true if the NoWithVeto option exists in format f.
+func (f govFormat) hasVeto() bool {
+	return f != govAtomOne
+}
+
+// tallyMode returns the tally mode of format f: the delegators inherit the
+// votes of their validators, except in AtomOne.
+func (f govFormat) tallyMode() tallyMode {
+	if f == govAtomOne {
+		return modeNoInheritance
+	}
+	return modeInheritance
+}
+
+// govProposal is a proposal read from prop.json, in a form common to all
+// formats.
+type govProposal struct {
+	ID     uint64
+	Format govFormat
+	Status string
+	// Messages holds the type URLs of the messages of the proposal (or of the
+	// content for v1beta1).
+	Messages         []string
+	FinalTallyResult map[govtypes.VoteOption]math.Int
+	VotingEndTime    time.Time
+}
+
+// parseProposal reads the prop.json file of the snapshot directory path and
+// detects its format:
+//   - v1beta1 proposals have a proposal_id field, v1 proposals an id field.
+//   - AtomOne v1 proposals have a message of an AtomOne module (like
+//     /atomone.gov.v1.MsgExecLegacyContent), Cosmos v1 proposals a message of
+//     the Cosmos gov module (like /cosmos.gov.v1.MsgExecLegacyContent). If the
+//     messages are of neither (like text proposals without messages), AtomOne
+//     v1 proposals are told by their tally result, which has no NoWithVeto
+//     count.
+func parseProposal(path string) (govProposal, error) {
+	file := filepath.Join(path, "prop.json")
+	bz, err := os.ReadFile(file)
+	if err != nil {
+		return govProposal{}, err
+	}
+	return decodeProposal(bz, file)
+}
+
+// decodeProposal decodes the JSON proposal bz, read from file.
+func decodeProposal(bz []byte, file string) (govProposal, error) {
+	var p struct {
+		ProposalID string `json:"proposal_id"`
+		ID         string `json:"id"`
+		Status     string `json:"status"`
+		Content    *struct {
+			Type string `json:"@type"`
+		} `json:"content"`
+		Messages []struct {
+			Type string `json:"@type"`
+		} `json:"messages"`
+		FinalTallyResult map[string]string `json:"final_tally_result"`
+		VotingEndTime    time.Time         `json:"voting_end_time"`
+	}
+	if err := json.Unmarshal(bz, &p); err != nil {
+		return govProposal{}, fmt.Errorf("cannot json decode proposal from file %s: %w", file, err)
+	}
+	prop := govProposal{
+		Status:           p.Status,
+		VotingEndTime:    p.VotingEndTime,
+		FinalTallyResult: make(map[govtypes.VoteOption]math.Int),
+	}
+	id := p.ProposalID
+	switch {
+	case p.ID != "":
+		id = p.ID
+		for _, m := range p.Messages {
+			prop.Messages = append(prop.Messages, m.Type)
+		}
+		var ok bool
+		if prop.Format, ok = messagesFormat(prop.Messages); !ok {
+			prop.Format = govAtomOne
+			if _, ok := p.FinalTallyResult["no_with_veto_count"]; ok {
+				prop.Format = govV1
+			}
+		}
+	case p.ProposalID != "":
+		prop.Format = govV1beta1
+		if p.Content != nil {
+			prop.Messages = []string{p.Content.Type}
+		}
+	default:
+		return govProposal{}, fmt.Errorf("%s: missing proposal id", file)
+	}
+	var err error
+	if prop.ID, err = strconv.ParseUint(id, 10, 64); err != nil {
+		return govProposal{}, fmt.Errorf("%s: invalid proposal id: %w", file, err)
+	}
+	for key, value := range p.FinalTallyResult {
+		// v1beta1 keys are yes, no... while v1 keys are yes_count, no_count...
+		name := "VOTE_OPTION_" + strings.ToUpper(strings.TrimSuffix(key, "_count"))
+		option, ok := govtypes.VoteOption_value[name]
+		if !ok {
+			return govProposal{}, fmt.Errorf("%s: unknown final_tally_result field '%s'", file, key)
+		}
+		amount, ok := math.NewIntFromString(value)
+		if !ok {
+			return govProposal{}, fmt.Errorf("%s: invalid final_tally_result %s '%s'", file, key, value)
+		}
+		prop.FinalTallyResult[govtypes.VoteOption(option)] = amount
+	}
+	return prop, nil
+}
+
+// messagesFormat returns the format of a v1 proposal from the type URLs of its
+// messages, ok is false if none of them tells the format.
+func messagesFormat(msgs []string) (format govFormat, ok bool) {
+	for _, msg := range msgs {
+		switch {
+		case strings.HasPrefix(msg, "/atomone."):
+			return govAtomOne, true
+		case strings.HasPrefix(msg, "/cosmos.gov."):
+			return govV1, true
+		}
+	}
+	return 0, false
+}
+
+// govParamsGenesis is the part of the gov genesis required to evaluate the
+// outcome of a tally, written in the gov_params.json file of a snapshot.
+type govParamsGenesis struct {
+	// Params is used by gov v1 (null in v1beta1).
+	Params *govParamsJSON `json:"params,omitempty"`
+	// TallyParams is used by gov v1beta1 (deprecated in v1).
+	TallyParams *govParamsJSON `json:"tally_params,omitempty"`
+	// The participation EMAs are used by the AtomOne dynamic quorums.
+	ParticipationEMA                      string `json:"participation_ema,omitempty"`
+	ConstitutionAmendmentParticipationEMA string `json:"constitution_amendment_participation_ema,omitempty"`
+	LawParticipationEMA                   string `json:"law_participation_ema,omitempty"`
+}
+
+type govParamsJSON struct {
+	Quorum                           string           `json:"quorum,omitempty"`
+	Threshold                        string           `json:"threshold,omitempty"`
+	VetoThreshold                    string           `json:"veto_threshold,omitempty"`
+	ConstitutionAmendmentQuorum      string           `json:"constitution_amendment_quorum,omitempty"`
+	ConstitutionAmendmentThreshold   string           `json:"constitution_amendment_threshold,omitempty"`
+	LawQuorum                        string           `json:"law_quorum,omitempty"`
+	LawThreshold                     string           `json:"law_threshold,omitempty"`
+	QuorumRange                      *quorumRangeJSON `json:"quorum_range,omitempty"`
+	ConstitutionAmendmentQuorumRange *quorumRangeJSON `json:"constitution_amendment_quorum_range,omitempty"`
+	LawQuorumRange                   *quorumRangeJSON `json:"law_quorum_range,omitempty"`
+}
+
+type quorumRangeJSON struct {
+	Min string `json:"min"`
+	Max string `json:"max"`
+}
+
+// proposalKind is the kind of a proposal, which determines its quorum and
+// threshold in AtomOne.
+type proposalKind int
+
+const (
+	kindDefault proposalKind = iota
+	kindLaw
+	kindConstitutionAmendment
+)
+
+func (k proposalKind) String() string {
+	switch k {
+	case kindLaw:
+		return "law"
+	case kindConstitutionAmendment:
+		return "constitution amendment"
+	}
+	return "default"
+}
+
+// govParams holds the gov params used to evaluate the outcome of a tally.
+// Quorums and thresholds are indexed by proposalKind, only AtomOne defines
+// other kinds than kindDefault.
+type govParams struct {
+	Quorums       map[proposalKind]math.LegacyDec
+	Thresholds    map[proposalKind]math.LegacyDec
+	VetoThreshold math.LegacyDec
+}
+
+// kind returns the kind of prop. Constitution amendments take precedence over
+// laws, like in the AtomOne tally.
+func (p govParams) kind(prop govProposal) proposalKind {
+	kind := kindDefault
+	for _, msg := range prop.Messages {
+		switch {
+		case strings.HasSuffix(msg, ".MsgProposeConstitutionAmendment"):
+			kind = kindConstitutionAmendment
+		case strings.HasSuffix(msg, ".MsgProposeLaw"):
+			kind = max(kind, kindLaw)
+		}
+	}
+	if _, ok := p.Quorums[kind]; !ok {
+		// Not an AtomOne proposal
+		return kindDefault
+	}
+	return kind
+}
+
+// loadGovParams returns the gov params of the snapshot directory path, once
+// their checksum has been verified against the manifest. ok is false if the
+// snapshot has no gov_params.json file, neither on disk nor in the manifest.
+func loadGovParams(path string) (params govParams, ok bool, err error) {
+	m, err := readManifest(path)
+	if err != nil {
+		return govParams{}, false, err
+	}
+	_, listed := m.Files["gov_params.json"]
+	if _, err := os.Stat(filepath.Join(path, "gov_params.json")); !listed && errors.Is(err, fs.ErrNotExist) {
+		fmt.Println("gov_params.json not found, the outcome of the proposal can't be evaluated")
+		return govParams{}, false, nil
+	}
+	if err := verifyManifest(path, "gov_params.json"); err != nil {
+		return govParams{}, false, err
+	}
+	params, err = parseGovParams(path)
+	if err != nil {
+		return govParams{}, false, err
+	}
+	return params, true, nil
+}
+
+// parseGovParams reads the gov_params.json file of the snapshot directory
+// path. The quorums of AtomOne are dynamic if quorum ranges are defined: they
+// move between the min and max of the range following the participation EMA.
+func parseGovParams(path string) (govParams, error) {
+	file := filepath.Join(path, "gov_params.json")
+	bz, err := os.ReadFile(file)
+	if err != nil {
+		return govParams{}, err
+	}
+	var g govParamsGenesis
+	if err := json.Unmarshal(bz, &g); err != nil {
+		return govParams{}, fmt.Errorf("cannot json decode gov params from file %s: %w", file, err)
+	}
+	return g.govParams(file)
+}
+
+// govParams returns the gov params of g, read from file.
+func (g govParamsGenesis) govParams(file string) (govParams, error) {
+	params := g.Params
+	if params == nil {
+		params = g.TallyParams
+	}
+	if params == nil {
+		return govParams{}, fmt.Errorf("%s: missing params and tally_params", file)
+	}
+	var (
+		p = govParams{
+			Quorums:       make(map[proposalKind]math.LegacyDec),
+			Thresholds:    make(map[proposalKind]math.LegacyDec),
+			VetoThreshold: math.LegacyZeroDec(),
+		}
+		errs []error
+	)
+	parseDec := func(name, s string) math.LegacyDec {
+		d, err := math.LegacyNewDecFromStr(s)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: invalid %s '%s': %w", file, name, s, err))
+		}
+		return d
+	}
+	parseQuorum := func(name, quorum string, r *quorumRangeJSON, ema string) math.LegacyDec {
+		if r == nil {
+			return parseDec(name, quorum)
+		}
+		var (
+			minQuorum = parseDec(name+"_range.min", r.Min)
+			maxQuorum = parseDec(name+"_range.max", r.Max)
+			emaDec    = parseDec(name+" participation_ema", ema)
+		)
+		if len(errs) > 0 {
+			return math.LegacyZeroDec()
+		}
+		return minQuorum.Add(maxQuorum.Sub(minQuorum).Mul(emaDec))
+	}
+	p.Quorums[kindDefault] = parseQuorum("quorum", params.Quorum, params.QuorumRange, g.ParticipationEMA)
+	p.Thresholds[kindDefault] = parseDec("threshold", params.Threshold)
+	if params.VetoThreshold != "" {
+		p.VetoThreshold = parseDec("veto_threshold", params.VetoThreshold)
+	}
+	if params.LawThreshold != "" {
+		p.Quorums[kindLaw] = parseQuorum("law_quorum", params.LawQuorum, params.LawQuorumRange, g.LawParticipationEMA)
+		p.Thresholds[kindLaw] = parseDec("law_threshold", params.LawThreshold)
+	}
+	if params.ConstitutionAmendmentThreshold != "" {
+		p.Quorums[kindConstitutionAmendment] = parseQuorum("constitution_amendment_quorum",
+			params.ConstitutionAmendmentQuorum, params.ConstitutionAmendmentQuorumRange,
+			g.ConstitutionAmendmentParticipationEMA)
+		p.Thresholds[kindConstitutionAmendment] = parseDec("constitution_amendment_threshold",
+			params.ConstitutionAmendmentThreshold)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return govParams{}, err
+	}
+	return p, nil
+}
+
+// voteJSON is the JSON form of a vote, common to all gov formats.
+type voteJSON struct {
+	ProposalID string `json:"proposal_id"`
+	Voter      string `json:"voter"`
+	// Option is only used when Options is empty, in old v1beta1 exports.
+	Option  string           `json:"option,omitempty"`
+	Options []voteOptionJSON `json:"options"`
+}
+
+type voteOptionJSON struct {
+	Option string `json:"option"`
+	Weight string `json:"weight"`
+}
+
+// newVoteJSON returns the JSON form of vote.
+func newVoteJSON(vote govtypes.Vote) voteJSON {
+	v := voteJSON{
+		ProposalID: strconv.FormatUint(vote.ProposalId, 10),
+		Voter:      vote.Voter,
+	}
+	for _, o := range vote.Options {
+		v.Options = append(v.Options, voteOptionJSON{Option: o.Option.String(), Weight: o.Weight.String()})
+	}
+	return v
+}
+
+// toVote converts v into a v1beta1 vote. Vote options of all formats share the
+// same names and values.
+func (v voteJSON) toVote() (govtypes.Vote, error) {
+	parseOption := func(name string) (govtypes.VoteOption, error) {
+		o, ok := govtypes.VoteOption_value[name]
+		if !ok {
+			return 0, fmt.Errorf("vote of %s: unknown option '%s'", v.Voter, name)
+		}
+		return govtypes.VoteOption(o), nil
+	}
+	id, err := strconv.ParseUint(v.ProposalID, 10, 64)
+	if err != nil {
+		return govtypes.Vote{}, fmt.Errorf("vote of %s: invalid proposal_id: %w", v.Voter, err)
+	}
+	vote := govtypes.Vote{ProposalId: id, Voter: v.Voter}
+	if len(v.Options) == 0 {
+		opt, err := parseOption(v.Option)
+		if err != nil {
+			return govtypes.Vote{}, err
+		}
+		vote.Options = govtypes.NewNonSplitVoteOption(opt)
+		return vote, nil
+	}
+	for _, o := range v.Options {
+		opt, err := parseOption(o.Option)
+		if err != nil {
+			return govtypes.Vote{}, err
+		}
+		weight, err := math.LegacyNewDecFromStr(o.Weight)
+		if err != nil {
+			return govtypes.Vote{}, fmt.Errorf("vote of %s: invalid weight: %w", v.Voter, err)
+		}
+		vote.Options = append(vote.Options, govtypes.WeightedVoteOption{Option: opt, Weight: weight})
+	}
+	return vote, nil
+}
+
+// voteDecodeNext decodes the next vote of dec, in any gov format.
+func voteDecodeNext(dec *json.Decoder, v *govtypes.Vote) error {
+	var vj voteJSON
+	if err := dec.Decode(&vj); err != nil {
+		return err
+	}
+	vote, err := vj.toVote()
+	if err != nil {
+		return err
+	}
+	*v = vote
+	return nil
+}
+
+var atomOneBech32Prefixes sync.Once
+
+// setAtomOneBech32Prefixes configures the sdk to use the AtomOne bech32
+// prefixes. The sdk config is sealed once set, so only the first call has an
+// effect.
+func setAtomOneBech32Prefixes() {
+	atomOneBech32Prefixes.Do(func() {
+		cfg := sdk.GetConfig()
+		cfg.SetBech32PrefixForAccount(appparams.Bech32PrefixAccAddr, appparams.Bech32PrefixAccPub)
+		cfg.SetBech32PrefixForValidator(appparams.Bech32PrefixValAddr, appparams.Bech32PrefixValPub)
+		cfg.SetBech32PrefixForConsensusNode(appparams.Bech32PrefixConsAddr, appparams.Bech32PrefixConsPub)
+		cfg.Seal()
+	})
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cosmossdk.io/math"
+
+	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types/v1beta1"
+)
+
+func TestParseProposal(t *testing.T) {
+	tests := []struct {
+		name          string
+		prop          string
+		expectedProp  govProposal
+		expectedError string
+	}{
+		{
+			name: "v1beta1",
+			prop: `{
+				"proposal_id": "848",
+				"content": {"@type": "/cosmos.gov.v1beta1.TextProposal", "title": "t"},
+				"status": "PROPOSAL_STATUS_REJECTED",
+				"final_tally_result": {"yes": "10", "abstain": "1", "no": "2", "no_with_veto": "3"}
+			}`,
+			expectedProp: govProposal{
+				ID:       848,
+				Format:   govV1beta1,
+				Status:   "PROPOSAL_STATUS_REJECTED",
+				Messages: []string{"/cosmos.gov.v1beta1.TextProposal"},
+				FinalTallyResult: map[govtypes.VoteOption]math.Int{
+					govtypes.OptionYes:        math.NewInt(10),
+					govtypes.OptionAbstain:    math.NewInt(1),
+					govtypes.OptionNo:         math.NewInt(2),
+					govtypes.OptionNoWithVeto: math.NewInt(3),
+				},
+			},
+		},
+		{
+			name: "cosmos v1",
+			prop: `{
+				"id": "900",
+				"messages": [{"@type": "/cosmos.gov.v1.MsgExecLegacyContent"}],
+				"status": "PROPOSAL_STATUS_PASSED",
+				"final_tally_result": {"yes_count": "10", "abstain_count": "1", "no_count": "2", "no_with_veto_count": "3"}
+			}`,
+			expectedProp: govProposal{
+				ID:       900,
+				Format:   govV1,
+				Status:   "PROPOSAL_STATUS_PASSED",
+				Messages: []string{"/cosmos.gov.v1.MsgExecLegacyContent"},
+				FinalTallyResult: map[govtypes.VoteOption]math.Int{
+					govtypes.OptionYes:        math.NewInt(10),
+					govtypes.OptionAbstain:    math.NewInt(1),
+					govtypes.OptionNo:         math.NewInt(2),
+					govtypes.OptionNoWithVeto: math.NewInt(3),
+				},
+			},
+		},
+		{
+			name: "atomone v1",
+			prop: `{
+				"id": "12",
+				"messages": [
+					{"@type": "/atomone.gov.v1.MsgProposeLaw"},
+					{"@type": "/cosmos.bank.v1beta1.MsgSend"}
+				],
+				"status": "PROPOSAL_STATUS_PASSED",
+				"final_tally_result": {"yes_count": "10", "abstain_count": "1", "no_count": "2"},
+				"voting_end_time": "2025-01-02T03:04:05Z"
+			}`,
+			expectedProp: govProposal{
+				ID:       12,
+				Format:   govAtomOne,
+				Status:   "PROPOSAL_STATUS_PASSED",
+				Messages: []string{"/atomone.gov.v1.MsgProposeLaw", "/cosmos.bank.v1beta1.MsgSend"},
+				FinalTallyResult: map[govtypes.VoteOption]math.Int{
+					govtypes.OptionYes:     math.NewInt(10),
+					govtypes.OptionAbstain: math.NewInt(1),
+					govtypes.OptionNo:      math.NewInt(2),
+				},
+			},
+		},
+		{
+			name: "cosmos v1 with a partial tally",
+			prop: `{
+				"id": "901",
+				"messages": [{"@type": "/cosmos.gov.v1.MsgExecLegacyContent"}],
+				"status": "PROPOSAL_STATUS_VOTING_PERIOD",
+				"final_tally_result": {"yes_count": "5"}
+			}`,
+			expectedProp: govProposal{
+				ID:               901,
+				Format:           govV1,
+				Status:           "PROPOSAL_STATUS_VOTING_PERIOD",
+				Messages:         []string{"/cosmos.gov.v1.MsgExecLegacyContent"},
+				FinalTallyResult: map[govtypes.VoteOption]math.Int{govtypes.OptionYes: math.NewInt(5)},
+			},
+		},
+		{
+			name: "atomone v1 with a no_with_veto count",
+			prop: `{
+				"id": "13",
+				"messages": [{"@type": "/atomone.gov.v1.MsgExecLegacyContent"}],
+				"status": "PROPOSAL_STATUS_PASSED",
+				"final_tally_result": {"yes_count": "10", "no_count": "2", "no_with_veto_count": "3"},
+				"voting_end_time": "2025-01-02T03:04:05Z"
+			}`,
+			expectedProp: govProposal{
+				ID:       13,
+				Format:   govAtomOne,
+				Status:   "PROPOSAL_STATUS_PASSED",
+				Messages: []string{"/atomone.gov.v1.MsgExecLegacyContent"},
+				FinalTallyResult: map[govtypes.VoteOption]math.Int{
+					govtypes.OptionYes:        math.NewInt(10),
+					govtypes.OptionNo:         math.NewInt(2),
+					govtypes.OptionNoWithVeto: math.NewInt(3),
+				},
+			},
+		},
+		{
+			name:          "missing id",
+			prop:          `{"status": "PROPOSAL_STATUS_PASSED"}`,
+			expectedError: "missing proposal id",
+		},
+		{
+			name:          "unknown tally field",
+			prop:          `{"id": "1", "final_tally_result": {"maybe_count": "1"}}`,
+			expectedError: "unknown final_tally_result field 'maybe_count'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			datapath := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(datapath, "prop.json"), []byte(tt.prop), 0o644))
+
+			prop, err := parseProposal(datapath)
+
+			if tt.expectedError != "" {
+				require.ErrorContains(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			if tt.expectedProp.Format == govAtomOne {
+				assert.Equal(t, "2025-01-02T03:04:05Z", prop.VotingEndTime.UTC().Format("2006-01-02T15:04:05Z"))
+				prop.VotingEndTime = tt.expectedProp.VotingEndTime
+			}
+			assert.Equal(t, tt.expectedProp, prop)
+		})
+	}
+}
+
+func TestVoteDecodeNext(t *testing.T) {
+	var (
+		yes = govtypes.NewNonSplitVoteOption(govtypes.OptionYes)
+		no  = govtypes.NewNonSplitVoteOption(govtypes.OptionNo)
+	)
+	tests := []struct {
+		name          string
+		vote          string
+		expectedVote  govtypes.Vote
+		expectedError string
+	}{
+		{
+			name: "v1beta1 with options",
+			vote: `{"proposal_id": "1", "voter": "addr1", "option": "VOTE_OPTION_UNSPECIFIED",
+				"options": [{"option": "VOTE_OPTION_YES", "weight": "1.000000000000000000"}]}`,
+			expectedVote: govtypes.Vote{ProposalId: 1, Voter: "addr1", Options: yes},
+		},
+		{
+			name:         "v1beta1 without options",
+			vote:         `{"proposal_id": "1", "voter": "addr1", "option": "VOTE_OPTION_NO"}`,
+			expectedVote: govtypes.Vote{ProposalId: 1, Voter: "addr1", Options: no},
+		},
+		{
+			name: "atomone v1",
+			vote: `{"proposal_id": "2", "voter": "atone1", "metadata": "",
+				"options": [
+					{"option": "VOTE_OPTION_YES", "weight": "0.300000000000000000"},
+					{"option": "VOTE_OPTION_NO", "weight": "0.700000000000000000"}
+				]}`,
+			expectedVote: govtypes.Vote{ProposalId: 2, Voter: "atone1", Options: govtypes.WeightedVoteOptions{
+				{Option: govtypes.OptionYes, Weight: math.LegacyNewDecWithPrec(3, 1)},
+				{Option: govtypes.OptionNo, Weight: math.LegacyNewDecWithPrec(7, 1)},
+			}},
+		},
+		{
+			name:          "unknown option",
+			vote:          `{"proposal_id": "1", "voter": "addr1", "option": "VOTE_OPTION_MAYBE"}`,
+			expectedError: "unknown option 'VOTE_OPTION_MAYBE'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var vote govtypes.Vote
+
+			err := voteDecodeNext(newJSONDecoder(tt.vote), &vote)
+
+			if tt.expectedError != "" {
+				require.ErrorContains(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedVote, vote)
+			// Ensure the JSON form of the vote can be decoded back
+			bz, err := json.Marshal(newVoteJSON(vote))
+			require.NoError(t, err)
+			var vote2 govtypes.Vote
+			require.NoError(t, voteDecodeNext(newJSONDecoder(string(bz)), &vote2))
+			assert.Equal(t, vote, vote2)
+		})
+	}
+}
+
+func newJSONDecoder(s string) *json.Decoder {
+	return json.NewDecoder(strings.NewReader(s))
+}
+
+func TestParseGovParams(t *testing.T) {
+	dec := math.LegacyMustNewDecFromStr
+	tests := []struct {
+		name           string
+		params         string
+		expectedParams govParams
+		expectedError  string
+	}{
+		{
+			name:   "v1beta1",
+			params: `{"tally_params": {"quorum": "0.4", "threshold": "0.5", "veto_threshold": "0.334"}}`,
+			expectedParams: govParams{
+				Quorums:       map[proposalKind]math.LegacyDec{kindDefault: dec("0.4")},
+				Thresholds:    map[proposalKind]math.LegacyDec{kindDefault: dec("0.5")},
+				VetoThreshold: dec("0.334"),
+			},
+		},
+		{
+			name: "v1",
+			params: `{
+				"params": {"quorum": "0.4", "threshold": "0.5", "veto_threshold": "0.334"},
+				"tally_params": null
+			}`,
+			expectedParams: govParams{
+				Quorums:       map[proposalKind]math.LegacyDec{kindDefault: dec("0.4")},
+				Thresholds:    map[proposalKind]math.LegacyDec{kindDefault: dec("0.5")},
+				VetoThreshold: dec("0.334"),
+			},
+		},
+		{
+			name: "atomone",
+			params: `{"params": {
+				"quorum": "0.25", "threshold": "0.667",
+				"constitution_amendment_quorum": "0.35", "constitution_amendment_threshold": "0.9",
+				"law_quorum": "0.3", "law_threshold": "0.9"
+			}}`,
+			expectedParams: govParams{
+				Quorums: map[proposalKind]math.LegacyDec{
+					kindDefault:               dec("0.25"),
+					kindLaw:                   dec("0.3"),
+					kindConstitutionAmendment: dec("0.35"),
+				},
+				Thresholds: map[proposalKind]math.LegacyDec{
+					kindDefault:               dec("0.667"),
+					kindLaw:                   dec("0.9"),
+					kindConstitutionAmendment: dec("0.9"),
+				},
+				VetoThreshold: math.LegacyZeroDec(),
+			},
+		},
+		{
+			name: "atomone dynamic quorums",
+			params: `{
+				"params": {
+					"threshold": "0.667",
+					"constitution_amendment_threshold": "0.9",
+					"law_threshold": "0.9",
+					"quorum_range": {"min": "0.1", "max": "0.5"},
+					"constitution_amendment_quorum_range": {"min": "0.2", "max": "0.6"},
+					"law_quorum_range": {"min": "0.2", "max": "0.4"}
+				},
+				"participation_ema": "0.5",
+				"constitution_amendment_participation_ema": "0.25",
+				"law_participation_ema": "1"
+			}`,
+			expectedParams: govParams{
+				Quorums: map[proposalKind]math.LegacyDec{
+					kindDefault:               dec("0.3"),
+					kindLaw:                   dec("0.4"),
+					kindConstitutionAmendment: dec("0.3"),
+				},
+				Thresholds: map[proposalKind]math.LegacyDec{
+					kindDefault:               dec("0.667"),
+					kindLaw:                   dec("0.9"),
+					kindConstitutionAmendment: dec("0.9"),
+				},
+				VetoThreshold: math.LegacyZeroDec(),
+			},
+		},
+		{
+			name:          "missing params",
+			params:        `{"params": null}`,
+			expectedError: "missing params and tally_params",
+		},
+		{
+			name:          "invalid quorum",
+			params:        `{"params": {"quorum": "x", "threshold": "0.5"}}`,
+			expectedError: "invalid quorum 'x'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			datapath := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(datapath, "gov_params.json"), []byte(tt.params), 0o644))
+
+			params, err := parseGovParams(datapath)
+
+			if tt.expectedError != "" {
+				require.ErrorContains(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedParams, params)
+		})
+	}
+}
+
+func TestLoadGovParams(t *testing.T) {
+	datapath := t.TempDir()
+	file := filepath.Join(datapath, "gov_params.json")
+	require.NoError(t, os.WriteFile(filepath.Join(datapath, "votes.json"), []byte(`[]`), 0o644))
+	m, err := createManifest(datapath, 42, "1")
+	require.NoError(t, err)
+	require.NoError(t, m.write(datapath))
+
+	_, ok, err := loadGovParams(datapath)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, os.WriteFile(file, []byte(`{"tally_params": {"quorum": "0.4", "threshold": "0.5", "veto_threshold": "0.334"}}`), 0o644))
+	m, err = createManifest(datapath, 42, "1")
+	require.NoError(t, err)
+	require.NoError(t, m.write(datapath))
+	_, ok, err = loadGovParams(datapath)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// The checksum is verified before the file is parsed
+	require.NoError(t, os.WriteFile(file, []byte(`not json`), 0o644))
+	_, _, err = loadGovParams(datapath)
+	require.ErrorContains(t, err, "checksum mismatch")
+
+	require.NoError(t, os.Remove(file))
+	_, _, err = loadGovParams(datapath)
+	require.ErrorContains(t, err, "gov_params.json is listed")
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"cosmossdk.io/math"
+)
+
+// labelCategory is the kind of entity owning a labeled address.
+type labelCategory string
+
+const (
+	categoryExchange   labelCategory = "exchange"
+	categoryCustodian  labelCategory = "custodian"
+	categoryFoundation labelCategory = "foundation"
+	// categoryValidator is the category of the validator operators.
+	categoryValidator labelCategory = "validator"
+	categoryBridge    labelCategory = "bridge"
+)
+
+var labelCategories = []labelCategory{
+	categoryExchange, categoryCustodian, categoryFoundation, categoryValidator, categoryBridge,
+}
+
+// addressLabel names the owner of an address.
+type addressLabel struct {
+	Address  string        `json:"address"`
+	Name     string        `json:"name"`
+	Category labelCategory `json:"category"`
+}
+
+// labelRegistry holds the address labels by address.
+type labelRegistry map[string]addressLabel
+
+// defaultLabels returns the labels used when no labels file is given.
+func defaultLabels() labelRegistry {
+	return newLabelRegistry([]addressLabel{
+		{"cosmos14lultfckehtszvzw4ehu0apvsr77afvyhgqhwh", "Dokia", categoryValidator},
+		{"cosmos1p3ucd3ptpw902fluyjzhq3ffgq4ntddac9sa3s", "Binance?", categoryExchange},
+		{"cosmos1nm0rrq86ucezaf8uj35pq9fpwr5r82cl8sc7p5", "Kraken", categoryExchange},
+		{"cosmos1zr7aswwzskhav7w57vwpaqsafuh5uj7nv8a964", "SG1?", categoryValidator},
+		{"cosmos1f70nsqtq0wcd0kymq79ca2p0k5napnm6yqc94x", "ChorusOne?", categoryValidator},
+		{"cosmos1wlh0f94r6c4y5nwsqlxd2384jmxlljstame50p", "CosmosStation?", categoryValidator},
+	})
+}
+
+func newLabelRegistry(labels []addressLabel) labelRegistry {
+	reg := make(labelRegistry, len(labels))
+	for _, l := range labels {
+		reg[l.Address] = l
+	}
+	return reg
+}
+
+// loadLabels reads the labels file at path, a JSON array of labels or a CSV
+// file with the address, name and category columns, depending on the file
+// extension. It returns the default labels if path is empty.
+func loadLabels(path string) (labelRegistry, error) {
+	if path == "" {
+		return defaultLabels(), nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var labels []addressLabel
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		err = json.NewDecoder(f).Decode(&labels)
+	case ".csv":
+		labels, err = readLabelsCSV(f)
+	default:
+		err = fmt.Errorf("unsupported labels file extension '%s', expected .json or .csv", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	reg := make(labelRegistry, len(labels))
+	for i, l := range labels {
+		if l.Address == "" {
+			return nil, fmt.Errorf("%s: label #%d: missing address", path, i+1)
+		}
+		if !slices.Contains(labelCategories, l.Category) {
+			return nil, fmt.Errorf("%s: label #%d: unknown category '%s'", path, i+1, l.Category)
+		}
+		if _, ok := reg[l.Address]; ok {
+			return nil, fmt.Errorf("%s: label #%d: duplicate address %s", path, i+1, l.Address)
+		}
+		reg[l.Address] = l
+	}
+	return reg, nil
+}
+
+// readLabelsCSV reads labels from a CSV file with a header line, the columns
+// can be in any order.
+func readLabelsCSV(r io.Reader) ([]addressLabel, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	cols := make(map[string]int)
+	for i, name := range header {
+		cols[strings.TrimSpace(name)] = i
+	}
+	for _, name := range []string{"address", "name", "category"} {
+		if _, ok := cols[name]; !ok {
+			return nil, fmt.Errorf("missing column '%s'", name)
+		}
+	}
+	var labels []addressLabel
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return labels, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		labels = append(labels, addressLabel{
+			Address:  strings.TrimSpace(rec[cols["address"]]),
+			Name:     strings.TrimSpace(rec[cols["name"]]),
+			Category: labelCategory(strings.TrimSpace(rec[cols["category"]])),
+		})
+	}
+}
+
+// categoryAmounts holds the amounts of the labeled accounts of a category.
+type categoryAmounts struct {
+	Accounts int
+	Liquid   math.LegacyDec
+	Staked   math.LegacyDec
+	// Atone is the airdrop of the accounts, zero outside of a distribution.
+	Atone math.LegacyDec
+}
+
+func (a categoryAmounts) atom() math.LegacyDec {
+	return a.Liquid.Add(a.Staked)
+}
+
+// addCategoryAmounts adds the amounts of acc and its airdrop atone into
+// amounts, if acc is labeled in labels.
+func addCategoryAmounts(amounts map[labelCategory]*categoryAmounts, labels labelRegistry, acc Account, atone math.LegacyDec) {
+	l, ok := labels[acc.Address]
+	if !ok {
+		return
+	}
+	a, ok := amounts[l.Category]
+	if !ok {
+		a = &categoryAmounts{
+			Liquid: math.LegacyZeroDec(),
+			Staked: math.LegacyZeroDec(),
+			Atone:  math.LegacyZeroDec(),
+		}
+		amounts[l.Category] = a
+	}
+	a.Accounts++
+	a.Liquid = a.Liquid.Add(acc.LiquidAmount)
+	a.Staked = a.Staked.Add(acc.StakedAmount)
+	a.Atone = a.Atone.Add(atone)
+}
+
+// printAccountsByCategory prints the amounts of the labeled accounts, grouped
+// by category.
+func printAccountsByCategory(accounts []Account, labels labelRegistry) {
+	var (
+		amounts = make(map[labelCategory]*categoryAmounts)
+		total   = math.LegacyZeroDec()
+	)
+	for _, acc := range accounts {
+		addCategoryAmounts(amounts, labels, acc, math.LegacyZeroDec())
+		total = total.Add(acc.LiquidAmount).Add(acc.StakedAmount)
+	}
+	if len(amounts) == 0 || !total.IsPositive() {
+		return
+	}
+	fmt.Println("Labeled accounts by category")
+	table := newMarkdownTable("Category", "Accounts", "Liquid $ATOM", "Staked $ATOM", "Supply %")
+	for _, c := range slices.Sorted(maps.Keys(amounts)) {
+		a := amounts[c]
+		table.Append([]string{
+			string(c),
+			fmt.Sprint(a.Accounts),
+			humand(a.Liquid),
+			humand(a.Staked),
+			humanPercent(a.atom().Quo(total)),
+		})
+	}
+	table.Render()
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cosmossdk.io/math"
+
+	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types/v1beta1"
+)
+
+func TestLoadLabels(t *testing.T) {
+	expectedLabels := labelRegistry{
+		"addr1": {Address: "addr1", Name: "Exchange 1", Category: categoryExchange},
+		"addr2": {Address: "addr2", Name: "", Category: categoryBridge},
+	}
+	tests := []struct {
+		name          string
+		file          string
+		content       string
+		expectedError string
+	}{
+		{
+			name: "json",
+			file: "labels.json",
+			content: `[
+				{"address": "addr1", "name": "Exchange 1", "category": "exchange"},
+				{"address": "addr2", "category": "bridge"}
+			]`,
+		},
+		{
+			name:    "csv",
+			file:    "labels.csv",
+			content: "category,address,name\nexchange,addr1,Exchange 1\n bridge , addr2,\n",
+		},
+		{
+			name:          "csv missing column",
+			file:          "labels.csv",
+			content:       "address,category\naddr1,exchange\n",
+			expectedError: "missing column 'name'",
+		},
+		{
+			name:          "unknown category",
+			file:          "labels.csv",
+			content:       "address,name,category\naddr1,Exchange 1,cex\n",
+			expectedError: "label #1: unknown category 'cex'",
+		},
+		{
+			name:          "missing address",
+			file:          "labels.json",
+			content:       `[{"name": "Exchange 1", "category": "exchange"}]`,
+			expectedError: "label #1: missing address",
+		},
+		{
+			name:          "duplicate address",
+			file:          "labels.csv",
+			content:       "address,name,category\naddr1,Exchange 1,exchange\naddr1,Exchange 2,exchange\n",
+			expectedError: "label #2: duplicate address addr1",
+		},
+		{
+			name:          "unknown extension",
+			file:          "labels.txt",
+			content:       "addr1",
+			expectedError: "unsupported labels file extension '.txt'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0o666))
+
+			labels, err := loadLabels(path)
+
+			if tt.expectedError != "" {
+				require.ErrorContains(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, expectedLabels, labels)
+		})
+	}
+}
+
+func TestDistributionCategories(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	accounts := []Account{
+		{Address: "custodian", LiquidAmount: math.LegacyNewDec(100), StakedAmount: math.LegacyZeroDec()},
+		{Address: "exchange1", LiquidAmount: math.LegacyNewDec(10), StakedAmount: math.LegacyZeroDec()},
+		{Address: "exchange2", LiquidAmount: math.LegacyNewDec(20), StakedAmount: math.LegacyZeroDec()},
+		{Address: "voter", LiquidAmount: math.LegacyZeroDec(), StakedAmount: math.LegacyNewDec(1000), Vote: govtypes.WeightedVoteOptions{{
+			Option: govtypes.OptionYes,
+			Weight: math.LegacyNewDec(1),
+		}}},
+	}
+	rules := &accountRules{
+		Rules: []rule{{
+			Categories: []labelCategory{categoryExchange},
+			Action:     actionSlash,
+			Reason:     "custodial exchange balances",
+		}},
+		labels: newLabelRegistry([]addressLabel{
+			{"custodian", "Custodian", categoryCustodian},
+			{"exchange1", "Exchange 1", categoryExchange},
+			{"exchange2", "Exchange 2", categoryExchange},
+		}),
+	}
+	require.NoError(rules.Rules[0].validate())
+
+	airdrop, err := distribution(accounts, defaultDistriParams(), "", rules)
+
+	require.NoError(err)
+	assert.Equal(math.LegacyNewDec(30), airdrop.slashed)
+	assert.NotContains(airdrop.addresses, "exchange1")
+	assert.NotContains(airdrop.addresses, "exchange2")
+	assert.Contains(airdrop.addresses, "custodian")
+	if assert.Len(airdrop.categories, 2) {
+		exchanges := airdrop.categories[categoryExchange]
+		assert.Equal(2, exchanges.Accounts)
+		assert.Equal(math.LegacyNewDec(30), exchanges.atom())
+		assert.True(exchanges.Atone.IsZero())
+		custodians := airdrop.categories[categoryCustodian]
+		assert.Equal(1, custodians.Accounts)
+		assert.Equal(math.LegacyNewDec(100), custodians.atom())
+		assert.Equal(airdrop.addresses["custodian"], custodians.Atone.RoundInt())
+	}
+	assert.Equal(actionSlash, rules.audit["exchange1"].Action)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"cosmossdk.io/math"
+
+	h "github.com/dustin/go-humanize"
+
+	authtypes "github.com/cosmos/cosmos-sdk/x/auth/types"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+)
+
+// tokenizeShareRecord is a record of the liquid staking module (LSM), which is
+// part of the staking module of the Cosmos Hub before v20, and of the liquid
+// module after. The delegation of the record is held by a dedicated module
+// account, and the delegator who tokenized it received share tokens in
+// exchange, which can be transferred.
+type tokenizeShareRecord struct {
+	ID            uint64 `json:"id,string"`
+	Owner         string `json:"owner"`
+	ModuleAccount string `json:"module_account"`
+	Validator     string `json:"validator"`
+}
+
+// moduleAddress returns the address of the module account holding the
+// delegation of r.
+func (r tokenizeShareRecord) moduleAddress() string {
+	return authtypes.NewModuleAddress(r.ModuleAccount).String()
+}
+
+// shareDenom returns the denom of the share tokens of r.
+func (r tokenizeShareRecord) shareDenom() string {
+	return strings.ToLower(r.Validator) + "/" + strconv.FormatUint(r.ID, 10)
+}
+
+// parseTokenizeShareRecords returns the tokenize share records of the snapshot
+// directory path, and the balances of their share tokens by denom and holder
+// address. Both are nil if the snapshot has no tokenize_share_records.json
+// file.
+func parseTokenizeShareRecords(ctx context.Context, path string, useCache bool) ([]tokenizeShareRecord, map[string]map[string]math.Int, error) {
+	filename := filepath.Join(path, "tokenize_share_records.json")
+	if _, err := os.Stat(filename); errors.Is(err, fs.ErrNotExist) {
+		fmt.Println("tokenize_share_records.json not found, tokenized shares are ignored")
+		return nil, nil, nil
+	}
+	var (
+		records         []tokenizeShareRecord
+		balancesByDenom = make(map[string]map[string]math.Int)
+	)
+	for r, err := range readRecords(ctx, filename, "", jsonDecodeNext[tokenizeShareRecord]) {
+		if err != nil {
+			return nil, nil, err
+		}
+		records = append(records, r)
+		balancesByDenom[r.shareDenom()] = make(map[string]math.Int)
+	}
+	if len(records) == 0 {
+		return records, balancesByDenom, nil
+	}
+	var numHolders int64
+	for b, err := range readCachedRecords(ctx, filepath.Join(path, "balances.json"), "", jsonDecodeNext[banktypes.Balance], useCache) {
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, c := range b.Coins {
+			if holders, ok := balancesByDenom[c.Denom]; ok {
+				holders[b.Address] = c.Amount
+				numHolders++
+			}
+		}
+	}
+	fmt.Printf("%s tokenize share records, %s share token balances\n", h.Comma(int64(len(records))), h.Comma(numHolders))
+	return records, balancesByDenom, nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cosmossdk.io/math"
+
+	authtypes "github.com/cosmos/cosmos-sdk/x/auth/types"
+	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types/v1beta1"
+	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
+)
+
+func TestParseTokenizeShareRecords(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		datapath = t.TempDir()
+		accAddrs = createAccountAddrs(2)
+		valAddr  = createValidatorAddrs(1)[0].String()
+	)
+	writeFile := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(datapath, name), []byte(content), 0o644))
+	}
+
+	records, balances, err := parseTokenizeShareRecords(ctx, datapath, false)
+
+	require.NoError(t, err)
+	assert.Nil(t, records, "tokenize_share_records.json is optional")
+	assert.Nil(t, balances)
+
+	writeFile("tokenize_share_records.json", `[
+		{"id": "3", "owner": "`+accAddrs[0].String()+`", "module_account": "tokenizeshare_3", "validator": "`+valAddr+`"}
+	]`)
+	writeFile("balances.json", `[
+		{"address": "`+accAddrs[0].String()+`", "coins": [{"denom": "`+valAddr+`/3", "amount": "6"}, {"denom": "uatom", "amount": "1"}]},
+		{"address": "`+accAddrs[1].String()+`", "coins": [{"denom": "`+valAddr+`/4", "amount": "5"}]}
+	]`)
+
+	records, balances, err = parseTokenizeShareRecords(ctx, datapath, false)
+
+	require.NoError(t, err)
+	expectedRecord := tokenizeShareRecord{
+		ID:            3,
+		Owner:         accAddrs[0].String(),
+		ModuleAccount: "tokenizeshare_3",
+		Validator:     valAddr,
+	}
+	assert.Equal(t, []tokenizeShareRecord{expectedRecord}, records)
+	assert.Equal(t, authtypes.NewModuleAddress("tokenizeshare_3").String(), records[0].moduleAddress())
+	assert.Equal(t, map[string]map[string]math.Int{
+		valAddr + "/3": {accAddrs[0].String(): math.NewInt(6)},
+	}, balances)
+}
+
+func TestGetAccountsTokenizedShares(t *testing.T) {
+	var (
+		accAddrs = createAccountAddrs(3)
+		accAddr1 = accAddrs[0].String()
+		accAddr2 = accAddrs[1].String()
+		icaAddr  = accAddrs[2].String()
+		valAddr  = createValidatorAddrs(1)[0]
+		voteYes  = govtypes.NewNonSplitVoteOption(govtypes.OptionYes)
+		records  = []tokenizeShareRecord{
+			{ID: 1, Owner: accAddr1, ModuleAccount: "tokenizeshare_1", Validator: valAddr.String()},
+			// No share token holder
+			{ID: 2, Owner: accAddr1, ModuleAccount: "tokenizeshare_2", Validator: valAddr.String()},
+		}
+		newDeleg = func(delAddr string, shares int64) []stakingtypes.Delegation {
+			return []stakingtypes.Delegation{{
+				DelegatorAddress: delAddr,
+				ValidatorAddress: valAddr.String(),
+				Shares:           math.LegacyNewDec(shares),
+			}}
+		}
+		snap = &Snapshot{
+			ValsByAddr: map[string]govtypes.ValidatorGovInfo{
+				valAddr.String(): govtypes.NewValidatorGovInfo(valAddr, math.NewInt(100),
+					math.LegacyNewDec(100), math.LegacyZeroDec(), voteYes),
+			},
+			DelegsByAddr: map[string][]stakingtypes.Delegation{
+				accAddr1:                   newDeleg(accAddr1, 40),
+				records[0].moduleAddress(): newDeleg(records[0].moduleAddress(), 30),
+				records[1].moduleAddress(): newDeleg(records[1].moduleAddress(), 20),
+			},
+			TokenizeShareRecords: records,
+			ShareBalancesByDenom: map[string]map[string]math.Int{
+				records[0].shareDenom(): {
+					accAddr1: math.NewInt(20),
+					accAddr2: math.NewInt(10),
+					// Liquid staking provider, ignored
+					icaAddr: math.NewInt(30),
+				},
+				records[1].shareDenom(): {},
+			},
+			AccountTypesByAddr: map[string]string{
+				icaAddr: "/ibc.applications.interchain_accounts.v1.InterchainAccount",
+			},
+		}
+	)
+
+	accounts, err := getAccounts(context.Background(), snap, accountsOptions{})
+	require.NoError(t, err)
+
+	byAddr := make(map[string]Account)
+	for _, acc := range accounts {
+		byAddr[acc.Address] = acc
+	}
+	require.Len(t, byAddr, 3)
+	assert.NotContains(t, byAddr, records[0].moduleAddress())
+	assert.NotContains(t, byAddr, icaAddr)
+	acc1 := byAddr[accAddr1]
+	assert.Equal(t, math.LegacyNewDec(50), acc1.StakedAmount)
+	assert.Len(t, acc1.Delegations, 2)
+	assert.Equal(t, []TokenizedShare{{RecordID: 1, ValidatorAddress: valAddr.String(), Amount: math.LegacyNewDec(10)}}, acc1.TokenizedShares)
+	acc2 := byAddr[accAddr2]
+	assert.Equal(t, math.LegacyNewDec(5), acc2.StakedAmount)
+	assert.Equal(t, voteYes, acc2.Delegations[0].Vote)
+	assert.Equal(t, []TokenizedShare{{RecordID: 1, ValidatorAddress: valAddr.String(), Amount: math.LegacyNewDec(5)}}, acc2.TokenizedShares)
+	// The module account of the record without holders is kept
+	assert.Equal(t, math.LegacyNewDec(20), byAddr[records[1].moduleAddress()].StakedAmount)
+}
@@ -3,14 +3,15 @@ package main
 import (
 	"bufio"
 	"context"
-	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"maps"
 	"os"
 	"path/filepath"
+	"runtime"
 	"slices"
 	"sort"
 	"strconv"
@@ -18,7 +19,7 @@ import (
 
 	"github.com/peterbourgon/ff/v3/ffcli"
 
-	appparams "github.com/atomone-hub/atomone/app/params"
+	dbm "github.com/cometbft/cometbft-db"
 
 	"cosmossdk.io/math"
 
@@ -34,7 +35,8 @@ var rootCmd = &ffcli.Command{
 		distributionCmd(), top20Cmd(), proposalCmd(), propJSONCmd(),
 		signTxCmd(), vestingCmd(),
 		tallyGenesisCmd(), shrinkVotesCmd(), gnoAirdropCmd(),
-		gasMonitorCmd(), gnoAccountsCmd(),
+		gasMonitorCmd(), gnoAccountsCmd(), extractCmd(), manifestCmd(),
+		blockVotesCmd(), validatorsCmd(),
 	},
 	Exec: func(ctx context.Context, args []string) error {
 		return flag.ErrHelp
@@ -100,40 +102,297 @@ Used to evaluate the performance of the governance tally.`,
 	}
 }
 
+func extractCmd() *ffcli.Command {
+	fs := flag.NewFlagSet("extract", flag.ContinueOnError)
+	finalVotes := fs.String("final-votes", "", "JSON file of votes cast in blocks not covered by the export, copied into block_votes.json: either block votes ({height, tx_index, vote}) or plain votes, which are given the height following the pre-tally export")
+	return &ffcli.Command{
+		Name:       "extract",
+		ShortUsage: "govbox extract [flags] <pre-tally-export.json> <tally-export.json> <proposalID> <path>",
+		ShortHelp:  "Extract from `gaiad export` files the data of <proposalID> into <path>",
+		LongHelp: `Reads the export of the block just before the tally (for the votes) and the
+export of the tally block (for everything else), and writes in <path> the files
+required by the other commands. See SNAPSHOT-EXTRACT.md for details.`,
+		FlagSet: fs,
+		Exec: func(ctx context.Context, args []string) error {
+			if err := fs.Parse(args); err != nil {
+				return err
+			}
+			if fs.NArg() != 4 {
+				return flag.ErrHelp
+			}
+			return extractSnapshot(fs.Arg(0), fs.Arg(1), fs.Arg(2), *finalVotes, fs.Arg(3))
+		},
+	}
+}
+
+func manifestCmd() *ffcli.Command {
+	fs := flag.NewFlagSet("manifest create", flag.ContinueOnError)
+	height := fs.Int64("height", 0, "Height of the export the snapshot was extracted from")
+	proposalID := fs.String("proposal", "", "ID of the proposal of the snapshot (by default read from <path>/prop.json)")
+	createCmd := &ffcli.Command{
+		Name:       "create",
+		ShortUsage: "govbox manifest create [flags] <path>",
+		ShortHelp:  "Create <path>/manifest.json with the checksums of the files in <path>",
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return flag.ErrHelp
+			}
+			datapath := args[0]
+			if *proposalID == "" {
+				if _, err := os.Stat(filepath.Join(datapath, "prop.json")); err != nil {
+					return fmt.Errorf("-proposal is required when prop.json is missing: %w", err)
+				}
+				prop, err := parseProposal(datapath)
+				if err != nil {
+					return err
+				}
+				*proposalID = strconv.FormatUint(prop.ID, 10)
+			}
+			m, err := createManifest(datapath, *height, *proposalID)
+			if err != nil {
+				return err
+			}
+			return m.write(datapath)
+		},
+	}
+	return &ffcli.Command{
+		Name:        "manifest",
+		ShortUsage:  "govbox manifest <subcommand> <path>",
+		ShortHelp:   "Manage the manifest of the snapshot files in <path>",
+		Subcommands: []*ffcli.Command{createCmd},
+		Exec: func(ctx context.Context, args []string) error {
+			return flag.ErrHelp
+		},
+	}
+}
+
+func blockVotesCmd() *ffcli.Command {
+	fs := flag.NewFlagSet("block-votes", flag.ContinueOnError)
+	rpcEndpoint := fs.String("rpc", "", "CometBFT RPC endpoint URL to read the blocks from")
+	blockStore := fs.String("block-store", "", "CometBFT data directory (containing blockstore.db and state.db) to read the blocks from")
+	dbBackend := fs.String("db-backend", "goleveldb", "Database backend of -block-store")
+	return &ffcli.Command{
+		Name:       "block-votes",
+		ShortUsage: "govbox block-votes [flags] <proposalID> <fromHeight> <toHeight> <path>",
+		ShortHelp:  "Import into <path>/block_votes.json the votes for <proposalID> cast in a range of blocks",
+		LongHelp: `Reads the MsgVote and MsgVoteWeighted messages of the successful txs of the
+blocks from <fromHeight> to <toHeight>, either from a RPC endpoint (-rpc) or
+from the block store of a stopped node (-block-store). The votes are written
+to <path>/block_votes.json, where they are merged with the votes of votes.json
+by the commands loading <path>.`,
+		FlagSet: fs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 4 {
+				return flag.ErrHelp
+			}
+			proposalID, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid proposalID: %w", err)
+			}
+			fromHeight, err := strconv.ParseInt(args[1], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid fromHeight: %w", err)
+			}
+			toHeight, err := strconv.ParseInt(args[2], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid toHeight: %w", err)
+			}
+			var src blockSource
+			switch {
+			case *rpcEndpoint != "" && *blockStore == "":
+				src, err = newRPCBlockSource(*rpcEndpoint)
+			case *blockStore != "" && *rpcEndpoint == "":
+				src, err = newStoreBlockSource(*blockStore, dbm.BackendType(*dbBackend))
+			default:
+				return fmt.Errorf("one of -rpc or -block-store is required")
+			}
+			if err != nil {
+				return err
+			}
+			defer src.Close()
+			return importBlockVotes(ctx, src, proposalID, fromHeight, toHeight, args[3])
+		},
+	}
+}
+
 func tallyCmd() *ffcli.Command {
+	fs := flag.NewFlagSet("tally", flag.ContinueOnError)
+	noCache := fs.Bool("no-cache", false, "Disable the binary cache of the parsed files")
+	byValidator := fs.Bool("by-validator", false, "Print the tally detail of each active validator")
+	csvFile := fs.String("csv", "", "With -by-validator, write the detail into this CSV file instead of printing it")
+	modeFlag := fs.String("mode", "", "Tally mode compared to the actual one of the proposal: inheritance, no-inheritance or direct-only")
 	return &ffcli.Command{
-		Name:       "tally",
-		ShortUsage: "govbox tally <path>",
-		ShortHelp:  "Print the comparison between the tally result and the tally computed from <path>",
+		Name:        "tally",
+		ShortUsage:  "govbox tally [flags] <path>",
+		ShortHelp:   "Print the comparison between the tally result and the tally computed from <path>",
+		FlagSet:     fs,
+		Subcommands: []*ffcli.Command{tallySimulateCmd(), tallyBatchCmd()},
 		Exec: func(ctx context.Context, args []string) error {
 			if len(args) == 0 {
 				return flag.ErrHelp
 			}
+			if *csvFile != "" && !*byValidator {
+				return errors.New("-csv requires -by-validator")
+			}
 			datapath := args[0]
-			votesByAddr, err := parseVotesByAddr(datapath)
+			var modes []tallyMode
+			if *modeFlag != "" {
+				mode, err := parseTallyMode(*modeFlag)
+				if err != nil {
+					return err
+				}
+				modes = append(modes, mode)
+			}
+			prop, snap, err := loadTallySnapshot(ctx, datapath, *noCache)
 			if err != nil {
 				return err
 			}
-			valsByAddr, err := parseValidatorsByAddr(datapath, votesByAddr)
+			if slices.Contains(modes, prop.Format.tallyMode()) {
+				return fmt.Errorf("-mode %s is the default mode of the proposal, already used by the tally, pick another mode to compare", prop.Format.tallyMode())
+			}
+			tr := tally(snap, prop.Format.tallyMode())
+			printTallyResults(tr.Results, tr.TotalVotingPower, prop)
+			switch {
+			case *byValidator && *csvFile != "":
+				if err := writeValidatorTalliesCSV(*csvFile, tr.Validators); err != nil {
+					return err
+				}
+			case *byValidator:
+				printValidatorTallies(tr.Validators)
+			}
+			params, hasParams, err := loadGovParams(datapath)
+			if err != nil {
+				return err
+			}
+			bondedTokens := totalBondedTokens(snap)
+			tallies := []modeTally{{Mode: prop.Format.tallyMode(), Result: tr}}
+			if hasParams {
+				verdict := evaluateTally(tr.Results, tr.TotalVotingPower, bondedTokens, params, prop)
+				printTallyVerdict(verdict, prop)
+				tallies[0].Verdict = &verdict
+			}
+			if len(modes) == 0 {
+				return nil
+			}
+			for _, mode := range modes {
+				t := modeTally{Mode: mode, Result: tally(snap, mode)}
+				if hasParams {
+					verdict := evaluateTally(t.Result.Results, t.Result.TotalVotingPower, bondedTokens, params, prop)
+					t.Verdict = &verdict
+				}
+				tallies = append(tallies, t)
+			}
+			printTallyComparison(tallies, prop)
+			return nil
+		},
+	}
+}
+
+func tallySimulateCmd() *ffcli.Command {
+	fs := flag.NewFlagSet("tally simulate", flag.ContinueOnError)
+	noCache := fs.Bool("no-cache", false, "Disable the binary cache of the parsed files")
+	trials := fs.Int("trials", 1000, "Number of trials")
+	seed := fs.Uint64("seed", 1, "Seed of the random sources of the trials")
+	workers := fs.Int("workers", runtime.NumCPU(), "Number of trials run in parallel")
+	modeFlag := fs.String("mode", "", "Tally mode: inheritance, no-inheritance or direct-only (by default the one of the proposal)")
+	turnout := fs.String("turnout", "uniform:0,0.2", "Distribution of the share of non-voting delegators who vote in a trial: fixed:<v>, uniform:<min>,<max> or beta:<alpha>,<beta>")
+	mix := fs.String("mix", "", "Dirichlet parameters of the option mix of the new voters, like yes=2,no=1,abstain=1 (by default the option mix of the tally)")
+	return &ffcli.Command{
+		Name:       "simulate",
+		ShortUsage: "govbox tally simulate [flags] <path>",
+		ShortHelp:  "Estimate the probability of each outcome if part of the non-voting delegators of <path> voted",
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return flag.ErrHelp
+			}
+			datapath := args[0]
+			cfg := simulationConfig{Trials: *trials, Seed: *seed, Workers: *workers}
+			var err error
+			if cfg.Turnout, err = parseDistribution(*turnout); err != nil {
+				return err
+			}
+			if *mix != "" {
+				if cfg.OptionMix, err = parseOptionMix(*mix); err != nil {
+					return err
+				}
+			}
+			prop, snap, err := loadTallySnapshot(ctx, datapath, *noCache)
 			if err != nil {
 				return err
 			}
-			delegsByAddr, err := parseDelegationsByAddr(datapath)
+			cfg.Mode = prop.Format.tallyMode()
+			if *modeFlag != "" {
+				if cfg.Mode, err = parseTallyMode(*modeFlag); err != nil {
+					return err
+				}
+			}
+			params, hasParams, err := loadGovParams(datapath)
 			if err != nil {
 				return err
 			}
-			results, totalVotingPower := tally(votesByAddr, valsByAddr, delegsByAddr)
-			printTallyResults(results, totalVotingPower, parseProp(datapath))
+			if !hasParams {
+				return fmt.Errorf("gov_params.json is required to simulate the outcome of the proposal")
+			}
+			res := simulateTally(snap, params, prop, cfg)
+			printSimulationResult(res, cfg)
 			return nil
 		},
 	}
 }
 
+func tallyBatchCmd() *ffcli.Command {
+	fs := flag.NewFlagSet("tally batch", flag.ContinueOnError)
+	reportFile := fs.String("report", "tally_batch.json", "JSON file where the report is written")
+	return &ffcli.Command{
+		Name:       "batch",
+		ShortUsage: "govbox tally batch [flags] <export.json>",
+		ShortHelp:  "Print the tally of each proposal of the export <export.json>",
+		LongHelp: `Proposals in voting period are tallied from the votes of the export, the
+final tally result is reported for the other proposals (their votes are removed
+once tallied).`,
+		FlagSet: fs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return flag.ErrHelp
+			}
+			report, err := tallyBatch(args[0])
+			if err != nil {
+				return err
+			}
+			printBatchReport(report)
+			return writeBatchReport(*reportFile, report)
+		},
+	}
+}
+
 func accountsCmd() *ffcli.Command {
+	fs := flag.NewFlagSet("accounts", flag.ContinueOnError)
+	noCache := fs.Bool("no-cache", false, "Disable the binary cache of the parsed files")
+	unbonding := fs.String("unbonding", "exclude", "Treatment of the unbonding delegations: exclude, liquid or staked")
+	redelegation := fs.String("redelegation", "exclude", "Treatment of the redelegations to inactive validators: exclude, liquid or staked")
+	rulesFile := fs.String("rules", "", "YAML or JSON rules file of the account exclusions, slashes, caps and redirects (by default module and interchain accounts are excluded, and ICF wallets slashed)")
+	labelsFile := fs.String("labels", "", "JSON or CSV file of the address labels (exchange, custodian, foundation, validator or bridge), matched by the rules categories (by default a few known addresses)")
 	return &ffcli.Command{
 		Name:       "accounts",
-		ShortUsage: "govbox accounts <path>",
+		ShortUsage: "govbox accounts [flags] <path>",
 		ShortHelp:  "Consolidate the data in <path> into a single file <path>/accounts.json",
+		LongHelp: `The unbonding delegations and the redelegations to inactive validators are
+recorded in the PendingStakes of the accounts, and counted following the
+-unbonding and -redelegation treatments:
+  - exclude: the tokens are ignored.
+  - liquid: the tokens are added to the liquid amount.
+  - staked: the tokens are added to the staked amount, with the vote of the
+    source validator.
+
+The accounts excluded by the -rules file are listed in <path>/accounts_audit.csv.
+The amounts of the accounts labeled by the -labels file are reported by
+category.`,
+		FlagSet: fs,
+		Subcommands: []*ffcli.Command{
+			accountsParticipationCmd(),
+		},
 		Exec: func(ctx context.Context, args []string) error {
 			if len(args) == 0 {
 				return flag.ErrHelp
@@ -141,82 +400,136 @@ func accountsCmd() *ffcli.Command {
 			var (
 				datapath     = args[0]
 				accountsFile = filepath.Join(datapath, "accounts.json")
+				opts         accountsOptions
+				err          error
 			)
-			votesByAddr, err := parseVotesByAddr(datapath)
-			if err != nil {
+			if opts.Unbonding, err = parseStakeTreatment(*unbonding); err != nil {
 				return err
 			}
-			valsByAddr, err := parseValidatorsByAddr(datapath, votesByAddr)
-			if err != nil {
+			if opts.Redelegation, err = parseStakeTreatment(*redelegation); err != nil {
 				return err
 			}
-			delegsByAddr, err := parseDelegationsByAddr(datapath)
-			if err != nil {
+			if opts.Rules, err = loadRules(*rulesFile); err != nil {
 				return err
 			}
-			balancesByAddr, err := parseBalancesByAddr(datapath, "uatom")
+			if opts.Rules.labels, err = loadLabels(*labelsFile); err != nil {
+				return err
+			}
+			snap, err := loadSnapshot(ctx, datapath, snapshotOptions{
+				parts: partVotes | partValidators | partDelegations | partUnbondings | partRedelegations |
+					partBalances | partAccountTypes | partVesting | partTokenizeShares,
+				denom:   "uatom",
+				noCache: *noCache,
+				// The biggest files are streamed into the accounts
+				stream: partDelegations | partBalances,
+			})
 			if err != nil {
 				return err
 			}
-			accountTypesByAddr, err := parseAccountTypesPerAddr(datapath)
+
+			accounts, err := getAccounts(ctx, snap, opts)
 			if err != nil {
 				return err
 			}
+			if err := opts.Rules.writeAuditLog(filepath.Join(datapath, "accounts_audit.csv")); err != nil {
+				return err
+			}
+			if err := writeAccounts(accountsFile, accounts); err != nil {
+				return err
+			}
+			printAccountsByCategory(accounts, opts.Rules.labels)
 
-			accounts := getAccounts(delegsByAddr, votesByAddr, valsByAddr, balancesByAddr, accountTypesByAddr)
+			// Record accounts.json in the manifest, so the commands using it
+			// can ensure it matches the snapshot files.
+			return addManifestFile(datapath, "accounts.json")
+		},
+	}
+}
 
-			bz, err := json.MarshalIndent(accounts, "", "  ")
+func accountsParticipationCmd() *ffcli.Command {
+	fs := flag.NewFlagSet("accounts participation", flag.ContinueOnError)
+	noCache := fs.Bool("no-cache", false, "Disable the binary cache of the parsed files")
+	outFile := fs.String("out", "participation.csv", "CSV file where the participation is written")
+	return &ffcli.Command{
+		Name:       "participation",
+		ShortUsage: "govbox accounts participation [flags] <path> <proposal-path>...",
+		ShortHelp:  "Compute the governance participation of the accounts over several proposals",
+		LongHelp: `The validators and delegations are loaded from <path>, the votes of each
+proposal from the <proposal-path> snapshots. For each address, the CSV file
+holds the share of the proposals it voted on, the average share of its stake
+that voted through its validators when it didn't vote, and how consistent its
+votes are with the votes of its validators.`,
+		FlagSet: fs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) < 2 {
+				return flag.ErrHelp
+			}
+			snap, err := loadSnapshot(ctx, args[0], snapshotOptions{
+				parts:   partValidators | partDelegations | partAccountTypes,
+				noCache: *noCache,
+			})
 			if err != nil {
 				return err
 			}
-			if err := os.WriteFile(accountsFile, bz, 0o666); err != nil {
+			var votesByProp []map[string]govtypes.WeightedVoteOptions
+			for _, propPath := range args[1:] {
+				propSnap, err := loadSnapshot(ctx, propPath, snapshotOptions{
+					parts:   partVotes,
+					noCache: *noCache,
+				})
+				if err != nil {
+					return err
+				}
+				votesByProp = append(votesByProp, propSnap.VotesByAddr)
+			}
+			scores, err := computeParticipation(ctx, snap, votesByProp)
+			if err != nil {
 				return err
 			}
-			fmt.Printf("%s file created.\n", accountsFile)
-
-			return nil
+			return writeParticipationCSV(*outFile, scores)
 		},
 	}
 }
 
 func gnoAccountsCmd() *ffcli.Command {
+	fs := flag.NewFlagSet("gno-accounts", flag.ContinueOnError)
+	noCache := fs.Bool("no-cache", false, "Disable the binary cache of the parsed files")
+	rulesFile := fs.String("rules", "", "YAML or JSON rules file of the account exclusions, slashes, caps and redirects (by default module and interchain accounts are excluded)")
 	return &ffcli.Command{
 		Name:       "gno-accounts",
-		ShortUsage: "govbox gno-accounts <path>",
+		ShortUsage: "govbox gno-accounts [flags] <path>",
 		ShortHelp:  "Consolidate the data in <path> into a single file <path>/accounts.json for gno/independence-day",
+		FlagSet:    fs,
 		Exec: func(ctx context.Context, args []string) error {
 			if len(args) == 0 {
 				return flag.ErrHelp
 			}
-			cfg := sdk.GetConfig()
-			cfg.SetBech32PrefixForAccount(appparams.Bech32PrefixAccAddr, appparams.Bech32PrefixAccPub)
-			cfg.SetBech32PrefixForValidator(appparams.Bech32PrefixValAddr, appparams.Bech32PrefixValPub)
-			cfg.SetBech32PrefixForConsensusNode(appparams.Bech32PrefixConsAddr, appparams.Bech32PrefixConsPub)
-			cfg.Seal()
+			setAtomOneBech32Prefixes()
 
 			var (
 				datapath     = args[0]
 				accountsFile = filepath.Join(datapath, "accounts.json")
 			)
-			valsByAddr, err := parseValidatorsByAddr(datapath, map[string]govtypes.WeightedVoteOptions{})
-			if err != nil {
-				return err
-			}
-			delegsByAddr, err := parseDelegationsByAddr(datapath)
-			if err != nil {
-				return err
+			rules := defaultGnoRules()
+			if *rulesFile != "" {
+				var err error
+				if rules, err = loadRules(*rulesFile); err != nil {
+					return err
+				}
 			}
-			balancesByAddr, err := parseBalancesByAddr(datapath, "")
+			snap, err := loadSnapshot(ctx, datapath, snapshotOptions{
+				parts:   partValidators | partDelegations | partBalances | partAccountTypes,
+				noCache: *noCache,
+			})
 			if err != nil {
 				return err
 			}
-			accountTypesByAddr, err := parseAccountTypesPerAddr(datapath)
-			if err != nil {
+
+			accounts := getGnoAccounts(snap, rules)
+			if err := rules.writeAuditLog(filepath.Join(datapath, "gno_accounts_audit.csv")); err != nil {
 				return err
 			}
 
-			accounts := getGnoAccounts(delegsByAddr, valsByAddr, balancesByAddr, accountTypesByAddr)
-
 			bz, err := json.MarshalIndent(accounts, "", "  ")
 			if err != nil {
 				return err
@@ -226,16 +539,24 @@ func gnoAccountsCmd() *ffcli.Command {
 			}
 			fmt.Printf("%s file created.\n", accountsFile)
 
-			return nil
+			// Record accounts.json in the manifest, so the commands using it
+			// can ensure it matches the snapshot files.
+			return addManifestFile(datapath, "accounts.json")
 		},
 	}
 }
 
 func genesisCmd() *ffcli.Command {
+	fs := flag.NewFlagSet("genesis", flag.ContinueOnError)
+	noCache := fs.Bool("no-cache", false, "Disable the binary cache of the parsed files")
+	policyFile := fs.String("policy", "", "YAML or JSON distribution policy file (by default the GovGen PROP 001 policy, see distribution_policy.yaml)")
+	rulesFile := fs.String("rules", "", "YAML or JSON rules file of the account exclusions, slashes, caps and redirects, must be the one given to distribution (by default module and interchain accounts are excluded, and ICF wallets slashed)")
+	labelsFile := fs.String("labels", "", "JSON or CSV file of the address labels (exchange, custodian, foundation, validator or bridge), matched by the rules categories, must be the one given to distribution (by default a few known addresses)")
 	return &ffcli.Command{
 		Name:       "genesis",
-		ShortUsage: "govbox genesis <genesis.json> <path>",
+		ShortUsage: "govbox genesis [flags] <genesis.json> <path>",
 		ShortHelp:  "Outputs an updated version of <genesis.json> with the airdrop",
+		FlagSet:    fs,
 		Exec: func(ctx context.Context, args []string) error {
 			if len(args) != 2 {
 				return flag.ErrHelp
@@ -245,11 +566,25 @@ func genesisCmd() *ffcli.Command {
 				datapath     = args[1]
 				accountsFile = filepath.Join(datapath, "accounts.json")
 			)
-			accounts, err := parseAccounts(accountsFile)
+			if err := verifyManifest(datapath, "accounts.json"); err != nil {
+				return err
+			}
+			params, err := loadDistriPolicy(*policyFile)
 			if err != nil {
 				return err
 			}
-			airdrop, err := distribution(accounts, defaultDistriParams(), "atone")
+			rules, err := loadRules(*rulesFile)
+			if err != nil {
+				return err
+			}
+			if rules.labels, err = loadLabels(*labelsFile); err != nil {
+				return err
+			}
+			accounts, err := parseAccounts(ctx, accountsFile, !*noCache)
+			if err != nil {
+				return err
+			}
+			airdrop, err := distribution(accounts, params, "atone", rules)
 			if err != nil {
 				return err
 			}
@@ -277,29 +612,52 @@ func autoStakingCmd() *ffcli.Command {
 func distributionCmd() *ffcli.Command {
 	fs := flag.NewFlagSet("distribution", flag.ContinueOnError)
 	chartMode := fs.Bool("chart", false, "Outputs a chart instead of Markdown tables")
-	yesMultipliers := fs.String("yesMultipliers", "1", "List of possible comma-seperated Yes multipliers")
-	noMultipliers := fs.String("noMultipliers", "9", "List of possible comma-separated No multipliers")
+	policyFile := fs.String("policy", "", "YAML or JSON distribution policy file (by default the GovGen PROP 001 policy, see distribution_policy.yaml)")
+	yesMultipliers := fs.String("yesMultipliers", "", "List of possible comma-seperated multipliers of the yes bucket (by default the one of the policy)")
+	noMultipliers := fs.String("noMultipliers", "", "List of possible comma-separated multipliers of the no and nwv buckets (by default the one of the policy)")
+	shares := fs.String("shares", "", "Comma-separated target shares of the $ATONE supply per bucket, like 'yes<=20%,no+nwv>=40%', the multipliers of the policy are solved to meet them")
 	prefix := fs.String("prefix", "", "Cosmos address prefix (by default it is unchanged: \"cosmos\")")
+	noCache := fs.Bool("no-cache", false, "Disable the binary cache of the parsed files")
+	rulesFile := fs.String("rules", "", "YAML or JSON rules file of the account exclusions, slashes, caps and redirects (by default module and interchain accounts are excluded, and ICF wallets slashed)")
+	labelsFile := fs.String("labels", "", "JSON or CSV file of the address labels (exchange, custodian, foundation, validator or bridge), matched by the rules categories (by default a few known addresses)")
 
 	cmd := &ffcli.Command{
 		Name:       "distribution",
-		ShortUsage: "govbox distribution <path>",
+		ShortUsage: "govbox distribution [flags] <path>",
 		ShortHelp:  "Convert <path>/accounts.json into <path>/airdrop.json",
 		LongHelp:   `Generate the ATONE distribution described in GovGen PROP 001`,
 		FlagSet:    fs,
+		Subcommands: []*ffcli.Command{
+			distributionSweepCmd(),
+		},
 		Exec: func(ctx context.Context, args []string) error {
 			if len(args) == 0 {
 				return flag.ErrHelp
 			}
 			fs.Parse(args)
+			policy, err := loadDistriPolicy(*policyFile)
+			if err != nil {
+				return err
+			}
+			var constraints []shareConstraint
+			if *shares != "" {
+				if *yesMultipliers != "" || *noMultipliers != "" {
+					return errors.New("-shares can't be used with -yesMultipliers or -noMultipliers")
+				}
+				if constraints, err = parseShareConstraints(*shares); err != nil {
+					return err
+				}
+			}
 			// Build distribution parameters from yes and no multipliers
-			var distriParamss []distriParams
-			for _, y := range strings.Split(*yesMultipliers, ",") {
-				for _, n := range strings.Split(*noMultipliers, ",") {
-					distriParams := defaultDistriParams()
-					distriParams.yesVotesMultiplier = math.LegacyMustNewDecFromStr(y)
-					distriParams.noVotesMultiplier = math.LegacyMustNewDecFromStr(n)
-					distriParamss = append(distriParamss, distriParams)
+			distriParamss := []distriParams{policy}
+			if *yesMultipliers != "" {
+				if distriParamss, err = withMultipliers(distriParamss, *yesMultipliers, "yes"); err != nil {
+					return err
+				}
+			}
+			if *noMultipliers != "" {
+				if distriParamss, err = withMultipliers(distriParamss, *noMultipliers, "no", "nwv"); err != nil {
+					return err
 				}
 			}
 			var (
@@ -309,12 +667,33 @@ func distributionCmd() *ffcli.Command {
 				airdropDetailFile = filepath.Join(datapath, "airdrop_detail.csv")
 				airdrops          []airdrop
 			)
-			accounts, err := parseAccounts(accountsFile)
+			if err := verifyManifest(datapath, "accounts.json"); err != nil {
+				return err
+			}
+			rules, err := loadRules(*rulesFile)
 			if err != nil {
 				return err
 			}
+			if rules.labels, err = loadLabels(*labelsFile); err != nil {
+				return err
+			}
+			accounts, err := parseAccounts(ctx, accountsFile, !*noCache)
+			if err != nil {
+				return err
+			}
+			if len(constraints) > 0 {
+				solved, err := solveShareConstraints(accounts, policy, rules, constraints)
+				if err != nil {
+					// Show the shares of the policy multipliers
+					if current, err := distribution(accounts, policy, *prefix, rules); err == nil {
+						printShareConstraints(constraints, current)
+					}
+					return err
+				}
+				distriParamss = []distriParams{solved}
+			}
 			for _, params := range distriParamss {
-				airdrop, err := distribution(accounts, params, *prefix)
+				airdrop, err := distribution(accounts, params, *prefix, rules)
 				if err != nil {
 					return err
 				}
@@ -323,6 +702,9 @@ func distributionCmd() *ffcli.Command {
 			if err := printAirdropsStats(*chartMode, airdrops); err != nil {
 				return err
 			}
+			if len(constraints) > 0 {
+				printShareConstraints(constraints, airdrops[0])
+			}
 			if len(airdrops) == 1 {
 				// Write airdrop.json only if a single distriParamss
 				bz, err := json.MarshalIndent(airdrops[0].addresses, "", "  ")
@@ -334,36 +716,14 @@ func distributionCmd() *ffcli.Command {
 				}
 				fmt.Printf("⚠ '%s' has been created/updated, don't forget to update S3 ⚠\n", airdropFile)
 
-				f, err := os.Create(airdropDetailFile)
-				if err != nil {
+				if err := writeAirdropDetailCSV(airdropDetailFile, airdrops[0]); err != nil {
 					return err
 				}
-				defer f.Close()
-				w := csv.NewWriter(f)
-				w.Write([]string{
-					"address", "factor",
-					"yesAtomAmt", "yesMultiplier", "yesBonusMalus", "yesAtoneAmt",
-					"noAtomAmt", "noMultiplier", "noBonusMalus", "noAtoneAmt",
-					"nwvAtomAmt", "nwvMultiplier", "nwvBonusMalus", "nwvAtoneAmt",
-					"absAtomAmt", "absMultiplier", "absBonusMalus", "absAtoneAmt",
-					"dnvAtomAmt", "dnvMultiplier", "dnvBonusMalus", "dnvAtoneAmt",
-					"liquidAtomAmt", "liquidMultiplier", "liquidBonusMalus", "liquidAtoneAmt",
-					"totalAtoneAmt",
-				})
-				for _, v := range airdrops[0].addressesDetail {
-					w.Write([]string{
-						v.Address, v.YesDetail.Factor.String(),
-						v.YesDetail.AtomAmt.String(), v.YesDetail.Multiplier.String(), v.YesDetail.BonusMalus.String(), v.YesDetail.AtoneAmt.String(),
-						v.NoDetail.AtomAmt.String(), v.NoDetail.Multiplier.String(), v.NoDetail.BonusMalus.String(), v.NoDetail.AtoneAmt.String(),
-						v.NWVDetail.AtomAmt.String(), v.NWVDetail.Multiplier.String(), v.NWVDetail.BonusMalus.String(), v.NWVDetail.AtoneAmt.String(),
-						v.AbsDetail.AtomAmt.String(), v.AbsDetail.Multiplier.String(), v.AbsDetail.BonusMalus.String(), v.AbsDetail.AtoneAmt.String(),
-						v.DnvDetail.AtomAmt.String(), v.DnvDetail.Multiplier.String(), v.DnvDetail.BonusMalus.String(), v.DnvDetail.AtoneAmt.String(),
-						v.LiquidDetail.AtomAmt.String(), v.LiquidDetail.Multiplier.String(), v.LiquidDetail.BonusMalus.String(), v.LiquidDetail.AtoneAmt.String(),
-						v.Total.String(),
-					})
-				}
-				w.Flush()
 				fmt.Printf("⚠ '%s' has been created/updated, don't forget to update S3 ⚠\n", airdropDetailFile)
+
+				if err := rules.writeAuditLog(filepath.Join(datapath, "distribution_audit.csv")); err != nil {
+					return err
+				}
 			}
 			return nil
 		},
@@ -371,23 +731,166 @@ func distributionCmd() *ffcli.Command {
 	return cmd
 }
 
+func distributionSweepCmd() *ffcli.Command {
+	fs := flag.NewFlagSet("distribution sweep", flag.ContinueOnError)
+	policyFile := fs.String("policy", "", "YAML or JSON distribution policy file (by default the GovGen PROP 001 policy, see distribution_policy.yaml)")
+	vary := fs.String("vary", "", "Semicolon-separated policy parameters and their values, like 'buckets.yes.multiplier=1:5:0.5;buckets.no+nwv.multiplier=5,9;normalization_targets.non_voters=0.2:0.4:0.05'")
+	top := fs.String("top", "1,10,100", "Comma-separated numbers of top recipients whose share of the airdrop is reported")
+	workers := fs.Int("workers", runtime.NumCPU(), "Number of distributions computed in parallel")
+	reportFile := fs.String("report", "distribution_sweep.csv", "CSV file where the results are written, or JSON file if it ends with .json")
+	noCache := fs.Bool("no-cache", false, "Disable the binary cache of the parsed files")
+	rulesFile := fs.String("rules", "", "YAML or JSON rules file of the account exclusions, slashes, caps and redirects (by default module and interchain accounts are excluded, and ICF wallets slashed)")
+	labelsFile := fs.String("labels", "", "JSON or CSV file of the address labels (exchange, custodian, foundation, validator or bridge), matched by the rules categories (by default a few known addresses)")
+	return &ffcli.Command{
+		Name:       "sweep",
+		ShortUsage: "govbox distribution sweep [flags] <path>",
+		ShortHelp:  "Compute the distribution of <path>/accounts.json for each combination of the -vary parameters",
+		LongHelp: `The policy parameters are named like the fields of the policy file:
+  - buckets.<name>[+<name>...].multiplier
+  - buckets.<name>[+<name>...].bonus_malus
+  - normalization_targets.<name>
+  - supply_factor, supply_mint_factor, community_pool_share or account_cap
+Their values are either comma-separated, or a <start>:<end>:<step> range with
+end included.
+
+The report holds one row per combination, with the distributed and total
+supply, the share of each bucket, the Gini coefficient and top N shares of the
+airdrop amounts, and the number of recipients.`,
+		FlagSet: fs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 || *vary == "" {
+				return flag.ErrHelp
+			}
+			datapath := args[0]
+			policy, err := loadDistriPolicy(*policyFile)
+			if err != nil {
+				return err
+			}
+			sweepParams, err := parseSweepParams(*vary)
+			if err != nil {
+				return err
+			}
+			topN, err := parseTopN(*top)
+			if err != nil {
+				return err
+			}
+			runs, err := sweepRuns(policy, sweepParams)
+			if err != nil {
+				return err
+			}
+			if err := verifyManifest(datapath, "accounts.json"); err != nil {
+				return err
+			}
+			rules, err := loadRules(*rulesFile)
+			if err != nil {
+				return err
+			}
+			if rules.labels, err = loadLabels(*labelsFile); err != nil {
+				return err
+			}
+			accounts, err := parseAccounts(ctx, filepath.Join(datapath, "accounts.json"), !*noCache)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%d distributions to compute\n", len(runs))
+			rows, err := runSweep(accounts, rules, sweepParams, runs, *workers, topN)
+			if err != nil {
+				return err
+			}
+			return writeSweepReport(*reportFile, sweepParams, policy.buckets, topN, rows)
+		},
+	}
+}
+
+func validatorsCmd() *ffcli.Command {
+	return &ffcli.Command{
+		Name:        "validators",
+		ShortUsage:  "govbox validators <subcommand>",
+		ShortHelp:   "Validators related commands",
+		Subcommands: []*ffcli.Command{validatorsReportCmd()},
+		Exec: func(ctx context.Context, args []string) error {
+			return flag.ErrHelp
+		},
+	}
+}
+
+func validatorsReportCmd() *ffcli.Command {
+	fs := flag.NewFlagSet("validators report", flag.ContinueOnError)
+	noCache := fs.Bool("no-cache", false, "Disable the binary cache of the parsed files")
+	csvFile := fs.String("csv", "", "Write the report into this CSV file instead of printing it")
+	rulesFile := fs.String("rules", "", "YAML or JSON rules file of the account exclusions, slashes, caps and redirects (by default module and interchain accounts are excluded, and ICF wallets slashed)")
+	policyFile := fs.String("policy", "", "YAML or JSON distribution policy file (by default the GovGen PROP 001 policy, see distribution_policy.yaml)")
+	labelsFile := fs.String("labels", "", "JSON or CSV file of the address labels (exchange, custodian, foundation, validator or bridge), matched by the rules categories (by default a few known addresses)")
+	return &ffcli.Command{
+		Name:       "report",
+		ShortUsage: "govbox validators report [flags] <path>",
+		ShortHelp:  "Report the treatment of the active validators and of their operator accounts",
+		LongHelp: `For each active validator, reports its vote, self-delegation and number of
+delegators, and the entry of its operator account in <path>/accounts.json
+with the airdrop it receives from the distribution computed with the -policy,
+-rules and -labels files.`,
+		FlagSet: fs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) == 0 {
+				return flag.ErrHelp
+			}
+			datapath := args[0]
+			if err := verifyManifest(datapath, "accounts.json"); err != nil {
+				return err
+			}
+			rules, err := loadRules(*rulesFile)
+			if err != nil {
+				return err
+			}
+			if rules.labels, err = loadLabels(*labelsFile); err != nil {
+				return err
+			}
+			snap, err := loadSnapshot(ctx, datapath, snapshotOptions{
+				parts:   partVotes | partValidators | partDelegations,
+				noCache: *noCache,
+			})
+			if err != nil {
+				return err
+			}
+			accounts, err := parseAccounts(ctx, filepath.Join(datapath, "accounts.json"), !*noCache)
+			if err != nil {
+				return err
+			}
+			params, err := loadDistriPolicy(*policyFile)
+			if err != nil {
+				return err
+			}
+			airdrop, err := distribution(accounts, params, "", rules)
+			if err != nil {
+				return err
+			}
+			reports := buildValidatorsReport(snap, accounts, airdrop)
+			if *csvFile != "" {
+				return writeValidatorsReportCSV(*csvFile, reports)
+			}
+			printValidatorsReport(reports)
+			return nil
+		},
+	}
+}
+
 func top20Cmd() *ffcli.Command {
+	fs := flag.NewFlagSet("top20", flag.ContinueOnError)
+	labelsFile := fs.String("labels", "", "JSON or CSV file of the address labels (exchange, custodian, foundation, validator or bridge) (by default a few known addresses)")
 	return &ffcli.Command{
 		Name:       "top20",
-		ShortUsage: "govbox top20 <path>",
+		ShortUsage: "govbox top20 [flags] <path>",
 		ShortHelp:  "Prints the top richest addresses of <path>/airdrop.json",
+		FlagSet:    fs,
 		Exec: func(ctx context.Context, args []string) error {
-			var (
-				datapath   = args[0]
-				knownAddrs = map[string]string{
-					"cosmos14lultfckehtszvzw4ehu0apvsr77afvyhgqhwh": "Dokia",
-					"cosmos1p3ucd3ptpw902fluyjzhq3ffgq4ntddac9sa3s": "Binance?",
-					"cosmos1nm0rrq86ucezaf8uj35pq9fpwr5r82cl8sc7p5": "Kraken",
-					"cosmos1zr7aswwzskhav7w57vwpaqsafuh5uj7nv8a964": "SG1?",
-					"cosmos1f70nsqtq0wcd0kymq79ca2p0k5napnm6yqc94x": "ChorusOne?",
-					"cosmos1wlh0f94r6c4y5nwsqlxd2384jmxlljstame50p": "CosmosStation?",
-				}
-			)
+			if len(args) == 0 {
+				return flag.ErrHelp
+			}
+			datapath := args[0]
+			labels, err := loadLabels(*labelsFile)
+			if err != nil {
+				return err
+			}
 
 			f, err := os.Open(filepath.Join(datapath, "airdrop.json"))
 			if err != nil {
@@ -413,13 +916,14 @@ func top20Cmd() *ffcli.Command {
 				}
 				totalAmt = totalAmt.Add(addresses[addr])
 			}
-			table := newMarkdownTable("Position", "Address", "ID", "$ATONE", "Supply %")
+			table := newMarkdownTable("Position", "Address", "ID", "Category", "$ATONE", "Supply %")
 			for i, addr := range top20 {
 				amt := addresses[addr]
 				table.Append([]string{
 					fmt.Sprint(i + 1),
 					fmt.Sprintf("[%[1]s](https://www.mintscan.io/cosmos/address/%[1]s)", addr),
-					knownAddrs[addr],
+					labels[addr].Name,
+					string(labels[addr].Category),
 					human(amt),
 					humanPercent(amt.ToLegacyDec().Quo(totalAmt.ToLegacyDec())),
 				})
@@ -452,13 +956,16 @@ func vestingCmd() *ffcli.Command {
 	return &ffcli.Command{
 		Name:       "vesting",
 		ShortUsage: "govbox vesting <path>",
-		ShortHelp:  "Report vesting accounts analysis",
+		ShortHelp:  "Report vesting accounts analysis at the snapshot time",
 		Exec: func(ctx context.Context, args []string) error {
 			if len(args) == 0 {
 				return flag.ErrHelp
 			}
 			datapath := args[0]
-			err := analyzeVestingAccounts(datapath)
+			if err := verifyManifest(datapath, "auth_genesis.json", "prop.json"); err != nil {
+				return err
+			}
+			err := analyzeVestingAccounts(ctx, datapath)
 			if err != nil {
 				return err
 			}
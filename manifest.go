@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+const manifestFilename = "manifest.json"
+
+// snapshotFiles lists the files of a snapshot directory that are recorded in
+// the manifest when it is created (if they exist).
+var snapshotFiles = []string{
+	"votes.json",
+	"block_votes.json",
+	"delegations.json",
+	"unbonding_delegations.json",
+	"redelegations.json",
+	"tokenize_share_records.json",
+	"active_validators.json",
+	"prop.json",
+	"gov_params.json",
+	"balances.json",
+	"auth_genesis.json",
+}
+
+// Manifest describes the content of a snapshot directory, so the results
+// computed from it can be reproduced.
+type Manifest struct {
+	// ProposalID is the ID of the proposal of the snapshot.
+	ProposalID string `json:"proposal_id"`
+	// Height is the height of the export the snapshot was extracted from.
+	Height int64 `json:"height"`
+	// Files holds the hex encoded SHA-256 of the files of the snapshot, by file
+	// name.
+	Files map[string]string `json:"files"`
+}
+
+// createManifest returns the manifest of the snapshot directory path, holding
+// the checksums of the snapshotFiles present in path.
+func createManifest(path string, height int64, proposalID string) (Manifest, error) {
+	m := Manifest{
+		ProposalID: proposalID,
+		Height:     height,
+		Files:      make(map[string]string),
+	}
+	for _, name := range snapshotFiles {
+		sum, err := sha256File(filepath.Join(path, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return Manifest{}, err
+		}
+		m.Files[name] = sum
+	}
+	if len(m.Files) == 0 {
+		return Manifest{}, fmt.Errorf("no snapshot files found in %s", path)
+	}
+	return m, nil
+}
+
+// readManifest reads the manifest of the snapshot directory path.
+func readManifest(path string) (Manifest, error) {
+	file := filepath.Join(path, manifestFilename)
+	bz, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Manifest{}, fmt.Errorf("cannot read %s, run `%s manifest create %s` to generate it: %w", file, os.Args[0], path, err)
+	}
+	if err != nil {
+		return Manifest{}, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(bz, &m); err != nil {
+		return Manifest{}, fmt.Errorf("cannot json decode manifest from file %s: %w", file, err)
+	}
+	return m, nil
+}
+
+// write writes m into the snapshot directory path.
+func (m Manifest) write(path string) error {
+	bz, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(path, manifestFilename)
+	if err := os.WriteFile(file, append(bz, '\n'), 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("%s file created.\n", file)
+	return nil
+}
+
+// verifyManifest ensures that files are listed in the manifest of the snapshot
+// directory path, and that their checksums match.
+func verifyManifest(path string, files ...string) error {
+	m, err := readManifest(path)
+	if err != nil {
+		return err
+	}
+	for _, name := range files {
+		expected, ok := m.Files[name]
+		if !ok {
+			return fmt.Errorf("%s is not listed in %s, run `%s manifest create %s` to update it",
+				name, filepath.Join(path, manifestFilename), os.Args[0], path)
+		}
+		sum, err := sha256File(filepath.Join(path, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("%s is listed in %s but is missing: %w",
+				filepath.Join(path, name), filepath.Join(path, manifestFilename), err)
+		}
+		if err != nil {
+			return err
+		}
+		if sum != expected {
+			return fmt.Errorf("checksum mismatch for %s: expected %s, got %s, the file has changed since the manifest was created",
+				filepath.Join(path, name), expected, sum)
+		}
+	}
+	return nil
+}
+
+// addManifestFile records in the manifest of the snapshot directory path the
+// checksum of the file name, which is generated from the snapshot files
+// (like accounts.json).
+func addManifestFile(path, name string) error {
+	m, err := readManifest(path)
+	if err != nil {
+		return err
+	}
+	sum, err := sha256File(filepath.Join(path, name))
+	if err != nil {
+		return err
+	}
+	if m.Files == nil {
+		m.Files = make(map[string]string)
+	}
+	m.Files[name] = sum
+	return m.write(path)
+}
+
+// snapshotPartFiles returns the files of the snapshot directory path required
+// by parts. The optional files are required if they are listed in the
+// manifest of path or if they exist, so a listed file that has been deleted
+// fails the verification instead of being silently skipped.
+func snapshotPartFiles(path string, parts snapshotPart) ([]string, error) {
+	m, err := readManifest(path)
+	if err != nil {
+		return nil, err
+	}
+	optional := func(file string) bool {
+		if _, ok := m.Files[file]; ok {
+			return true
+		}
+		_, err := os.Stat(filepath.Join(path, file))
+		return err == nil
+	}
+	var files []string
+	if parts&partVotes != 0 && optional("block_votes.json") {
+		files = append(files, "block_votes.json")
+	}
+	// unbonding_delegations.json, redelegations.json and
+	// tokenize_share_records.json are optional, they are missing from the
+	// snapshots extracted before they were added.
+	for part, file := range map[snapshotPart]string{
+		partUnbondings:     "unbonding_delegations.json",
+		partRedelegations:  "redelegations.json",
+		partTokenizeShares: "tokenize_share_records.json",
+	} {
+		if parts&part != 0 && optional(file) {
+			files = append(files, file)
+		}
+	}
+	for part, file := range map[snapshotPart]string{
+		partVotes:        "votes.json",
+		partValidators:   "active_validators.json",
+		partDelegations:  "delegations.json",
+		partBalances:     "balances.json",
+		partAccountTypes: "auth_genesis.json",
+	} {
+		if parts&part != 0 {
+			files = append(files, file)
+		}
+	}
+	if parts&partVesting != 0 {
+		files = append(files, "auth_genesis.json", "prop.json")
+	}
+	if parts&partTokenizeShares != 0 {
+		// for the share token balances
+		files = append(files, "balances.json")
+	}
+	slices.Sort(files)
+	return slices.Compact(files), nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyManifest(t *testing.T) {
+	datapath := t.TempDir()
+	writeFile := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(datapath, name), []byte(content), 0o644))
+	}
+	writeFile("votes.json", `[]`)
+	writeFile("delegations.json", `[{"delegator_address": "addr1"}]`)
+
+	err := verifyManifest(datapath, "votes.json")
+	require.ErrorContains(t, err, "manifest create")
+
+	m, err := createManifest(datapath, 42, "1")
+	require.NoError(t, err)
+	assert.Len(t, m.Files, 2)
+	require.NoError(t, m.write(datapath))
+	require.NoError(t, verifyManifest(datapath, "votes.json", "delegations.json"))
+
+	err = verifyManifest(datapath, "balances.json")
+	require.ErrorContains(t, err, "balances.json is not listed")
+
+	writeFile("delegations.json", `[]`)
+	require.NoError(t, verifyManifest(datapath, "votes.json"))
+	err = verifyManifest(datapath, "delegations.json")
+	require.ErrorContains(t, err, "checksum mismatch")
+
+	writeFile("accounts.json", `[]`)
+	require.NoError(t, addManifestFile(datapath, "accounts.json"))
+	require.NoError(t, verifyManifest(datapath, "accounts.json"))
+	m, err = readManifest(datapath)
+	require.NoError(t, err)
+	assert.EqualValues(t, 42, m.Height)
+	assert.Equal(t, "1", m.ProposalID)
+	assert.Len(t, m.Files, 3)
+}
+
+func TestVerifyManifestMissingOptionalFile(t *testing.T) {
+	datapath := t.TempDir()
+	writeFile := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(datapath, name), []byte(content), 0o644))
+	}
+	writeFile("votes.json", `[]`)
+	writeFile("delegations.json", `[]`)
+	writeFile("unbonding_delegations.json", `[]`)
+	writeFile("block_votes.json", `[]`)
+	m, err := createManifest(datapath, 42, "1")
+	require.NoError(t, err)
+	require.NoError(t, m.write(datapath))
+
+	files, err := snapshotPartFiles(datapath, partVotes|partDelegations|partUnbondings|partRedelegations)
+	require.NoError(t, err)
+	// redelegations.json is neither listed nor present
+	assert.Equal(t, []string{"block_votes.json", "delegations.json", "unbonding_delegations.json", "votes.json"}, files)
+
+	require.NoError(t, os.Remove(filepath.Join(datapath, "block_votes.json")))
+	_, err = loadSnapshot(context.Background(), datapath, snapshotOptions{parts: partVotes, noCache: true})
+	require.ErrorContains(t, err, "block_votes.json is listed")
+
+	require.NoError(t, os.Remove(filepath.Join(datapath, "unbonding_delegations.json")))
+	_, err = loadSnapshot(context.Background(), datapath, snapshotOptions{parts: partUnbondings, noCache: true})
+	require.ErrorContains(t, err, "unbonding_delegations.json is listed")
+}
@@ -1,16 +1,24 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
+	"iter"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
 	"cosmossdk.io/math"
 
 	"github.com/cosmos/gogoproto/jsonpb"
+	"github.com/cosmos/gogoproto/proto"
 	h "github.com/dustin/go-humanize"
 
 	"github.com/cosmos/cosmos-sdk/codec"
@@ -18,6 +26,7 @@ import (
 	cryptocodec "github.com/cosmos/cosmos-sdk/crypto/codec"
 	sdk "github.com/cosmos/cosmos-sdk/types"
 	authtypes "github.com/cosmos/cosmos-sdk/x/auth/types"
+	vestexported "github.com/cosmos/cosmos-sdk/x/auth/vesting/exported"
 	vestingtypes "github.com/cosmos/cosmos-sdk/x/auth/vesting/types"
 	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
 	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types/v1beta1"
@@ -63,6 +72,12 @@ func humand(d math.LegacyDec) string {
 	return h.Comma(d.Quo(M).RoundInt64())
 }
 
+// humanf is like humand with 2 decimals, for amounts which can be lower than
+// a unit.
+func humanf(d math.LegacyDec) string {
+	return h.CommafWithDigits(d.QuoInt64(1_000_000).MustFloat64(), 2)
+}
+
 func humanPercentI(d math.LegacyDec) string {
 	return fmt.Sprintf("%d%%", d.Mul(math.LegacyNewDec(100)).RoundInt64())
 }
@@ -84,160 +99,215 @@ func convertBech32(addr, src, dst string) (string, error) {
 	return addr, nil
 }
 
-func parseAccounts(path string) ([]Account, error) {
-	f, err := os.Open(path)
-	if err != nil {
+func parseAccounts(ctx context.Context, path string, useCache bool) ([]Account, error) {
+	if _, err := os.Stat(path); err != nil {
 		return nil, fmt.Errorf("cannot read %s file, run `%s accounts` to generate it: %w", path, os.Args[0], err)
 	}
-	defer f.Close()
 	var accounts []Account
-	if err := json.NewDecoder(f).Decode(&accounts); err != nil {
-		return nil, fmt.Errorf("cannot json decode accounts from file %s: %w", path, err)
+	for acc, err := range readCachedRecords(ctx, path, "", jsonDecodeNext[Account], useCache) {
+		if err != nil {
+			return nil, fmt.Errorf("cannot json decode accounts from file %s: %w", path, err)
+		}
+		accounts = append(accounts, acc)
 	}
 	return accounts, nil
 }
 
-func parseAccountTypesPerAddr(path string) (map[string]string, error) {
-	f, err := os.Open(filepath.Join(path, "auth_genesis.json"))
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-	var genesis authtypes.GenesisState
-	err = unmarshaler.Unmarshal(f, &genesis)
-	if err != nil {
-		return nil, err
-	}
+func parseAccountTypesPerAddr(ctx context.Context, path string, useCache bool) (map[string]string, error) {
 	accountTypesByAddr := make(map[string]string)
-	for i, any := range genesis.Accounts {
+	records := readCachedRecords(ctx, filepath.Join(path, "auth_genesis.json"), "accounts", protoDecodeNext[codectypes.Any], useCache)
+	for any, err := range records {
+		if err != nil {
+			return nil, err
+		}
 		var acc authtypes.GenesisAccount
-		registry.UnpackAny(any, &acc)
-		accountTypesByAddr[acc.GetAddress().String()] = genesis.Accounts[i].GetTypeUrl()
+		registry.UnpackAny(&any, &acc)
+		accountTypesByAddr[acc.GetAddress().String()] = any.GetTypeUrl()
 	}
 	fmt.Printf("%s accounts\n", h.Comma(int64(len(accountTypesByAddr))))
 	return accountTypesByAddr, nil
 }
 
-func analyzeVestingAccounts(path string) error {
-	f, err := os.Open(filepath.Join(path, "auth_genesis.json"))
+// snapshotTime returns the time of the snapshot directory path, which is the
+// voting end time of its proposal: the tally export is made at the block that
+// ends the voting period.
+func snapshotTime(path string) (time.Time, error) {
+	prop, err := parseProposal(path)
 	if err != nil {
-		return err
+		return time.Time{}, err
 	}
-	defer f.Close()
-	var genesis authtypes.GenesisState
-	err = unmarshaler.Unmarshal(f, &genesis)
-	if err != nil {
-		return err
+	if prop.VotingEndTime.IsZero() {
+		return time.Time{}, fmt.Errorf("%s: proposal has no voting end time", filepath.Join(path, "prop.json"))
 	}
-	var (
-		now             = time.Now()
-		numVesting      int
-		numStillVesting int
-		totalVesting    sdk.Coins
-		blocktime             = time.Unix(1700946028, 0) // time of prop848 2023-11-25 22:00:28 +0100 CET
-		highCapInt      int64 = 10000000000
-		highCap               = sdk.NewCoins(sdk.NewInt64Coin("uatom", highCapInt))
-		numHighCap      int
-	)
-	for i, any := range genesis.Accounts {
+	return prop.VotingEndTime, nil
+}
+
+// parseVestingByAddr returns the amounts of denom of the vesting accounts
+// (continuous, delayed, periodic and permanent locked) at blockTime, by
+// address.
+func parseVestingByAddr(ctx context.Context, path, denom string, blockTime time.Time, useCache bool) (map[string]VestingInfo, error) {
+	vestingByAddr := make(map[string]VestingInfo)
+	records := readCachedRecords(ctx, filepath.Join(path, "auth_genesis.json"), "accounts", protoDecodeNext[codectypes.Any], useCache)
+	for any, err := range records {
+		if err != nil {
+			return nil, err
+		}
+		if !strings.Contains(any.GetTypeUrl(), "Vesting") && !strings.Contains(any.GetTypeUrl(), "PermanentLocked") {
+			continue
+		}
 		var acc authtypes.GenesisAccount
-		registry.UnpackAny(any, &acc)
-		if strings.Contains(genesis.Accounts[i].GetTypeUrl(), "Vesting") {
-			numVesting++
-			switch v := acc.(type) {
-			case *vestingtypes.ContinuousVestingAccount:
-				d := time.Unix(v.EndTime, 0)
-				if d.After(now) {
-					numStillVesting++
-					vestingAmt := v.GetVestingCoins(blocktime)
-					totalVesting = totalVesting.Add(vestingAmt...)
-					if vestingAmt.IsAllGT(highCap) {
-						numHighCap++
-						fmt.Println("CONT VEST", acc.GetAddress().String(), d, vestingAmt)
-					}
-				}
-			case *vestingtypes.DelayedVestingAccount:
-				d := time.Unix(v.EndTime, 0)
-				if d.After(now) {
-					numStillVesting++
-					totalVesting = totalVesting.Add(v.OriginalVesting...)
-					if v.OriginalVesting.IsAllGT(highCap) {
-						numHighCap++
-						fmt.Println("DEL VEST", acc.GetAddress().String(), d, v.OriginalVesting)
-					}
-				}
-			}
+		if err := registry.UnpackAny(&any, &acc); err != nil {
+			return nil, err
+		}
+		v, ok := acc.(vestexported.VestingAccount)
+		if !ok {
+			continue
+		}
+		info := VestingInfo{
+			OriginalVesting:  v.GetOriginalVesting().AmountOf(denom).ToLegacyDec(),
+			Vested:           v.GetVestedCoins(blockTime).AmountOf(denom).ToLegacyDec(),
+			DelegatedVesting: v.GetDelegatedVesting().AmountOf(denom).ToLegacyDec(),
 		}
+		if end := v.GetEndTime(); end != 0 {
+			info.EndTime = time.Unix(end, 0).UTC()
+		}
+		vestingByAddr[acc.GetAddress().String()] = info
 	}
-	fmt.Printf("%d/%d valid vesting accounts, total of %s freed\n", numStillVesting, numVesting, totalVesting)
-	fmt.Printf("%d vesting account(s) with more than %s vesting\n", numHighCap, highCap)
-	return nil
+	fmt.Printf("%s vesting accounts\n", h.Comma(int64(len(vestingByAddr))))
+	return vestingByAddr, nil
 }
 
-func parseVotesByAddr(path string) (map[string]govtypes.WeightedVoteOptions, error) {
-	f, err := os.Open(filepath.Join(path, "votes.json"))
+// analyzeVestingAccounts prints the stats of the vesting accounts of the
+// snapshot directory path, at the snapshot time.
+func analyzeVestingAccounts(ctx context.Context, path string) error {
+	const denom = "uatom"
+	var (
+		numStillVesting int
+		totalLocked     = math.LegacyZeroDec()
+		highCap         = math.LegacyNewDec(10000000000)
+		numHighCap      int
+	)
+	blockTime, err := snapshotTime(path)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer f.Close()
-	// XXX workaround to unmarshal votes because proto doesn't support top-level array
-	dec := json.NewDecoder(f)
-	_, err = dec.Token()
+	vestingByAddr, err := parseVestingByAddr(ctx, path, denom, blockTime, false)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	votesByAddr := make(map[string]govtypes.WeightedVoteOptions)
-	for dec.More() {
-		var vote govtypes.Vote
-		err := unmarshaler.UnmarshalNext(dec, &vote)
-		if err != nil {
-			return nil, err
+	for _, addr := range slices.Sorted(maps.Keys(vestingByAddr)) {
+		v := vestingByAddr[addr]
+		locked := v.locked()
+		if !locked.IsPositive() {
+			continue
+		}
+		numStillVesting++
+		totalLocked = totalLocked.Add(locked)
+		if locked.GT(highCap) {
+			numHighCap++
+			fmt.Println("VEST", addr, v.EndTime, locked.TruncateInt(), denom)
 		}
-		votesByAddr[vote.Voter] = vote.Options
 	}
-	fmt.Printf("%s votes\n", h.Comma(int64(len(votesByAddr))))
-	return votesByAddr, nil
+	fmt.Printf("%d/%d vesting accounts still vesting at %s, total of %s%s locked\n", numStillVesting,
+		len(vestingByAddr), blockTime, totalLocked.TruncateInt(), denom)
+	fmt.Printf("%d vesting account(s) with more than %s%s vesting\n", numHighCap, highCap.TruncateInt(), denom)
+	return nil
 }
 
-func parseDelegationsByAddr(path string) (map[string][]stakingtypes.Delegation, error) {
-	f, err := os.Open(filepath.Join(path, "delegations.json"))
+// parseVotesByAddr returns the final vote of each voter of the snapshot
+// directory path, see resolveVotes. The votes replaced by a later vote are
+// reported.
+func parseVotesByAddr(ctx context.Context, path string, useCache bool) (map[string]govtypes.WeightedVoteOptions, error) {
+	records, err := parseVoteRecords(ctx, path, useCache)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
-	var delegs []stakingtypes.Delegation
-	err = json.NewDecoder(f).Decode(&delegs)
-	if err != nil {
-		return nil, err
+	votes, overrides := resolveVotes(records)
+	printVoteOverrides(overrides)
+	votesByAddr := make(map[string]govtypes.WeightedVoteOptions, len(votes))
+	for addr, v := range votes {
+		votesByAddr[addr] = v.Options
 	}
-	delegsByAddr := make(map[string][]stakingtypes.Delegation)
-	for _, d := range delegs {
+	fmt.Printf("%s votes\n", h.Comma(int64(len(votesByAddr))))
+	return votesByAddr, nil
+}
+
+func parseDelegationsByAddr(ctx context.Context, path string, useCache bool) (map[string][]stakingtypes.Delegation, error) {
+	var (
+		delegsByAddr = make(map[string][]stakingtypes.Delegation)
+		numDelegs    int64
+	)
+	for d, err := range readCachedRecords(ctx, filepath.Join(path, "delegations.json"), "", jsonDecodeNext[stakingtypes.Delegation], useCache) {
+		if err != nil {
+			return nil, err
+		}
 		delegsByAddr[d.DelegatorAddress] = append(delegsByAddr[d.DelegatorAddress], d)
+		numDelegs++
 	}
-	fmt.Printf("%s delegations for %s delegators\n", h.Comma(int64(len(delegs))),
+	fmt.Printf("%s delegations for %s delegators\n", h.Comma(numDelegs),
 		h.Comma(int64(len(delegsByAddr))))
 	return delegsByAddr, nil
 }
 
-func parseValidatorsByAddr(path string, votesByAddr map[string]govtypes.WeightedVoteOptions) (map[string]govtypes.ValidatorGovInfo, error) {
-	f, err := os.Open(filepath.Join(path, "active_validators.json"))
-	if err != nil {
-		return nil, err
+// parseUnbondingsByAddr returns the unbonding delegations by delegator
+// address, or nil if the snapshot has no unbonding_delegations.json file.
+func parseUnbondingsByAddr(ctx context.Context, path string, useCache bool) (map[string][]stakingtypes.UnbondingDelegation, error) {
+	filename := filepath.Join(path, "unbonding_delegations.json")
+	if _, err := os.Stat(filename); errors.Is(err, fs.ErrNotExist) {
+		fmt.Println("unbonding_delegations.json not found, unbonding delegations are ignored")
+		return nil, nil
 	}
-	defer f.Close()
-	// XXX workaround to unmarshal validators because proto doesn't support top-level array
-	dec := json.NewDecoder(f)
-	_, err = dec.Token()
-	if err != nil {
-		return nil, err
+	var (
+		ubdsByAddr = make(map[string][]stakingtypes.UnbondingDelegation)
+		numUbds    int64
+	)
+	for ubd, err := range readCachedRecords(ctx, filename, "", protoDecodeNext[stakingtypes.UnbondingDelegation], useCache) {
+		if err != nil {
+			return nil, err
+		}
+		ubdsByAddr[ubd.DelegatorAddress] = append(ubdsByAddr[ubd.DelegatorAddress], ubd)
+		numUbds++
 	}
-	valsByAddr := make(map[string]govtypes.ValidatorGovInfo)
-	for dec.More() {
-		var val stakingtypes.Validator
-		err := unmarshaler.UnmarshalNext(dec, &val)
+	fmt.Printf("%s unbonding delegations for %s delegators\n", h.Comma(numUbds),
+		h.Comma(int64(len(ubdsByAddr))))
+	return ubdsByAddr, nil
+}
+
+// parseRedelegationsByAddr returns the redelegations by delegator address, or
+// nil if the snapshot has no redelegations.json file.
+func parseRedelegationsByAddr(ctx context.Context, path string, useCache bool) (map[string][]stakingtypes.Redelegation, error) {
+	filename := filepath.Join(path, "redelegations.json")
+	if _, err := os.Stat(filename); errors.Is(err, fs.ErrNotExist) {
+		fmt.Println("redelegations.json not found, redelegations are ignored")
+		return nil, nil
+	}
+	var (
+		redsByAddr = make(map[string][]stakingtypes.Redelegation)
+		numReds    int64
+	)
+	for red, err := range readCachedRecords(ctx, filename, "", protoDecodeNext[stakingtypes.Redelegation], useCache) {
 		if err != nil {
 			return nil, err
 		}
+		redsByAddr[red.DelegatorAddress] = append(redsByAddr[red.DelegatorAddress], red)
+		numReds++
+	}
+	fmt.Printf("%s redelegations for %s delegators\n", h.Comma(numReds),
+		h.Comma(int64(len(redsByAddr))))
+	return redsByAddr, nil
+}
+
+// parseValidatorsByAddr returns the active validators and their monikers, by
+// operator address.
+func parseValidatorsByAddr(ctx context.Context, path string, votesByAddr map[string]govtypes.WeightedVoteOptions, useCache bool) (map[string]govtypes.ValidatorGovInfo, map[string]string, error) {
+	var (
+		valsByAddr     = make(map[string]govtypes.ValidatorGovInfo)
+		monikersByAddr = make(map[string]string)
+	)
+	for val, err := range readCachedRecords(ctx, filepath.Join(path, "active_validators.json"), "", protoDecodeNext[stakingtypes.Validator], useCache) {
+		if err != nil {
+			return nil, nil, err
+		}
 
 		valAddr, err := sdk.ValAddressFromBech32(val.OperatorAddress)
 		if err != nil {
@@ -251,38 +321,18 @@ func parseValidatorsByAddr(path string, votesByAddr map[string]govtypes.Weighted
 			math.LegacyZeroDec(),
 			votesByAddr[accAddr],
 		)
+		monikersByAddr[val.OperatorAddress] = val.Description.Moniker
 	}
 	fmt.Printf("%d validators\n", len(valsByAddr))
-	return valsByAddr, nil
+	return valsByAddr, monikersByAddr, nil
 }
 
-func parseProp(path string) govtypes.Proposal {
-	f, err := os.Open(filepath.Join(path, "prop.json"))
-	if err != nil {
-		panic(err)
-	}
-	defer f.Close()
-	var prop govtypes.Proposal
-	err = unmarshaler.Unmarshal(f, &prop)
-	if err != nil {
-		panic(err)
-	}
-	return prop
-}
-
-func parseBalancesByAddr(path, denom string) (map[string]sdk.Coins, error) {
-	f, err := os.Open(filepath.Join(path, "balances.json"))
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-	var balances []banktypes.Balance
-	err = json.NewDecoder(f).Decode(&balances)
-	if err != nil {
-		return nil, err
-	}
+func parseBalancesByAddr(ctx context.Context, path, denom string, useCache bool) (map[string]sdk.Coins, error) {
 	balancesByAddr := make(map[string]sdk.Coins)
-	for _, b := range balances {
+	for b, err := range readCachedRecords(ctx, filepath.Join(path, "balances.json"), "", jsonDecodeNext[banktypes.Balance], useCache) {
+		if err != nil {
+			return nil, err
+		}
 		if denom == "" {
 			balancesByAddr[b.Address] = b.Coins
 		} else {
@@ -295,3 +345,83 @@ func parseBalancesByAddr(path, denom string) (map[string]sdk.Coins, error) {
 	fmt.Printf("%s account balances\n", h.Comma(int64(len(balancesByAddr))))
 	return balancesByAddr, nil
 }
+
+// readRecords returns an iterator over the elements of the JSON array stored in
+// the file at path, or in its top-level field key if key isn't empty. Elements
+// are decoded one by one with decodeNext while the file is read, so the raw
+// JSON of the file is never held in memory, only the element being decoded.
+// The memory used by the records themselves is up to the consumer: the parse
+// functions of this file collect them into maps, while the accounts command
+// streams the delegations and balances straight into the accounts (see
+// snapshotOptions.stream). The iteration stops with an error if ctx is done.
+func readRecords[T any](ctx context.Context, path, key string, decodeNext func(*json.Decoder, *T) error) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		f, err := os.Open(path)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		defer f.Close()
+		dec := json.NewDecoder(bufio.NewReader(f))
+		if key != "" {
+			if err := seekField(dec, key); err != nil {
+				yield(zero, fmt.Errorf("%s: %w", path, err))
+				return
+			}
+		}
+		if err := expectDelim(dec, '['); err != nil {
+			yield(zero, fmt.Errorf("%s: %w", path, err))
+			return
+		}
+		for dec.More() {
+			if err := ctx.Err(); err != nil {
+				yield(zero, err)
+				return
+			}
+			var v T
+			if err := decodeNext(dec, &v); err != nil {
+				yield(zero, fmt.Errorf("%s: %w", path, err))
+				return
+			}
+			if !yield(v, nil) {
+				return
+			}
+		}
+	}
+}
+
+// seekField moves dec to the value of the field key of the JSON object read by
+// dec.
+func seekField(dec *json.Decoder, key string) error {
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if t == key {
+			return nil
+		}
+		if err := skipValue(dec); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("field '%s' not found", key)
+}
+
+// jsonDecodeNext decodes the next value of dec into v using encoding/json.
+func jsonDecodeNext[T any](dec *json.Decoder, v *T) error {
+	return dec.Decode(v)
+}
+
+// protoDecodeNext decodes the next value of dec into v using the proto JSON
+// unmarshaler, which is required for types holding Any or enum fields.
+func protoDecodeNext[T any, PT interface {
+	*T
+	proto.Message
+}](dec *json.Decoder, v *T) error {
+	return unmarshaler.UnmarshalNext(dec, PT(v))
+}
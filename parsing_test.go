@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cosmossdk.io/math"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types/v1beta1"
+)
+
+func TestParseSnapshotFiles(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		datapath = t.TempDir()
+		accAddrs = createAccountAddrs(2)
+		accAddr1 = accAddrs[0].String()
+		accAddr2 = accAddrs[1].String()
+		valAddr  = createValidatorAddrs(1)[0]
+		// Validator account address
+		valAccAddr = sdk.AccAddress(valAddr).String()
+	)
+	writeFile := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(datapath, name), []byte(content), 0o644))
+	}
+	writeFile("votes.json", `[
+		{"proposal_id": "1", "voter": "`+accAddr1+`", "option": "VOTE_OPTION_YES",
+		 "options": [{"option": "VOTE_OPTION_YES", "weight": "1.000000000000000000"}]},
+		{"proposal_id": "1", "voter": "`+valAccAddr+`", "option": "VOTE_OPTION_NO",
+		 "options": [{"option": "VOTE_OPTION_NO", "weight": "1.000000000000000000"}]}
+	]`)
+	writeFile("delegations.json", `[
+		{"delegator_address": "`+accAddr1+`", "validator_address": "`+valAddr.String()+`", "shares": "10.000000000000000000"},
+		{"delegator_address": "`+accAddr1+`", "validator_address": "other", "shares": "5.000000000000000000"},
+		{"delegator_address": "`+accAddr2+`", "validator_address": "`+valAddr.String()+`", "shares": "20.000000000000000000"}
+	]`)
+	writeFile("active_validators.json", `[
+		{"operator_address": "`+valAddr.String()+`", "status": "BOND_STATUS_BONDED",
+		 "tokens": "60", "delegator_shares": "30.000000000000000000", "description": {"moniker": "val1"}}
+	]`)
+	writeFile("balances.json", `[
+		{"address": "`+accAddr1+`", "coins": [{"denom": "uatom", "amount": "100"}, {"denom": "uother", "amount": "1"}]},
+		{"address": "`+accAddr2+`", "coins": [{"denom": "uother", "amount": "2"}]}
+	]`)
+	writeFile("auth_genesis.json", `{
+		"params": {"max_memo_characters": "256"},
+		"accounts": [
+			{"@type": "/cosmos.auth.v1beta1.BaseAccount", "address": "`+accAddr1+`", "account_number": "1", "sequence": "0"},
+			{"@type": "/cosmos.vesting.v1beta1.DelayedVestingAccount",
+			 "base_vesting_account": {
+				"base_account": {"address": "`+accAddr2+`", "account_number": "2", "sequence": "0"},
+				"original_vesting": [{"denom": "uatom", "amount": "10"}],
+				"end_time": "1700000000"
+			 }}
+		]
+	}`)
+
+	votesByAddr, err := parseVotesByAddr(ctx, datapath, false)
+	require.NoError(t, err)
+	assert.Len(t, votesByAddr, 2)
+	assert.Equal(t, govtypes.OptionYes, votesByAddr[accAddr1][0].Option)
+	assert.Equal(t, govtypes.OptionNo, votesByAddr[valAccAddr][0].Option)
+
+	delegsByAddr, err := parseDelegationsByAddr(ctx, datapath, false)
+	require.NoError(t, err)
+	assert.Len(t, delegsByAddr, 2)
+	assert.Len(t, delegsByAddr[accAddr1], 2)
+	assert.Equal(t, math.LegacyNewDec(20), delegsByAddr[accAddr2][0].Shares)
+
+	valsByAddr, monikersByAddr, err := parseValidatorsByAddr(ctx, datapath, votesByAddr, false)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{valAddr.String(): "val1"}, monikersByAddr)
+	if assert.Contains(t, valsByAddr, valAddr.String()) {
+		val := valsByAddr[valAddr.String()]
+		assert.Equal(t, math.NewInt(60), val.BondedTokens)
+		assert.Equal(t, math.LegacyNewDec(30), val.DelegatorShares)
+		assert.Equal(t, govtypes.OptionNo, val.Vote[0].Option)
+	}
+
+	balancesByAddr, err := parseBalancesByAddr(ctx, datapath, "uatom", false)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]sdk.Coins{
+		accAddr1: sdk.NewCoins(sdk.NewInt64Coin("uatom", 100)),
+	}, balancesByAddr)
+
+	accountTypesByAddr, err := parseAccountTypesPerAddr(ctx, datapath, false)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		accAddr1: "/cosmos.auth.v1beta1.BaseAccount",
+		accAddr2: "/cosmos.vesting.v1beta1.DelayedVestingAccount",
+	}, accountTypesByAddr)
+
+	// unbonding_delegations.json and redelegations.json are optional
+	ubdsByAddr, err := parseUnbondingsByAddr(ctx, datapath, false)
+	require.NoError(t, err)
+	assert.Nil(t, ubdsByAddr)
+	redsByAddr, err := parseRedelegationsByAddr(ctx, datapath, false)
+	require.NoError(t, err)
+	assert.Nil(t, redsByAddr)
+
+	writeFile("unbonding_delegations.json", `[
+		{"delegator_address": "`+accAddr1+`", "validator_address": "`+valAddr.String()+`", "entries": [
+			{"creation_height": "10", "completion_time": "2024-01-01T00:00:00Z", "initial_balance": "8", "balance": "7",
+			 "unbonding_id": "1", "unbonding_on_hold_ref_count": "0"}
+		]}
+	]`)
+	writeFile("redelegations.json", `[
+		{"delegator_address": "`+accAddr2+`", "validator_src_address": "`+valAddr.String()+`", "validator_dst_address": "other", "entries": [
+			{"creation_height": "11", "completion_time": "2024-01-01T00:00:00Z", "initial_balance": "5", "shares_dst": "5.000000000000000000",
+			 "unbonding_id": "2", "unbonding_on_hold_ref_count": "0"}
+		]}
+	]`)
+	ubdsByAddr, err = parseUnbondingsByAddr(ctx, datapath, false)
+	require.NoError(t, err)
+	if assert.Len(t, ubdsByAddr[accAddr1], 1) {
+		assert.Equal(t, math.NewInt(7), ubdsByAddr[accAddr1][0].Entries[0].Balance)
+	}
+	redsByAddr, err = parseRedelegationsByAddr(ctx, datapath, false)
+	require.NoError(t, err)
+	if assert.Len(t, redsByAddr[accAddr2], 1) {
+		assert.Equal(t, "other", redsByAddr[accAddr2][0].ValidatorDstAddress)
+		assert.Equal(t, math.NewInt(5), redsByAddr[accAddr2][0].Entries[0].InitialBalance)
+	}
+
+	// The accounts built from streamed delegations and balances are the same
+	// as the ones built from the loaded maps
+	m, err := createManifest(datapath, 42, "1")
+	require.NoError(t, err)
+	require.NoError(t, m.write(datapath))
+	opts := snapshotOptions{
+		parts:   partVotes | partValidators | partDelegations | partBalances | partAccountTypes,
+		denom:   "uatom",
+		noCache: true,
+	}
+	snap, err := loadSnapshot(ctx, datapath, opts)
+	require.NoError(t, err)
+	accounts, err := getAccounts(ctx, snap, accountsOptions{})
+	require.NoError(t, err)
+	opts.stream = partDelegations | partBalances
+	streamedSnap, err := loadSnapshot(ctx, datapath, opts)
+	require.NoError(t, err)
+	assert.Nil(t, streamedSnap.DelegsByAddr)
+	assert.Nil(t, streamedSnap.BalancesByAddr)
+	streamedAccounts, err := getAccounts(ctx, streamedSnap, accountsOptions{})
+	require.NoError(t, err)
+	assert.Len(t, accounts, 2)
+	assert.Equal(t, accounts, streamedAccounts)
+}
+
+func TestParseVestingByAddr(t *testing.T) {
+	var (
+		datapath    = t.TempDir()
+		accAddrs    = createAccountAddrs(5)
+		blockTime   = time.Unix(1500, 0)
+		baseVesting = func(i int, original, delegatedVesting, endTime string) string {
+			return `"base_vesting_account": {
+				"base_account": {"address": "` + accAddrs[i].String() + `", "account_number": "` + strconv.Itoa(i) + `", "sequence": "0"},
+				"original_vesting": [{"denom": "uatom", "amount": "` + original + `"}, {"denom": "uother", "amount": "1"}],
+				"delegated_vesting": [{"denom": "uatom", "amount": "` + delegatedVesting + `"}],
+				"end_time": "` + endTime + `"
+			}`
+		}
+	)
+	require.NoError(t, os.WriteFile(filepath.Join(datapath, "auth_genesis.json"), []byte(`{
+		"accounts": [
+			{"@type": "/cosmos.auth.v1beta1.BaseAccount", "address": "`+accAddrs[0].String()+`", "account_number": "0", "sequence": "0"},
+			{"@type": "/cosmos.vesting.v1beta1.ContinuousVestingAccount", `+baseVesting(1, "100", "30", "2000")+`, "start_time": "1000"},
+			{"@type": "/cosmos.vesting.v1beta1.DelayedVestingAccount", `+baseVesting(2, "10", "0", "1700000000")+`},
+			{"@type": "/cosmos.vesting.v1beta1.PeriodicVestingAccount", `+baseVesting(3, "100", "0", "1600")+`, "start_time": "1000",
+			 "vesting_periods": [
+				{"length": "400", "amount": [{"denom": "uatom", "amount": "40"}]},
+				{"length": "200", "amount": [{"denom": "uatom", "amount": "60"}, {"denom": "uother", "amount": "1"}]}
+			 ]},
+			{"@type": "/cosmos.vesting.v1beta1.PermanentLockedAccount", `+baseVesting(4, "50", "50", "0")+`}
+		]
+	}`), 0o644))
+
+	vestingByAddr, err := parseVestingByAddr(context.Background(), datapath, "uatom", blockTime, false)
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]VestingInfo{
+		accAddrs[1].String(): {
+			OriginalVesting:  math.LegacyNewDec(100),
+			Vested:           math.LegacyNewDec(50),
+			DelegatedVesting: math.LegacyNewDec(30),
+			EndTime:          time.Unix(2000, 0).UTC(),
+		},
+		accAddrs[2].String(): {
+			OriginalVesting:  math.LegacyNewDec(10),
+			Vested:           math.LegacyZeroDec(),
+			DelegatedVesting: math.LegacyZeroDec(),
+			EndTime:          time.Unix(1700000000, 0).UTC(),
+		},
+		accAddrs[3].String(): {
+			OriginalVesting:  math.LegacyNewDec(100),
+			Vested:           math.LegacyNewDec(40),
+			DelegatedVesting: math.LegacyZeroDec(),
+			EndTime:          time.Unix(1600, 0).UTC(),
+		},
+		accAddrs[4].String(): {
+			OriginalVesting:  math.LegacyNewDec(50),
+			Vested:           math.LegacyZeroDec(),
+			DelegatedVesting: math.LegacyNewDec(50),
+		},
+	}, vestingByAddr)
+}
+
+func TestLoadSnapshotErrors(t *testing.T) {
+	datapath := t.TempDir()
+	writeFile := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(datapath, name), []byte(content), 0o644))
+	}
+	writeFile("votes.json", `[{"voter": "addr1", "option": "VOTE_OPTION_YES"}]`)
+	writeFile("delegations.json", `[{"delegator_address": "addr1", "validator_address": "val1", "shares": "1"}]`)
+	writeManifest := func() {
+		m, err := createManifest(datapath, 42, "1")
+		require.NoError(t, err)
+		require.NoError(t, m.write(datapath))
+	}
+	writeManifest()
+	opts := snapshotOptions{parts: partVotes | partDelegations, noCache: true}
+	// noGoroutineLeft returns a function checking that the goroutines started
+	// since its call have ended. It must be called in the subtest, which runs
+	// in its own goroutine.
+	noGoroutineLeft := func(t *testing.T) func() {
+		goroutines := runtime.NumGoroutine()
+		return func() {
+			assert.Eventually(t, func() bool { return runtime.NumGoroutine() <= goroutines },
+				time.Second, 10*time.Millisecond, "goroutines left running")
+		}
+	}
+
+	t.Run("parent context canceled", func(t *testing.T) {
+		checkGoroutines := noGoroutineLeft(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := loadSnapshot(ctx, datapath, opts)
+
+		require.ErrorIs(t, err, context.Canceled)
+		checkGoroutines()
+	})
+
+	t.Run("two corrupt files", func(t *testing.T) {
+		// Both files fail before their first record, so neither error is
+		// hidden by the cancellation triggered by the other.
+		checkGoroutines := noGoroutineLeft(t)
+		writeFile("votes.json", `{"votes": []}`)
+		writeFile("delegations.json", `"corrupt"`)
+		writeManifest()
+
+		_, err := loadSnapshot(context.Background(), datapath, opts)
+
+		require.Error(t, err)
+		assert.ErrorContains(t, err, filepath.Join(datapath, "votes.json"))
+		assert.ErrorContains(t, err, filepath.Join(datapath, "delegations.json"))
+		if joined, ok := err.(interface{ Unwrap() []error }); assert.True(t, ok, "errors must be joined") {
+			assert.Len(t, joined.Unwrap(), 2)
+		}
+		checkGoroutines()
+	})
+}
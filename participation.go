@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+
+	"cosmossdk.io/math"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types/v1beta1"
+)
+
+// participationScore is the governance participation of an account over
+// several proposals.
+type participationScore struct {
+	Address      string
+	StakedAmount math.LegacyDec
+	Proposals    int
+	DirectVotes  int
+	// DirectRate is the share of the proposals the account voted on.
+	DirectRate math.LegacyDec
+	// InheritedRate is the average share of the stake of the account that
+	// voted through its validators, on the proposals the account didn't vote
+	// on, over all the proposals.
+	InheritedRate math.LegacyDec
+	// Consistency is the average similarity (between 0 and 1) between the vote
+	// of the account and the vote of its validators, on the proposals both
+	// voted on. Compared is the number of these proposals, Consistency is
+	// meaningless if it is 0.
+	Consistency math.LegacyDec
+	Compared    int
+}
+
+// computeParticipation returns the participation scores of the accounts of
+// snap, over the proposals of votesByProp (the votes of each proposal by
+// voter address), sorted by address.
+func computeParticipation(ctx context.Context, snap *Snapshot, votesByProp []map[string]govtypes.WeightedVoteOptions) ([]participationScore, error) {
+	scoresByAddr := make(map[string]*participationScore)
+	for _, votes := range votesByProp {
+		propSnap := *snap
+		propSnap.VotesByAddr = votes
+		// Set the validator votes of the proposal
+		propSnap.ValsByAddr = maps.Clone(snap.ValsByAddr)
+		for addr, val := range propSnap.ValsByAddr {
+			val.Vote = votes[sdk.AccAddress(val.Address).String()]
+			propSnap.ValsByAddr[addr] = val
+		}
+		accounts, err := getAccounts(ctx, &propSnap, accountsOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, acc := range accounts {
+			s, ok := scoresByAddr[acc.Address]
+			if !ok {
+				s = &participationScore{
+					Address:       acc.Address,
+					StakedAmount:  acc.StakedAmount,
+					InheritedRate: math.LegacyZeroDec(),
+					Consistency:   math.LegacyZeroDec(),
+				}
+				scoresByAddr[acc.Address] = s
+			}
+			s.Proposals++
+			if len(acc.Vote) == 0 {
+				// voteWeights holds the delegated votes
+				s.InheritedRate = s.InheritedRate.Add(math.LegacyOneDec().Sub(acc.voteWeights()[govtypes.OptionEmpty]))
+				continue
+			}
+			s.DirectVotes++
+			if valVotes, ok := validatorsVoteWeights(acc); ok {
+				s.Consistency = s.Consistency.Add(voteSimilarity(acc.voteWeights(), valVotes))
+				s.Compared++
+			}
+		}
+	}
+	scores := make([]participationScore, 0, len(scoresByAddr))
+	for _, addr := range slices.Sorted(maps.Keys(scoresByAddr)) {
+		s := scoresByAddr[addr]
+		s.DirectRate = math.LegacyNewDec(int64(s.DirectVotes)).QuoInt64(int64(s.Proposals))
+		s.InheritedRate = s.InheritedRate.QuoInt64(int64(s.Proposals))
+		if s.Compared > 0 {
+			s.Consistency = s.Consistency.QuoInt64(int64(s.Compared))
+		}
+		scores = append(scores, *s)
+	}
+	return scores, nil
+}
+
+// validatorsVoteWeights returns the votes of the validators of a, weighted by
+// the amount delegated to each validator that voted. ok is false if none of
+// the validators of a voted.
+func validatorsVoteWeights(a Account) (v voteMap, ok bool) {
+	var (
+		votes = newVoteMap()
+		total = math.LegacyZeroDec()
+	)
+	for _, del := range a.Delegations {
+		if len(del.Vote) == 0 {
+			continue
+		}
+		for _, vote := range del.Vote {
+			votes.add(vote.Option, vote.Weight.Mul(del.Amount))
+		}
+		total = total.Add(del.Amount)
+	}
+	if !total.IsPositive() {
+		return nil, false
+	}
+	for o, w := range votes {
+		votes[o] = w.Quo(total)
+	}
+	return votes, true
+}
+
+// voteSimilarity returns the overlap of the vote weights a and b, 1 if they
+// are identical and 0 if they have no option in common.
+func voteSimilarity(a, b voteMap) math.LegacyDec {
+	sim := math.LegacyZeroDec()
+	for _, o := range allVoteOptions {
+		if o == govtypes.OptionEmpty {
+			continue
+		}
+		sim = sim.Add(math.LegacyMinDec(a[o], b[o]))
+	}
+	return sim
+}
+
+// writeParticipationCSV writes scores into the CSV file at path.
+func writeParticipationCSV(path string, scores []participationScore) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	w.Write([]string{
+		"address", "stakedAmount", "proposals", "directVotes", "directRate",
+		"inheritedRate", "consistency", "consistencyProposals",
+	})
+	for _, s := range scores {
+		consistency := ""
+		if s.Compared > 0 {
+			consistency = s.Consistency.String()
+		}
+		w.Write([]string{
+			s.Address, s.StakedAmount.TruncateInt().String(), strconv.Itoa(s.Proposals), strconv.Itoa(s.DirectVotes),
+			s.DirectRate.String(), s.InheritedRate.String(), consistency, strconv.Itoa(s.Compared),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	fmt.Printf("%s file created.\n", path)
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cosmossdk.io/math"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types/v1beta1"
+	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
+)
+
+func TestComputeParticipation(t *testing.T) {
+	var (
+		accAddrs   = createAccountAddrs(2)
+		valAddr    = createValidatorAddrs(1)[0]
+		valAccAddr = sdk.AccAddress(valAddr).String()
+		newDeleg   = func(i int, shares int64) []stakingtypes.Delegation {
+			return []stakingtypes.Delegation{{
+				DelegatorAddress: accAddrs[i].String(),
+				ValidatorAddress: valAddr.String(),
+				Shares:           math.LegacyNewDec(shares),
+			}}
+		}
+		snap = &Snapshot{
+			ValsByAddr: map[string]govtypes.ValidatorGovInfo{
+				valAddr.String(): govtypes.NewValidatorGovInfo(valAddr, math.NewInt(40),
+					math.LegacyNewDec(40), math.LegacyZeroDec(), nil),
+			},
+			DelegsByAddr: map[string][]stakingtypes.Delegation{
+				accAddrs[0].String(): newDeleg(0, 10),
+				accAddrs[1].String(): newDeleg(1, 30),
+			},
+		}
+		yes         = govtypes.NewNonSplitVoteOption(govtypes.OptionYes)
+		no          = govtypes.NewNonSplitVoteOption(govtypes.OptionNo)
+		votesByProp = []map[string]govtypes.WeightedVoteOptions{
+			// accAddrs[0] votes like the validator
+			{valAccAddr: yes, accAddrs[0].String(): yes},
+			// accAddrs[0] votes against the validator
+			{valAccAddr: yes, accAddrs[0].String(): no},
+			// the validator doesn't vote
+			{accAddrs[0].String(): yes},
+		}
+	)
+
+	scores, err := computeParticipation(context.Background(), snap, votesByProp)
+	require.NoError(t, err)
+
+	expected := map[string]participationScore{
+		accAddrs[0].String(): {
+			Address:       accAddrs[0].String(),
+			StakedAmount:  math.LegacyNewDec(10),
+			Proposals:     3,
+			DirectVotes:   3,
+			DirectRate:    math.LegacyOneDec(),
+			InheritedRate: math.LegacyZeroDec(),
+			Consistency:   math.LegacyNewDecWithPrec(5, 1),
+			Compared:      2,
+		},
+		accAddrs[1].String(): {
+			Address:       accAddrs[1].String(),
+			StakedAmount:  math.LegacyNewDec(30),
+			Proposals:     3,
+			DirectVotes:   0,
+			DirectRate:    math.LegacyZeroDec(),
+			InheritedRate: math.LegacyNewDec(2).QuoInt64(3),
+			Consistency:   math.LegacyZeroDec(),
+			Compared:      0,
+		},
+	}
+	require.Len(t, scores, len(expected))
+	for _, s := range scores {
+		assert.Equal(t, expected[s.Address], s, s.Address)
+	}
+	assert.Less(t, scores[0].Address, scores[1].Address)
+	// The validator vote is not set on the snapshot
+	assert.Empty(t, snap.ValsByAddr[valAddr.String()].Vote)
+
+	csvFile := filepath.Join(t.TempDir(), "participation.csv")
+	require.NoError(t, writeParticipationCSV(csvFile, scores))
+	bz, err := os.ReadFile(csvFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(bz), accAddrs[0].String()+",10,3,3,1.000000000000000000,0.000000000000000000,0.500000000000000000,2\n")
+	assert.Contains(t, string(bz), accAddrs[1].String()+",30,3,0,0.000000000000000000,0.666666666666666666,,0\n")
+}
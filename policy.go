@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"sigs.k8s.io/yaml"
+
+	"cosmossdk.io/math"
+)
+
+// policyVersion is the version of the distribution policy file format.
+// Version 1 describes the GovGen PROP 001 buckets with their multipliers,
+// version 2 describes arbitrary buckets.
+const policyVersion = 2
+
+// distriPolicy is the content of a distribution policy file, which describes
+// the distriParams. Numbers can be given as strings to avoid the rounding of
+// the YAML and JSON parsers.
+type distriPolicy struct {
+	Version int `json:"version"`
+	// Description is free text, like the proposal that adopted the policy.
+	Description string `json:"description,omitempty"`
+	// Version 1 fields, see prop001Buckets.
+	YesVotesMultiplier json.Number `json:"yes_votes_multiplier,omitempty"`
+	NoVotesMultiplier  json.Number `json:"no_votes_multiplier,omitempty"`
+	// Bonus applies to NoWithVeto votes.
+	Bonus json.Number `json:"bonus,omitempty"`
+	// Malus applies to the accounts that didn't vote and to liquid amounts.
+	Malus               json.Number `json:"malus,omitempty"`
+	TargetNonVotersPerc json.Number `json:"target_non_voters_percent,omitempty"`
+	// Version 2 fields
+	Buckets []policyBucket `json:"buckets,omitempty"`
+	// Targets holds the shares of the airdrop of the normalization targets.
+	Targets map[string]json.Number `json:"normalization_targets,omitempty"`
+
+	SupplyFactor       json.Number `json:"supply_factor"`
+	SupplyMintFactor   json.Number `json:"supply_mint_factor"`
+	CommunityPoolShare json.Number `json:"community_pool_share"`
+	// AccountCap is optional, the airdrop of an account isn't capped if empty.
+	AccountCap json.Number `json:"account_cap,omitempty"`
+}
+
+// policyBucket describes a bucket in a policy file.
+type policyBucket struct {
+	Name string `json:"name"`
+	// Source is staked or liquid.
+	Source string `json:"source"`
+	// Options are vote options (yes, no, no_with_veto, abstain or
+	// did_not_vote) selecting a part of the staked amount.
+	Options []string `json:"options,omitempty"`
+	// Multiplier is exclusive with Target.
+	Multiplier json.Number `json:"multiplier,omitempty"`
+	// BonusMalus defaults to 1.
+	BonusMalus json.Number `json:"bonus_malus,omitempty"`
+	Target     string      `json:"target,omitempty"`
+}
+
+// loadDistriPolicy reads the distribution policy file at path, in YAML or
+// JSON. It returns defaultDistriParams if path is empty.
+func loadDistriPolicy(path string) (distriParams, error) {
+	if path == "" {
+		return defaultDistriParams(), nil
+	}
+	bz, err := os.ReadFile(path)
+	if err != nil {
+		return distriParams{}, err
+	}
+	// JSON is valid YAML
+	bz, err = yaml.YAMLToJSON(bz)
+	if err != nil {
+		return distriParams{}, fmt.Errorf("%s: %w", path, err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(bz))
+	dec.DisallowUnknownFields()
+	var policy distriPolicy
+	if err := dec.Decode(&policy); err != nil {
+		return distriParams{}, fmt.Errorf("%s: %w", path, err)
+	}
+	params, err := policy.params()
+	if err != nil {
+		return distriParams{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return params, nil
+}
+
+// params returns the distriParams described by p.
+func (p distriPolicy) params() (distriParams, error) {
+	var (
+		params distriParams
+		errs   []error
+	)
+	dec := func(name string, n json.Number) math.LegacyDec {
+		if n == "" {
+			errs = append(errs, fmt.Errorf("missing %s", name))
+			return math.LegacyDec{}
+		}
+		d, err := math.LegacyNewDecFromStr(n.String())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s: %w", name, err))
+			return math.LegacyDec{}
+		}
+		if d.IsNegative() {
+			errs = append(errs, fmt.Errorf("negative %s", name))
+		}
+		return d
+	}
+	switch p.Version {
+	case 1:
+		if len(p.Buckets) > 0 || len(p.Targets) > 0 {
+			return distriParams{}, errors.New("buckets and normalization_targets require version 2")
+		}
+		params.buckets = prop001Buckets(
+			dec("yes_votes_multiplier", p.YesVotesMultiplier),
+			dec("no_votes_multiplier", p.NoVotesMultiplier),
+			dec("bonus", p.Bonus),
+			dec("malus", p.Malus),
+		)
+		params.targets = map[string]math.LegacyDec{
+			"non_voters": dec("target_non_voters_percent", p.TargetNonVotersPerc),
+		}
+	case 2:
+		if p.YesVotesMultiplier != "" || p.NoVotesMultiplier != "" || p.Bonus != "" || p.Malus != "" || p.TargetNonVotersPerc != "" {
+			return distriParams{}, errors.New("version 1 multipliers are replaced by buckets in version 2")
+		}
+		for i, pb := range p.Buckets {
+			b := bucket{
+				Name:       pb.Name,
+				Select:     bucketSelector{Source: bucketSource(pb.Source)},
+				BonusMalus: math.LegacyOneDec(),
+				Target:     pb.Target,
+			}
+			field := fmt.Sprintf("buckets[%d]", i)
+			for _, name := range pb.Options {
+				o, err := parseBucketOption(name)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", field, err))
+				}
+				b.Select.Options = append(b.Select.Options, o)
+			}
+			if pb.Multiplier != "" {
+				b.Multiplier = dec(field+".multiplier", pb.Multiplier)
+			}
+			if pb.BonusMalus != "" {
+				b.BonusMalus = dec(field+".bonus_malus", pb.BonusMalus)
+			}
+			params.buckets = append(params.buckets, b)
+		}
+		params.targets = make(map[string]math.LegacyDec, len(p.Targets))
+		for name, share := range p.Targets {
+			params.targets[name] = dec("normalization_targets."+name, share)
+		}
+	default:
+		return distriParams{}, fmt.Errorf("unsupported policy version %d, expected 1 or %d", p.Version, policyVersion)
+	}
+	params.supplyFactor = dec("supply_factor", p.SupplyFactor)
+	params.supplyMintFactor = dec("supply_mint_factor", p.SupplyMintFactor)
+	params.communityPoolShare = dec("community_pool_share", p.CommunityPoolShare)
+	if p.AccountCap != "" {
+		accountCap, ok := math.NewIntFromString(p.AccountCap.String())
+		if !ok || !accountCap.IsPositive() {
+			errs = append(errs, fmt.Errorf("invalid account_cap '%s', expected a positive integer", p.AccountCap))
+		}
+		params.accountCap = accountCap
+	}
+	if len(errs) > 0 {
+		return distriParams{}, errors.Join(errs...)
+	}
+	if err := validateBuckets(params.buckets, params.targets); err != nil {
+		return distriParams{}, err
+	}
+	if params.communityPoolShare.GT(math.LegacyOneDec()) {
+		return distriParams{}, errors.New("community_pool_share must be between 0 and 1")
+	}
+	return params, nil
+}
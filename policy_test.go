@@ -0,0 +1,244 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cosmossdk.io/math"
+
+	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types/v1beta1"
+)
+
+func TestLoadDistriPolicy(t *testing.T) {
+	const validPolicy = `{
+		"version": 1,
+		"yes_votes_multiplier": 2,
+		"no_votes_multiplier": "8",
+		"bonus": "1.1",
+		"malus": "0.9",
+		"supply_factor": "1",
+		"supply_mint_factor": "0.2",
+		"target_non_voters_percent": "0.25",
+		"community_pool_share": "0.75",
+		"account_cap": "1000"
+	}`
+	tests := []struct {
+		name           string
+		content        string
+		expectedParams distriParams
+		expectedError  string
+	}{
+		{
+			name:    "json",
+			content: validPolicy,
+			expectedParams: distriParams{
+				buckets: prop001Buckets(math.LegacyNewDec(2), math.LegacyNewDec(8),
+					math.LegacyNewDecWithPrec(11, 1), math.LegacyNewDecWithPrec(9, 1)),
+				targets:            map[string]math.LegacyDec{"non_voters": math.LegacyNewDecWithPrec(25, 2)},
+				supplyFactor:       math.LegacyOneDec(),
+				supplyMintFactor:   math.LegacyNewDecWithPrec(2, 1),
+				communityPoolShare: math.LegacyNewDecWithPrec(75, 2),
+				accountCap:         math.NewInt(1000),
+			},
+		},
+		{
+			name: "buckets",
+			content: `version: 2
+buckets:
+- name: voters
+  source: staked
+  options: ["yes", "no", no_with_veto]
+  multiplier: 2
+- name: others
+  source: staked
+  options: [abstain, did_not_vote]
+  bonus_malus: "0.5"
+  target: rest
+- name: liquid
+  source: liquid
+  multiplier: 0
+normalization_targets:
+  rest: "0.2"
+supply_factor: 1
+supply_mint_factor: 0
+community_pool_share: 1
+`,
+			expectedParams: distriParams{
+				buckets: []bucket{
+					{
+						Name: "voters",
+						Select: bucketSelector{Source: sourceStaked, Options: []govtypes.VoteOption{
+							govtypes.OptionYes, govtypes.OptionNo, govtypes.OptionNoWithVeto,
+						}},
+						Multiplier: math.LegacyNewDec(2),
+						BonusMalus: math.LegacyOneDec(),
+					},
+					{
+						Name: "others",
+						Select: bucketSelector{Source: sourceStaked, Options: []govtypes.VoteOption{
+							govtypes.OptionAbstain, govtypes.OptionEmpty,
+						}},
+						BonusMalus: math.LegacyNewDecWithPrec(5, 1),
+						Target:     "rest",
+					},
+					{
+						Name:       "liquid",
+						Select:     bucketSelector{Source: sourceLiquid},
+						Multiplier: math.LegacyZeroDec(),
+						BonusMalus: math.LegacyOneDec(),
+					},
+				},
+				targets:            map[string]math.LegacyDec{"rest": math.LegacyNewDecWithPrec(2, 1)},
+				supplyFactor:       math.LegacyOneDec(),
+				supplyMintFactor:   math.LegacyZeroDec(),
+				communityPoolShare: math.LegacyOneDec(),
+			},
+		},
+		{
+			name:          "unsupported version",
+			content:       "version: 3\n",
+			expectedError: "unsupported policy version 3, expected 1 or 2",
+		},
+		{
+			name:          "version 1 field in version 2",
+			content:       "version: 2\nbonus: 1\n",
+			expectedError: "version 1 multipliers are replaced by buckets in version 2",
+		},
+		{
+			name: "invalid bucket",
+			content: `version: 2
+buckets:
+- name: liquid
+  source: liquid
+  options: ["yes"]
+  multiplier: 1
+supply_factor: 1
+supply_mint_factor: 0
+community_pool_share: 1
+`,
+			expectedError: "bucket 'liquid': vote options require the staked source",
+		},
+		{
+			name: "unknown target",
+			content: `version: 2
+buckets:
+- name: all
+  source: staked
+  target: rest
+supply_factor: 1
+supply_mint_factor: 0
+community_pool_share: 1
+`,
+			expectedError: "bucket 'all': unknown target 'rest'",
+		},
+		{
+			name:          "unknown field",
+			content:       "version: 1\nfoo: 1\n",
+			expectedError: `unknown field "foo"`,
+		},
+		{
+			name:          "invalid number",
+			content:       "version: 1\nbonus: x\n",
+			expectedError: `cannot unmarshal string "x"`,
+		},
+		{
+			name:          "invalid decimal",
+			content:       "version: 1\nyes_votes_multiplier: 1\nno_votes_multiplier: 9\nbonus: \"1e3\"\n",
+			expectedError: "invalid bonus",
+		},
+		{
+			name:          "missing malus",
+			content:       "version: 1\nyes_votes_multiplier: 1\n",
+			expectedError: "missing malus",
+		},
+		{
+			name: "invalid target",
+			content: `version: 1
+yes_votes_multiplier: 1
+no_votes_multiplier: 9
+bonus: 1
+malus: 1
+supply_factor: 1
+supply_mint_factor: 0
+target_non_voters_percent: 1
+community_pool_share: 0.5
+`,
+			expectedError: "targets require buckets with a fixed multiplier and must sum below 1",
+		},
+		{
+			name: "invalid account cap",
+			content: `version: 1
+yes_votes_multiplier: 1
+no_votes_multiplier: 9
+bonus: 1
+malus: 1
+supply_factor: 1
+supply_mint_factor: 0
+target_non_voters_percent: 0.5
+community_pool_share: 0.5
+account_cap: 1.5
+`,
+			expectedError: "invalid account_cap '1.5', expected a positive integer",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "policy.yaml")
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0o666))
+
+			params, err := loadDistriPolicy(path)
+
+			if tt.expectedError != "" {
+				require.ErrorContains(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedParams, params)
+		})
+	}
+}
+
+func TestLoadDistriPolicyDefault(t *testing.T) {
+	// distribution_policy.yaml must describe defaultDistriParams
+	params, err := loadDistriPolicy("distribution_policy.yaml")
+
+	require.NoError(t, err)
+	assert.Equal(t, defaultDistriParams(), params)
+}
+
+func TestDistributionPolicy(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	var (
+		accounts = []Account{
+			{Address: "liquid", LiquidAmount: math.LegacyNewDec(100), StakedAmount: math.LegacyZeroDec()},
+			{Address: "whale", LiquidAmount: math.LegacyZeroDec(), StakedAmount: math.LegacyNewDec(900), Vote: govtypes.NewNonSplitVoteOption(govtypes.OptionYes)},
+		}
+		params = defaultDistriParams()
+	)
+	params.supplyFactor = math.LegacyOneDec()
+	params.targets = map[string]math.LegacyDec{"non_voters": math.LegacyNewDecWithPrec(5, 1)}
+	params.communityPoolShare = math.LegacyNewDecWithPrec(25, 2)
+	params.accountCap = math.NewInt(500)
+
+	airdrop, err := distribution(accounts, params, "", defaultRules())
+
+	require.NoError(err)
+	// non_voters multiplier = 0.5 x 900 / (0.5 x 100)
+	assert.Equal(math.LegacyNewDec(9), airdrop.targetMultipliers["non_voters"])
+	assert.Equal(math.NewInt(500), airdrop.addresses["whale"])
+	// 100 x 9 x malus, capped
+	assert.Equal(math.NewInt(500), airdrop.addresses["liquid"])
+	assert.Equal(2, airdrop.atomConcentration.Holders)
+	assert.Equal(2, airdrop.atoneConcentration.Holders)
+	// Both airdrops are capped to 500, under the dust threshold
+	assert.Equal(2, airdrop.atoneConcentration.Nakamoto)
+	assert.Equal(2, airdrop.atoneConcentration.Dust)
+	minted := airdrop.atone.supply.Mul(params.supplyMintFactor)
+	assert.Equal(minted.Mul(params.communityPoolShare), airdrop.communityPool)
+	assert.Equal(minted.Mul(math.LegacyNewDecWithPrec(75, 2)), airdrop.reservedAddr)
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"cosmossdk.io/math"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+)
+
+// icfWallets is the list of the ICF wallets, slashed by the default rules.
+var icfWallets = []string{
+	// Source https://github.com/gnolang/bounties/issues/18#issuecomment-1034700230
+	"cosmos1z8mzakma7vnaajysmtkwt4wgjqr2m84tzvyfkz",
+	"cosmos1unc788q8md2jymsns24eyhua58palg5kc7cstv",
+	// The 2 addresses above have been emptied in favour of the following 2
+	"cosmos1sufkm72dw7ua9crpfhhp0dqpyuggtlhdse98e7",
+	"cosmos1z6czaavlk6kjd48rpf58kqqw9ssad2uaxnazgl",
+	// From other investigations
+	"cosmos17u903qxqc6dzn3chvmc9zzp9fl4xja0pwggfj7",
+}
+
+// ruleAction is the action applied to the accounts matched by a rule.
+type ruleAction string
+
+const (
+	// actionExclude ignores the account, as if it didn't exist.
+	actionExclude ruleAction = "exclude"
+	// actionSlash keeps the account in the $ATOM stats, but it doesn't get
+	// any airdrop.
+	actionSlash ruleAction = "slash"
+	// actionCap limits the airdrop of the account to the rule Cap.
+	actionCap ruleAction = "cap"
+	// actionRedirect sends the airdrop of the account to the rule RedirectTo.
+	actionRedirect ruleAction = "redirect"
+)
+
+var ruleActions = []ruleAction{actionExclude, actionSlash, actionCap, actionRedirect}
+
+// rule matches accounts by address, by type or by label category, and applies
+// Action to them.
+// Exclusions are applied when the accounts are built (accounts and
+// gno-accounts commands), the other actions when the airdrop is computed
+// (distribution, genesis and gno-accounts commands).
+// Rules are first-match: an account matched by several rules (for instance by
+// its type and by its label category) only gets the first of them, so a cap
+// listed before an exclusion keeps the account. An address can't be listed in
+// several rules.
+type rule struct {
+	Addresses []string `json:"addresses,omitempty"`
+	// AddressLists are files holding one address per line (empty lines and
+	// lines starting with # are ignored), relative to the rules file.
+	AddressLists []string `json:"address_lists,omitempty"`
+	// Types are account type URLs, like /cosmos.auth.v1beta1.ModuleAccount.
+	Types []string `json:"types,omitempty"`
+	// Categories are label categories, see labelRegistry.
+	Categories []labelCategory `json:"categories,omitempty"`
+	Action     ruleAction      `json:"action"`
+	// Cap is required by the cap action.
+	Cap *math.Int `json:"cap,omitempty"`
+	// RedirectTo is required by the redirect action.
+	RedirectTo string `json:"redirect_to,omitempty"`
+	// Reason is reported in the audit log.
+	Reason string `json:"reason"`
+
+	// addrs holds Addresses and the addresses of AddressLists.
+	addrs map[string]bool
+}
+
+func (r rule) matches(addr, accType string, category labelCategory) bool {
+	return r.addrs[addr] || (accType != "" && slices.Contains(r.Types, accType)) ||
+		(category != "" && slices.Contains(r.Categories, category))
+}
+
+// accountRules is the list of rules loaded from a rules file, with the audit
+// log of the rules applied.
+type accountRules struct {
+	Rules []rule `json:"rules"`
+
+	// labels gives the categories of the addresses, matched by the rule
+	// Categories.
+	labels labelRegistry
+	audit  map[string]auditEntry
+}
+
+// auditEntry records a rule applied to an account.
+type auditEntry struct {
+	Address string
+	Type    string
+	Action  ruleAction
+	Reason  string
+	// Amount is the amount affected by the rule, empty for exclusions.
+	Amount string
+}
+
+// moduleAccountsRule excludes the module and interchain accounts.
+var moduleAccountsRule = rule{
+	Types: []string{
+		"/cosmos.auth.v1beta1.ModuleAccount",
+		"/ibc.applications.interchain_accounts.v1.InterchainAccount",
+	},
+	Action: actionExclude,
+	Reason: "module and interchain accounts",
+}
+
+// defaultRules returns the rules used when no rules file is given: module and
+// interchain accounts are excluded, and the ICF wallets are slashed.
+func defaultRules() *accountRules {
+	return newAccountRules(
+		moduleAccountsRule,
+		rule{
+			Addresses: icfWallets,
+			Action:    actionSlash,
+			Reason:    "ICF wallets",
+		},
+	)
+}
+
+// defaultGnoRules returns the rules used by gno-accounts when no rules file is
+// given: only module and interchain accounts are excluded. Unlike
+// defaultRules, the ICF wallets are kept.
+func defaultGnoRules() *accountRules {
+	return newAccountRules(moduleAccountsRule)
+}
+
+// newAccountRules returns the accountRules of rs, with their addresses
+// indexed.
+func newAccountRules(rs ...rule) *accountRules {
+	rules := &accountRules{Rules: slices.Clone(rs)}
+	for i := range rules.Rules {
+		rules.Rules[i].addrs = make(map[string]bool)
+		for _, addr := range rules.Rules[i].Addresses {
+			rules.Rules[i].addrs[addr] = true
+		}
+	}
+	return rules
+}
+
+// loadRules reads the rules file at path, in YAML or JSON. It returns the
+// default rules if path is empty.
+func loadRules(path string) (*accountRules, error) {
+	if path == "" {
+		return defaultRules(), nil
+	}
+	bz, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// JSON is valid YAML
+	bz, err = yaml.YAMLToJSON(bz)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(bz))
+	dec.DisallowUnknownFields()
+	var rules accountRules
+	if err := dec.Decode(&rules); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	// rule numbers by address, to reject the addresses of several rules
+	ruleByAddr := make(map[string]int)
+	for i := range rules.Rules {
+		r := &rules.Rules[i]
+		if err := r.validate(); err != nil {
+			return nil, fmt.Errorf("%s: rule #%d: %w", path, i+1, err)
+		}
+		r.addrs = make(map[string]bool)
+		for _, addr := range r.Addresses {
+			r.addrs[addr] = true
+		}
+		for _, list := range r.AddressLists {
+			if !filepath.IsAbs(list) {
+				list = filepath.Join(filepath.Dir(path), list)
+			}
+			if err := readAddressList(list, r.addrs); err != nil {
+				return nil, fmt.Errorf("%s: rule #%d: %w", path, i+1, err)
+			}
+		}
+		for _, addr := range slices.Sorted(maps.Keys(r.addrs)) {
+			if j, ok := ruleByAddr[addr]; ok {
+				return nil, fmt.Errorf("%s: rule #%d: address %s is already matched by rule #%d, only the first matching rule applies", path, i+1, addr, j)
+			}
+			ruleByAddr[addr] = i + 1
+		}
+	}
+	return &rules, nil
+}
+
+func (r rule) validate() error {
+	if !slices.Contains(ruleActions, r.Action) {
+		return fmt.Errorf("unknown action '%s'", r.Action)
+	}
+	if r.Reason == "" {
+		return errors.New("missing reason")
+	}
+	if len(r.Addresses) == 0 && len(r.AddressLists) == 0 && len(r.Types) == 0 && len(r.Categories) == 0 {
+		return errors.New("rule matches no account")
+	}
+	for _, c := range r.Categories {
+		if !slices.Contains(labelCategories, c) {
+			return fmt.Errorf("unknown category '%s'", c)
+		}
+	}
+	if r.Action == actionCap && (r.Cap == nil || !r.Cap.IsPositive()) {
+		return errors.New("cap action requires a positive cap")
+	}
+	if r.Action == actionRedirect {
+		if r.RedirectTo == "" {
+			return errors.New("redirect action requires redirect_to")
+		}
+		// The airdrop addresses are derived from cosmos addresses
+		if _, err := sdk.GetFromBech32(r.RedirectTo, "cosmos"); err != nil {
+			return fmt.Errorf("invalid redirect_to '%s', expected a cosmos address: %w", r.RedirectTo, err)
+		}
+	}
+	return nil
+}
+
+// readAddressList adds the addresses of the file at path into addrs.
+func readAddressList(path string, addrs map[string]bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		addrs[line] = true
+	}
+	return s.Err()
+}
+
+// withoutAudit returns a copy of rs with an empty audit log, which can be
+// applied to throwaway or concurrent distributions.
+func (rs *accountRules) withoutAudit() *accountRules {
+	c := *rs
+	c.Rules = slices.Clone(rs.Rules)
+	c.audit = nil
+	return &c
+}
+
+// match returns the first rule matching the account of address addr and type
+// accType, or nil.
+func (rs *accountRules) match(addr, accType string) *rule {
+	category := rs.labels[addr].Category
+	for i := range rs.Rules {
+		if rs.Rules[i].matches(addr, accType, category) {
+			return &rs.Rules[i]
+		}
+	}
+	return nil
+}
+
+// excluded returns true if the account of address addr and type accType is
+// excluded by a rule, and records it in the audit log.
+func (rs *accountRules) excluded(addr, accType string) bool {
+	r := rs.match(addr, accType)
+	if r == nil || r.Action != actionExclude {
+		return false
+	}
+	rs.record(addr, accType, r, "")
+	return true
+}
+
+// record adds r applied to the account of address addr into the audit log,
+// only the first record of an address is kept.
+func (rs *accountRules) record(addr, accType string, r *rule, amount string) {
+	if rs.audit == nil {
+		rs.audit = make(map[string]auditEntry)
+	}
+	if _, ok := rs.audit[addr]; ok {
+		return
+	}
+	rs.audit[addr] = auditEntry{
+		Address: addr,
+		Type:    accType,
+		Action:  r.Action,
+		Reason:  r.Reason,
+		Amount:  amount,
+	}
+}
+
+// writeAuditLog writes the audit log of rs, sorted by address, into the CSV
+// file at path.
+func (rs *accountRules) writeAuditLog(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	w.Write([]string{"address", "type", "action", "reason", "amount"})
+	for _, addr := range slices.Sorted(maps.Keys(rs.audit)) {
+		e := rs.audit[addr]
+		w.Write([]string{e.Address, e.Type, string(e.Action), e.Reason, e.Amount})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	fmt.Printf("%s file created (%d rules applied).\n", path, len(rs.audit))
+	return nil
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cosmossdk.io/math"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types/v1beta1"
+)
+
+func TestLoadRules(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "list.txt"), []byte("# exchanges\naddr2\n\n  addr3  \n"), 0o666)
+	require.NoError(t, err)
+	tests := []struct {
+		name          string
+		content       string
+		expectedError string
+	}{
+		{
+			name: "yaml",
+			content: `rules:
+- types: [/cosmos.auth.v1beta1.ModuleAccount]
+  action: exclude
+  reason: module accounts
+- addresses: [addr1]
+  address_lists: [list.txt]
+  action: cap
+  cap: "100"
+  reason: exchanges
+`,
+		},
+		{
+			name: "json",
+			content: `{"rules": [
+				{"types": ["/cosmos.auth.v1beta1.ModuleAccount"], "action": "exclude", "reason": "module accounts"},
+				{"addresses": ["addr1"], "address_lists": ["list.txt"], "action": "cap", "cap": "100", "reason": "exchanges"}
+			]}`,
+		},
+		{
+			name:          "unknown field",
+			content:       "rules:\n- addresses: [addr1]\n  action: exclude\n  reason: r\n  foo: bar\n",
+			expectedError: `unknown field "foo"`,
+		},
+		{
+			name:          "unknown action",
+			content:       "rules:\n- addresses: [addr1]\n  action: burn\n  reason: r\n",
+			expectedError: "rule #1: unknown action 'burn'",
+		},
+		{
+			name:          "missing reason",
+			content:       "rules:\n- addresses: [addr1]\n  action: exclude\n",
+			expectedError: "rule #1: missing reason",
+		},
+		{
+			name:          "no match",
+			content:       "rules:\n- action: exclude\n  reason: r\n",
+			expectedError: "rule #1: rule matches no account",
+		},
+		{
+			name:          "missing cap",
+			content:       "rules:\n- addresses: [addr1]\n  action: cap\n  reason: r\n",
+			expectedError: "rule #1: cap action requires a positive cap",
+		},
+		{
+			name:          "zero cap",
+			content:       "rules:\n- addresses: [addr1]\n  action: cap\n  cap: \"0\"\n  reason: r\n",
+			expectedError: "rule #1: cap action requires a positive cap",
+		},
+		{
+			name:          "invalid redirect_to",
+			content:       "rules:\n- addresses: [addr1]\n  action: redirect\n  redirect_to: target\n  reason: r\n",
+			expectedError: "rule #1: invalid redirect_to 'target', expected a cosmos address",
+		},
+		{
+			name:          "address in several rules",
+			content:       "rules:\n- addresses: [addr2]\n  action: cap\n  cap: \"100\"\n  reason: r\n- address_lists: [list.txt]\n  action: exclude\n  reason: r\n",
+			expectedError: "rule #2: address addr2 is already matched by rule #1",
+		},
+		{
+			name:          "missing redirect_to",
+			content:       "rules:\n- addresses: [addr1]\n  action: redirect\n  reason: r\n",
+			expectedError: "rule #1: redirect action requires redirect_to",
+		},
+		{
+			name:          "missing address list",
+			content:       "rules:\n- address_lists: [missing.txt]\n  action: exclude\n  reason: r\n",
+			expectedError: "missing.txt: no such file or directory",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+			assert := assert.New(t)
+			path := filepath.Join(dir, "rules")
+			require.NoError(os.WriteFile(path, []byte(tt.content), 0o666))
+
+			rules, err := loadRules(path)
+
+			if tt.expectedError != "" {
+				require.ErrorContains(err, tt.expectedError)
+				return
+			}
+			require.NoError(err)
+			require.Len(rules.Rules, 2)
+			assert.True(rules.excluded("addr4", "/cosmos.auth.v1beta1.ModuleAccount"))
+			assert.False(rules.excluded("addr1", ""))
+			for _, addr := range []string{"addr1", "addr2", "addr3"} {
+				r := rules.match(addr, "")
+				if assert.NotNil(r, addr) {
+					assert.Equal(actionCap, r.Action)
+					assert.Equal(math.NewInt(100), *r.Cap)
+				}
+			}
+			assert.Nil(rules.match("exchanges", ""))
+			assert.Equal(map[string]auditEntry{
+				"addr4": {
+					Address: "addr4",
+					Type:    "/cosmos.auth.v1beta1.ModuleAccount",
+					Action:  actionExclude,
+					Reason:  "module accounts",
+				},
+			}, rules.audit)
+		})
+	}
+}
+
+func TestLoadRulesDefault(t *testing.T) {
+	rules, err := loadRules("")
+
+	require.NoError(t, err)
+	assert.True(t, rules.excluded("addr", "/ibc.applications.interchain_accounts.v1.InterchainAccount"))
+	assert.False(t, rules.excluded(icfWallets[0], ""))
+	if r := rules.match(icfWallets[0], ""); assert.NotNil(t, r) {
+		assert.Equal(t, actionSlash, r.Action)
+	}
+}
+
+func TestDistributionRules(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	var (
+		target  = sdk.AccAddress(bytes.Repeat([]byte{1}, 20)).String()
+		voteYes = govtypes.WeightedVoteOptions{{
+			Option: govtypes.OptionYes,
+			Weight: math.LegacyNewDec(1),
+		}}
+		accounts = []Account{
+			{Address: "capped", LiquidAmount: math.LegacyZeroDec(), StakedAmount: math.LegacyNewDec(100), Vote: voteYes},
+			{Address: target, LiquidAmount: math.LegacyZeroDec(), StakedAmount: math.LegacyNewDec(10), Vote: voteYes},
+			{Address: "excluded", LiquidAmount: math.LegacyNewDec(10), StakedAmount: math.LegacyZeroDec()},
+			{Address: "liquid", LiquidAmount: math.LegacyNewDec(10), StakedAmount: math.LegacyZeroDec()},
+			{Address: "module", Type: "/cosmos.auth.v1beta1.ModuleAccount", LiquidAmount: math.LegacyNewDec(10), StakedAmount: math.LegacyZeroDec()},
+			{Address: "redirected", LiquidAmount: math.LegacyZeroDec(), StakedAmount: math.LegacyNewDec(10), Vote: voteYes},
+			{Address: "redirected2", LiquidAmount: math.LegacyZeroDec(), StakedAmount: math.LegacyNewDec(10), Vote: voteYes},
+			{Address: "slashed", LiquidAmount: math.LegacyNewDec(4), StakedAmount: math.LegacyNewDec(6), Vote: voteYes},
+		}
+		params = defaultDistriParams()
+		dir    = t.TempDir()
+		path   = filepath.Join(dir, "rules.yaml")
+	)
+	params.supplyFactor = math.LegacyOneDec()
+	require.NoError(os.WriteFile(path, []byte(`rules:
+- types: [/cosmos.auth.v1beta1.ModuleAccount]
+  addresses: [excluded]
+  action: exclude
+  reason: module accounts
+- addresses: [slashed]
+  action: slash
+  reason: hack
+- addresses: [capped]
+  action: cap
+  cap: "50"
+  reason: whale
+- addresses: [redirected, redirected2]
+  action: redirect
+  redirect_to: `+target+`
+  reason: lost keys
+`), 0o666))
+	rules, err := loadRules(path)
+	require.NoError(err)
+
+	airdrop, err := distribution(accounts, params, "", rules)
+
+	require.NoError(err)
+	assert.Equal(math.NewInt(50), airdrop.addresses["capped"])
+	assert.Equal(math.NewInt(30), airdrop.addresses[target])
+	assert.NotContains(airdrop.addresses, "redirected")
+	assert.NotContains(airdrop.addresses, "redirected2")
+	assert.NotContains(airdrop.addresses, "slashed")
+	assert.NotContains(airdrop.addresses, "excluded")
+	assert.NotContains(airdrop.addresses, "module")
+	assert.Equal(math.LegacyNewDec(10), airdrop.slashed)
+	// The redirected airdrops are merged into the target details
+	var targetDetails []addrAmtDetail
+	for _, d := range airdrop.addressesDetail {
+		if d.Address == target {
+			targetDetails = append(targetDetails, d)
+		}
+	}
+	if assert.Len(targetDetails, 1) {
+		assert.Equal("30.000000000000000000", targetDetails[0].Total.String())
+	}
+
+	auditFile := filepath.Join(dir, "audit.csv")
+	require.NoError(rules.writeAuditLog(auditFile))
+	f, err := os.Open(auditFile)
+	require.NoError(err)
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	require.NoError(err)
+	assert.Equal([][]string{
+		{"address", "type", "action", "reason", "amount"},
+		{"capped", "", "cap", "whale", "50.000000000000000000"},
+		{"excluded", "", "exclude", "module accounts", ""},
+		{"module", "/cosmos.auth.v1beta1.ModuleAccount", "exclude", "module accounts", ""},
+		{"redirected", "", "redirect", "lost keys", "10.000000000000000000"},
+		{"redirected2", "", "redirect", "lost keys", "10.000000000000000000"},
+		{"slashed", "", "slash", "hack", "10.000000000000000000"},
+	}, records)
+}
+
+func TestGetGnoAccountsRules(t *testing.T) {
+	capAmt := math.NewInt(5)
+	rules := &accountRules{Rules: []rule{
+		{Types: []string{"/cosmos.auth.v1beta1.ModuleAccount"}, Action: actionExclude, Reason: "module"},
+		{Addresses: []string{"slashed"}, Action: actionSlash, Reason: "hack"},
+		{Addresses: []string{"capped"}, Action: actionCap, Cap: &capAmt, Reason: "whale"},
+		{Addresses: []string{"redirected"}, Action: actionRedirect, RedirectTo: "target", Reason: "lost keys"},
+	}}
+	for i := range rules.Rules {
+		rules.Rules[i].addrs = make(map[string]bool)
+		for _, addr := range rules.Rules[i].Addresses {
+			rules.Rules[i].addrs[addr] = true
+		}
+	}
+	snap := &Snapshot{
+		BalancesByAddr: map[string]sdk.Coins{
+			"capped":     sdk.NewCoins(sdk.NewInt64Coin("uatom", 10), sdk.NewInt64Coin("uosmo", 3)),
+			"module":     sdk.NewCoins(sdk.NewInt64Coin("uatom", 10)),
+			"redirected": sdk.NewCoins(sdk.NewInt64Coin("uatom", 2)),
+			"slashed":    sdk.NewCoins(sdk.NewInt64Coin("uatom", 10)),
+			"target":     sdk.NewCoins(sdk.NewInt64Coin("uatom", 1)),
+		},
+		AccountTypesByAddr: map[string]string{
+			"module": "/cosmos.auth.v1beta1.ModuleAccount",
+		},
+	}
+
+	accounts := getGnoAccounts(snap, rules)
+
+	assert.Equal(t, []GnoAccount{
+		{Address: "capped", Coins: sdk.NewCoins(sdk.NewInt64Coin("uatom", 5), sdk.NewInt64Coin("uosmo", 3))},
+		{Address: "target", Coins: sdk.NewCoins(sdk.NewInt64Coin("uatom", 3))},
+	}, accounts)
+	assert.Equal(t, "5uatom", rules.audit["capped"].Amount)
+	assert.Equal(t, "2uatom", rules.audit["redirected"].Amount)
+	assert.Equal(t, "10uatom", rules.audit["slashed"].Amount)
+	assert.Equal(t, actionExclude, rules.audit["module"].Action)
+}
+
+func TestGetGnoAccountsDefaultRules(t *testing.T) {
+	snap := &Snapshot{
+		BalancesByAddr: map[string]sdk.Coins{
+			icfWallets[0]: sdk.NewCoins(sdk.NewInt64Coin("uatom", 10)),
+			"ica":         sdk.NewCoins(sdk.NewInt64Coin("uatom", 10)),
+			"module":      sdk.NewCoins(sdk.NewInt64Coin("uatom", 10)),
+			"user":        sdk.NewCoins(sdk.NewInt64Coin("uatom", 1)),
+		},
+		AccountTypesByAddr: map[string]string{
+			"ica":    "/ibc.applications.interchain_accounts.v1.InterchainAccount",
+			"module": "/cosmos.auth.v1beta1.ModuleAccount",
+		},
+	}
+
+	accounts := getGnoAccounts(snap, defaultGnoRules())
+
+	assert.Equal(t, []GnoAccount{
+		{Address: icfWallets[0], Coins: sdk.NewCoins(sdk.NewInt64Coin("uatom", 10))},
+		{Address: "user", Coins: sdk.NewCoins(sdk.NewInt64Coin("uatom", 1))},
+	}, accounts)
+}
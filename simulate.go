@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	stdmath "math"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"cosmossdk.io/math"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types/v1beta1"
+)
+
+// probDistribution is a probability distribution of values between 0 and 1.
+type probDistribution struct {
+	// Kind is fixed, uniform or beta.
+	Kind   string
+	Params []float64
+}
+
+// parseDistribution parses s, in one of the following forms:
+//   - fixed:<value>
+//   - uniform:<min>,<max>
+//   - beta:<alpha>,<beta>
+func parseDistribution(s string) (probDistribution, error) {
+	kind, params, _ := strings.Cut(s, ":")
+	d := probDistribution{Kind: kind}
+	for _, p := range strings.Split(params, ",") {
+		f, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return probDistribution{}, fmt.Errorf("distribution '%s': invalid parameter '%s'", s, p)
+		}
+		d.Params = append(d.Params, f)
+	}
+	var valid bool
+	switch kind {
+	case "fixed":
+		valid = len(d.Params) == 1 && d.Params[0] >= 0 && d.Params[0] <= 1
+	case "uniform":
+		valid = len(d.Params) == 2 && d.Params[0] >= 0 && d.Params[0] <= d.Params[1] && d.Params[1] <= 1
+	case "beta":
+		valid = len(d.Params) == 2 && d.Params[0] > 0 && d.Params[1] > 0
+	default:
+		return probDistribution{}, fmt.Errorf("distribution '%s': unknown kind '%s'", s, kind)
+	}
+	if !valid {
+		return probDistribution{}, fmt.Errorf("distribution '%s': invalid parameters", s)
+	}
+	return d, nil
+}
+
+func (d probDistribution) String() string {
+	params := make([]string, len(d.Params))
+	for i, p := range d.Params {
+		params[i] = strconv.FormatFloat(p, 'g', -1, 64)
+	}
+	return d.Kind + ":" + strings.Join(params, ",")
+}
+
+func (d probDistribution) sample(r *rand.Rand) float64 {
+	switch d.Kind {
+	case "uniform":
+		return d.Params[0] + r.Float64()*(d.Params[1]-d.Params[0])
+	case "beta":
+		x := sampleGamma(r, d.Params[0])
+		return x / (x + sampleGamma(r, d.Params[1]))
+	}
+	return d.Params[0]
+}
+
+// sampleGamma returns a sample of the gamma distribution of shape k and scale
+// 1, using the Marsaglia and Tsang method.
+func sampleGamma(r *rand.Rand, k float64) float64 {
+	if k < 1 {
+		return sampleGamma(r, k+1) * stdmath.Pow(r.Float64(), 1/k)
+	}
+	d := k - 1.0/3
+	c := 1 / stdmath.Sqrt(9*d)
+	for {
+		x := r.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := r.Float64()
+		if u < 1-0.0331*x*x*x*x || stdmath.Log(u) < 0.5*x*x+d*(1-v+stdmath.Log(v)) {
+			return d * v
+		}
+	}
+}
+
+// parseOptionMix parses s, a comma separated list of option=alpha (like
+// yes=2,no=1,abstain=0.5), into the parameters of a Dirichlet distribution of
+// the vote options.
+func parseOptionMix(s string) (map[govtypes.VoteOption]float64, error) {
+	mix := make(map[govtypes.VoteOption]float64)
+	for _, item := range strings.Split(s, ",") {
+		name, value, _ := strings.Cut(item, "=")
+		option, ok := govtypes.VoteOption_value["VOTE_OPTION_"+strings.ToUpper(name)]
+		if !ok || option == int32(govtypes.OptionEmpty) {
+			return nil, fmt.Errorf("option mix '%s': unknown option '%s'", s, name)
+		}
+		alpha, err := strconv.ParseFloat(value, 64)
+		if err != nil || alpha < 0 {
+			return nil, fmt.Errorf("option mix '%s': invalid alpha '%s'", s, value)
+		}
+		mix[govtypes.VoteOption(option)] = alpha
+	}
+	return mix, nil
+}
+
+// simulationConfig configures simulateTally.
+type simulationConfig struct {
+	Trials  int
+	Seed    uint64
+	Workers int
+	Mode    tallyMode
+	// Turnout is the distribution of the share of the non-voting delegators
+	// who vote in a trial.
+	Turnout probDistribution
+	// OptionMix holds the parameters of the Dirichlet distribution of the
+	// share of each option picked by the new voters in a trial. If empty, the
+	// new voters follow the option mix of the tally.
+	OptionMix map[govtypes.VoteOption]float64
+}
+
+// simulationResult is the result of simulateTally.
+type simulationResult struct {
+	Trials int
+	// Outcomes holds the number of trials by outcome.
+	Outcomes map[string]int
+}
+
+// simulateTally runs cfg.Trials tallies of prop where a random part of the
+// non-voting delegators of snap vote randomly, and returns the number of
+// trials by outcome. Trial i uses a random source seeded with (cfg.Seed, i),
+// so the result is deterministic for a given seed whatever cfg.Workers.
+func simulateTally(snap *Snapshot, params govParams, prop govProposal, cfg simulationConfig) simulationResult {
+	var (
+		bondedTokens = totalBondedTokens(snap)
+		// sorted so the trials don't depend on the map iteration order
+		nonVoters = slices.Sorted(func(yield func(string) bool) {
+			for addr := range snap.DelegsByAddr {
+				if _, ok := snap.VotesByAddr[addr]; !ok && !yield(addr) {
+					return
+				}
+			}
+		})
+		// validator addresses by operator account address, so a validator
+		// votes when its operator account draws a vote
+		valAddrsByAccount = make(map[string]string, len(snap.ValsByAddr))
+		options           = voteOptions(prop.Format)
+		mix               = cfg.OptionMix
+	)
+	for valAddr, val := range snap.ValsByAddr {
+		valAddrsByAccount[sdk.AccAddress(val.Address).String()] = valAddr
+	}
+	if len(mix) == 0 {
+		// Follow the option mix of the tally
+		results := tally(snap, cfg.Mode).Results
+		mix = make(map[govtypes.VoteOption]float64)
+		for _, o := range options {
+			mix[o] = results[o].MustFloat64()
+		}
+	}
+	var (
+		res = simulationResult{
+			Trials:   cfg.Trials,
+			Outcomes: make(map[string]int),
+		}
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		trials = make(chan int)
+	)
+	for range max(cfg.Workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range trials {
+				r := rand.New(rand.NewPCG(cfg.Seed, uint64(i)))
+				trialSnap := *snap
+				trialSnap.VotesByAddr = maps.Clone(snap.VotesByAddr)
+				var (
+					turnout = cfg.Turnout.sample(r)
+					weights = sampleOptionWeights(r, options, mix, len(cfg.OptionMix) > 0)
+					// ValsByAddr is cloned once a validator votes
+					valsCloned bool
+				)
+				for _, addr := range nonVoters {
+					if r.Float64() >= turnout {
+						continue
+					}
+					option := pickOption(r, options, weights)
+					vote := govtypes.NewNonSplitVoteOption(option)
+					trialSnap.VotesByAddr[addr] = vote
+					if valAddr, ok := valAddrsByAccount[addr]; ok {
+						if !valsCloned {
+							trialSnap.ValsByAddr = maps.Clone(snap.ValsByAddr)
+							valsCloned = true
+						}
+						val := trialSnap.ValsByAddr[valAddr]
+						val.Vote = vote
+						trialSnap.ValsByAddr[valAddr] = val
+					}
+				}
+				tr := tally(&trialSnap, cfg.Mode)
+				v := evaluateTally(tr.Results, tr.TotalVotingPower, bondedTokens, params, prop)
+				mu.Lock()
+				res.Outcomes[v.Outcome]++
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range cfg.Trials {
+		trials <- i
+	}
+	close(trials)
+	wg.Wait()
+	return res
+}
+
+// sampleOptionWeights returns the share of each of options in a trial, sampled
+// from the Dirichlet distribution of parameters mix if random is true, or
+// else proportional to mix.
+func sampleOptionWeights(r *rand.Rand, options []govtypes.VoteOption, mix map[govtypes.VoteOption]float64, random bool) []float64 {
+	var (
+		weights = make([]float64, len(options))
+		sum     float64
+	)
+	for i, o := range options {
+		weights[i] = mix[o]
+		if random && mix[o] > 0 {
+			weights[i] = sampleGamma(r, mix[o])
+		}
+		sum += weights[i]
+	}
+	for i := range weights {
+		if sum > 0 {
+			weights[i] /= sum
+		}
+	}
+	return weights
+}
+
+// pickOption returns one of options, picked following weights (which sum to
+// 1).
+func pickOption(r *rand.Rand, options []govtypes.VoteOption, weights []float64) govtypes.VoteOption {
+	x := r.Float64()
+	for i, w := range weights {
+		if x < w {
+			return options[i]
+		}
+		x -= w
+	}
+	return options[len(options)-1]
+}
+
+func printSimulationResult(res simulationResult, cfg simulationConfig) {
+	fmt.Printf("--- SIMULATION (%d trials, seed %d, mode %s, turnout %s) ---\n",
+		res.Trials, cfg.Seed, cfg.Mode, cfg.Turnout)
+	table := newMarkdownTable("Outcome", "Trials", "Probability")
+	for _, outcome := range outcomes {
+		n := res.Outcomes[outcome]
+		table.Append([]string{
+			outcome, strconv.Itoa(n),
+			humanPercent(math.LegacyNewDec(int64(n)).QuoInt64(int64(max(res.Trials, 1)))),
+		})
+	}
+	table.Render()
+}
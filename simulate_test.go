@@ -0,0 +1,196 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cosmossdk.io/math"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types/v1beta1"
+	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
+)
+
+func TestParseDistribution(t *testing.T) {
+	tests := []struct {
+		s             string
+		expectedDistr probDistribution
+		expectedError string
+	}{
+		{s: "fixed:0.2", expectedDistr: probDistribution{Kind: "fixed", Params: []float64{0.2}}},
+		{s: "uniform:0.1,0.3", expectedDistr: probDistribution{Kind: "uniform", Params: []float64{0.1, 0.3}}},
+		{s: "beta:2,5", expectedDistr: probDistribution{Kind: "beta", Params: []float64{2, 5}}},
+		{s: "fixed:2", expectedError: "distribution 'fixed:2': invalid parameters"},
+		{s: "uniform:0.3,0.1", expectedError: "distribution 'uniform:0.3,0.1': invalid parameters"},
+		{s: "beta:0,1", expectedError: "distribution 'beta:0,1': invalid parameters"},
+		{s: "beta:a,1", expectedError: "distribution 'beta:a,1': invalid parameter 'a'"},
+		{s: "normal:0,1", expectedError: "distribution 'normal:0,1': unknown kind 'normal'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			d, err := parseDistribution(tt.s)
+
+			if tt.expectedError != "" {
+				require.EqualError(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedDistr, d)
+			assert.Equal(t, tt.s, d.String())
+		})
+	}
+}
+
+func TestSimulateTally(t *testing.T) {
+	var (
+		accAddrs = createAccountAddrs(3)
+		valAddrs = createValidatorAddrs(1)
+		valAddr  = valAddrs[0].String()
+		newDeleg = func(i int, shares int64) []stakingtypes.Delegation {
+			return []stakingtypes.Delegation{{
+				DelegatorAddress: accAddrs[i].String(),
+				ValidatorAddress: valAddr,
+				Shares:           math.LegacyNewDec(shares),
+			}}
+		}
+		snap = &Snapshot{
+			VotesByAddr: map[string]govtypes.WeightedVoteOptions{
+				accAddrs[0].String(): govtypes.NewNonSplitVoteOption(govtypes.OptionNo),
+			},
+			ValsByAddr: map[string]govtypes.ValidatorGovInfo{
+				valAddr: govtypes.NewValidatorGovInfo(valAddrs[0], math.NewInt(100),
+					math.LegacyNewDec(100), math.LegacyZeroDec(), nil),
+			},
+			DelegsByAddr: map[string][]stakingtypes.Delegation{
+				accAddrs[0].String(): newDeleg(0, 10),
+				accAddrs[1].String(): newDeleg(1, 45),
+				accAddrs[2].String(): newDeleg(2, 45),
+			},
+		}
+		params = govParams{
+			Quorums:       map[proposalKind]math.LegacyDec{kindDefault: math.LegacyNewDecWithPrec(4, 1)},
+			Thresholds:    map[proposalKind]math.LegacyDec{kindDefault: math.LegacyNewDecWithPrec(5, 1)},
+			VetoThreshold: math.LegacyNewDecWithPrec(334, 3),
+		}
+		prop = govProposal{Format: govV1beta1}
+	)
+	tests := []struct {
+		name             string
+		turnout          string
+		mix              map[govtypes.VoteOption]float64
+		expectedOutcomes map[string]int
+	}{
+		{
+			name:             "no turnout",
+			turnout:          "fixed:0",
+			expectedOutcomes: map[string]int{outcomeNoQuorum: 100},
+		},
+		{
+			name:             "full turnout with the option mix of the tally",
+			turnout:          "fixed:1",
+			expectedOutcomes: map[string]int{outcomeNoThreshold: 100},
+		},
+		{
+			name:             "full turnout voting yes",
+			turnout:          "fixed:1",
+			mix:              map[govtypes.VoteOption]float64{govtypes.OptionYes: 1},
+			expectedOutcomes: map[string]int{outcomePassed: 100},
+		},
+		{
+			name:             "full turnout voting veto",
+			turnout:          "fixed:1",
+			mix:              map[govtypes.VoteOption]float64{govtypes.OptionNoWithVeto: 1},
+			expectedOutcomes: map[string]int{outcomeVetoed: 100},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			turnout, err := parseDistribution(tt.turnout)
+			require.NoError(t, err)
+			cfg := simulationConfig{Trials: 100, Seed: 1, Workers: 4, Turnout: turnout, OptionMix: tt.mix}
+
+			res := simulateTally(snap, params, prop, cfg)
+
+			assert.Equal(t, 100, res.Trials)
+			assert.Equal(t, tt.expectedOutcomes, res.Outcomes)
+		})
+	}
+
+	t.Run("deterministic", func(t *testing.T) {
+		turnout, err := parseDistribution("beta:2,2")
+		require.NoError(t, err)
+		cfg := simulationConfig{
+			Trials:  200,
+			Seed:    42,
+			Workers: 1,
+			Turnout: turnout,
+			OptionMix: map[govtypes.VoteOption]float64{
+				govtypes.OptionYes: 2, govtypes.OptionNo: 1, govtypes.OptionAbstain: 1,
+			},
+		}
+
+		res := simulateTally(snap, params, prop, cfg)
+
+		var n int
+		for _, count := range res.Outcomes {
+			n += count
+		}
+		assert.Equal(t, 200, n)
+		assert.Greater(t, len(res.Outcomes), 1, "trials should have different outcomes")
+		// Same result with other workers
+		cfg.Workers = 8
+		assert.Equal(t, res, simulateTally(snap, params, prop, cfg))
+		// Different result with another seed
+		cfg.Seed = 43
+		assert.NotEqual(t, res, simulateTally(snap, params, prop, cfg))
+	})
+}
+
+func TestSimulateTallyValidatorOperator(t *testing.T) {
+	var (
+		valAddrs = createValidatorAddrs(1)
+		valAddr  = valAddrs[0].String()
+		// the operator account is the only delegator of the snapshot, the
+		// other delegations are only counted in the validator shares
+		operatorAddr = sdk.AccAddress(valAddrs[0]).String()
+		snap         = &Snapshot{
+			VotesByAddr: map[string]govtypes.WeightedVoteOptions{},
+			ValsByAddr: map[string]govtypes.ValidatorGovInfo{
+				valAddr: govtypes.NewValidatorGovInfo(valAddrs[0], math.NewInt(100),
+					math.LegacyNewDec(100), math.LegacyZeroDec(), nil),
+			},
+			DelegsByAddr: map[string][]stakingtypes.Delegation{
+				operatorAddr: {{
+					DelegatorAddress: operatorAddr,
+					ValidatorAddress: valAddr,
+					Shares:           math.LegacyNewDec(10),
+				}},
+			},
+		}
+		params = govParams{
+			Quorums:       map[proposalKind]math.LegacyDec{kindDefault: math.LegacyNewDecWithPrec(4, 1)},
+			Thresholds:    map[proposalKind]math.LegacyDec{kindDefault: math.LegacyNewDecWithPrec(5, 1)},
+			VetoThreshold: math.LegacyNewDecWithPrec(334, 3),
+		}
+		prop = govProposal{Format: govV1beta1}
+	)
+	turnout, err := parseDistribution("fixed:1")
+	require.NoError(t, err)
+	cfg := simulationConfig{
+		Trials:    10,
+		Seed:      1,
+		Workers:   2,
+		Mode:      modeInheritance,
+		Turnout:   turnout,
+		OptionMix: map[govtypes.VoteOption]float64{govtypes.OptionYes: 1},
+	}
+
+	res := simulateTally(snap, params, prop, cfg)
+
+	// The delegators of the validator inherit the vote of its operator, which
+	// reaches the quorum
+	assert.Equal(t, map[string]int{outcomePassed: 10}, res.Outcomes)
+	assert.Empty(t, snap.ValsByAddr[valAddr].Vote, "snapshot must not be modified")
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"path/filepath"
+	"sync"
+
+	"cosmossdk.io/math"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types/v1beta1"
+	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
+)
+
+// Snapshot holds the data parsed from the files of a snapshot directory.
+type Snapshot struct {
+	VotesByAddr       map[string]govtypes.WeightedVoteOptions
+	ValsByAddr        map[string]govtypes.ValidatorGovInfo
+	ValMonikersByAddr map[string]string
+	DelegsByAddr      map[string][]stakingtypes.Delegation
+	// UnbondingsByAddr and RedelegationsByAddr are nil if the snapshot doesn't
+	// have the corresponding files.
+	UnbondingsByAddr    map[string][]stakingtypes.UnbondingDelegation
+	RedelegationsByAddr map[string][]stakingtypes.Redelegation
+	// VestingByAddr holds the vesting amounts of the vesting accounts at the
+	// snapshot time, see snapshotTime.
+	VestingByAddr map[string]VestingInfo
+	// TokenizeShareRecords and ShareBalancesByDenom (the balances of the
+	// share tokens by denom and holder address) are nil if the snapshot
+	// doesn't have the LSM records.
+	TokenizeShareRecords []tokenizeShareRecord
+	ShareBalancesByDenom map[string]map[string]math.Int
+	BalancesByAddr       map[string]sdk.Coins
+	AccountTypesByAddr   map[string]string
+
+	// streamed holds the parts that are not loaded but streamed from the
+	// files of path, see snapshotOptions.stream.
+	streamed snapshotPart
+	path     string
+	useCache bool
+	denom    string
+}
+
+// snapshotPart identifies the files of a snapshot directory to load.
+type snapshotPart uint
+
+const (
+	partVotes snapshotPart = 1 << iota
+	partValidators
+	partDelegations
+	partBalances
+	partAccountTypes
+	partUnbondings
+	partRedelegations
+	partVesting
+	partTokenizeShares
+)
+
+type snapshotOptions struct {
+	// parts is the set of files to load.
+	parts snapshotPart
+	// denom filters the balances, all denoms are kept if empty. It is
+	// required by partVesting.
+	denom string
+	// noCache disables the binary cache of the parsed files.
+	noCache bool
+	// stream is the subset of parts (partDelegations and partBalances only)
+	// that are verified but not loaded: their records are read one by one
+	// from the files by Snapshot.delegations and Snapshot.balances, so the
+	// consumers don't hold all of them in memory.
+	stream snapshotPart
+}
+
+// loadSnapshot loads concurrently the files of the snapshot directory path
+// selected by opts.parts, once their checksums have been verified against the
+// manifest. The first error cancels the other loadings, and all errors are
+// reported together.
+func loadSnapshot(ctx context.Context, path string, opts snapshotOptions) (*Snapshot, error) {
+	files, err := snapshotPartFiles(path, opts.parts)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyManifest(path, files...); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		snap Snapshot
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	snap.streamed = opts.parts & opts.stream
+	snap.path, snap.useCache, snap.denom = path, !opts.noCache, opts.denom
+	load := func(part snapshotPart, fn func() error) {
+		if opts.parts&part == 0 || opts.stream&part != 0 {
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := fn()
+			if err == nil || errors.Is(err, context.Canceled) {
+				return
+			}
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+			cancel()
+		}()
+	}
+	load(partVotes, func() (err error) {
+		snap.VotesByAddr, err = parseVotesByAddr(ctx, path, !opts.noCache)
+		return err
+	})
+	load(partValidators, func() (err error) {
+		// Validator votes are set once votes are loaded
+		snap.ValsByAddr, snap.ValMonikersByAddr, err = parseValidatorsByAddr(ctx, path, nil, !opts.noCache)
+		return err
+	})
+	load(partDelegations, func() (err error) {
+		snap.DelegsByAddr, err = parseDelegationsByAddr(ctx, path, !opts.noCache)
+		return err
+	})
+	load(partUnbondings, func() (err error) {
+		snap.UnbondingsByAddr, err = parseUnbondingsByAddr(ctx, path, !opts.noCache)
+		return err
+	})
+	load(partRedelegations, func() (err error) {
+		snap.RedelegationsByAddr, err = parseRedelegationsByAddr(ctx, path, !opts.noCache)
+		return err
+	})
+	load(partVesting, func() error {
+		t, err := snapshotTime(path)
+		if err != nil {
+			return err
+		}
+		snap.VestingByAddr, err = parseVestingByAddr(ctx, path, opts.denom, t, !opts.noCache)
+		return err
+	})
+	load(partTokenizeShares, func() (err error) {
+		snap.TokenizeShareRecords, snap.ShareBalancesByDenom, err = parseTokenizeShareRecords(ctx, path, !opts.noCache)
+		return err
+	})
+	load(partBalances, func() (err error) {
+		snap.BalancesByAddr, err = parseBalancesByAddr(ctx, path, opts.denom, !opts.noCache)
+		return err
+	})
+	load(partAccountTypes, func() (err error) {
+		snap.AccountTypesByAddr, err = parseAccountTypesPerAddr(ctx, path, !opts.noCache)
+		return err
+	})
+	wg.Wait()
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	if err := ctx.Err(); err != nil {
+		// parent context is done
+		return nil, err
+	}
+	for addr, val := range snap.ValsByAddr {
+		val.Vote = snap.VotesByAddr[sdk.AccAddress(val.Address).String()]
+		snap.ValsByAddr[addr] = val
+	}
+	return &snap, nil
+}
+
+// delegations returns an iterator over the delegations of s, read from
+// DelegsByAddr if loaded, or else streamed from the delegations.json file.
+func (s *Snapshot) delegations(ctx context.Context) iter.Seq2[stakingtypes.Delegation, error] {
+	if s.streamed&partDelegations == 0 {
+		return func(yield func(stakingtypes.Delegation, error) bool) {
+			for _, delegs := range s.DelegsByAddr {
+				for _, d := range delegs {
+					if !yield(d, nil) {
+						return
+					}
+				}
+			}
+		}
+	}
+	return readCachedRecords(ctx, filepath.Join(s.path, "delegations.json"), "", jsonDecodeNext[stakingtypes.Delegation], s.useCache)
+}
+
+// balances returns an iterator over the balances of s (filtered by the denom
+// of the snapshot options, if any), read from BalancesByAddr if loaded, or
+// else streamed from the balances.json file.
+func (s *Snapshot) balances(ctx context.Context) iter.Seq2[banktypes.Balance, error] {
+	if s.streamed&partBalances == 0 {
+		return func(yield func(banktypes.Balance, error) bool) {
+			for addr, coins := range s.BalancesByAddr {
+				if !yield(banktypes.Balance{Address: addr, Coins: coins}, nil) {
+					return
+				}
+			}
+		}
+	}
+	return func(yield func(banktypes.Balance, error) bool) {
+		records := readCachedRecords(ctx, filepath.Join(s.path, "balances.json"), "", jsonDecodeNext[banktypes.Balance], s.useCache)
+		for b, err := range records {
+			if err != nil {
+				yield(b, err)
+				return
+			}
+			if s.denom != "" {
+				ok, c := b.Coins.Find(s.denom)
+				if !ok {
+					continue
+				}
+				b.Coins = sdk.NewCoins(c)
+			}
+			if !yield(b, nil) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,521 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	stdmath "math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"cosmossdk.io/math"
+)
+
+// shareOp is the comparison of a shareConstraint.
+type shareOp string
+
+const (
+	shareAtMost  shareOp = "<="
+	shareAtLeast shareOp = ">="
+	shareEqual   shareOp = "="
+)
+
+// shareTolerance is the tolerance of the share constraints check, the solved
+// multipliers being rounded to solverPrecision decimals.
+var shareTolerance = math.LegacyNewDecWithPrec(1, 6)
+
+const solverPrecision = 9
+
+// shareConstraint is a target share of the $ATONE supply for a group of
+// buckets, like no+nwv >= 40%.
+type shareConstraint struct {
+	Buckets []string
+	Op      shareOp
+	Share   math.LegacyDec
+}
+
+func (c shareConstraint) String() string {
+	return fmt.Sprintf("%s %s %s", strings.Join(c.Buckets, "+"), c.Op, humanPercent(c.Share))
+}
+
+// share returns the share of the $ATONE supply of a held by the buckets of c.
+func (c shareConstraint) share(a airdrop) math.LegacyDec {
+	if a.atone.supply.IsZero() {
+		return math.LegacyZeroDec()
+	}
+	amt := math.LegacyZeroDec()
+	for _, name := range c.Buckets {
+		amt = amt.Add(a.atone.buckets[bucketIndex(a.params.buckets, name)])
+	}
+	return amt.Quo(a.atone.supply)
+}
+
+// met returns true if share satisfies c, with shareTolerance.
+func (c shareConstraint) met(share math.LegacyDec) bool {
+	switch c.Op {
+	case shareAtMost:
+		return share.LTE(c.Share.Add(shareTolerance))
+	case shareAtLeast:
+		return share.GTE(c.Share.Sub(shareTolerance))
+	default:
+		return share.Sub(c.Share).Abs().LTE(shareTolerance)
+	}
+}
+
+// parseShareConstraints parses comma separated share constraints like
+// "yes<=20%,no+nwv>=0.4". Shares are fractions, or percentages when they end
+// with %.
+func parseShareConstraints(s string) ([]shareConstraint, error) {
+	var constraints []shareConstraint
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		var c shareConstraint
+		for _, op := range []shareOp{shareAtMost, shareAtLeast, shareEqual} {
+			if i := strings.Index(part, string(op)); i >= 0 {
+				c.Op = op
+				for _, name := range strings.Split(part[:i], "+") {
+					if name = strings.TrimSpace(name); name == "" {
+						return nil, fmt.Errorf("share constraint '%s': missing bucket name", part)
+					}
+					c.Buckets = append(c.Buckets, name)
+				}
+				share, err := parseShare(strings.TrimSpace(part[i+len(op):]))
+				if err != nil {
+					return nil, fmt.Errorf("share constraint '%s': %w", part, err)
+				}
+				c.Share = share
+				break
+			}
+		}
+		if c.Op == "" {
+			return nil, fmt.Errorf("invalid share constraint '%s', expected <buckets> <=|>=|= <share>", part)
+		}
+		constraints = append(constraints, c)
+	}
+	return constraints, nil
+}
+
+func parseShare(s string) (math.LegacyDec, error) {
+	perc := strings.HasSuffix(s, "%")
+	d, err := math.LegacyNewDecFromStr(strings.TrimSuffix(s, "%"))
+	if err != nil {
+		return d, err
+	}
+	if perc {
+		d = d.QuoInt64(100)
+	}
+	if d.IsNegative() || d.GT(math.LegacyOneDec()) {
+		return d, errors.New("share must be between 0 and 1")
+	}
+	return d, nil
+}
+
+// shareGroup is a variable of the share solver: the fixed buckets of a share
+// constraint, which get the same multiplier.
+type shareGroup struct {
+	buckets []int
+	// current is the multiplier of the first bucket of the group in the
+	// params given to the solver.
+	current float64
+}
+
+// solveShareConstraints returns params with the multipliers of the fixed
+// buckets of constraints updated so that the airdrop of accounts meets
+// constraints. The fixed buckets of a constraint get the same multiplier, and
+// the buckets not in a constraint keep their multiplier. Among the solutions,
+// the one with the multipliers the closest to the ones of params is returned.
+// The caps are ignored by the solver, as they make the shares non-linear.
+func solveShareConstraints(accounts []Account, params distriParams, rules *accountRules, constraints []shareConstraint) (distriParams, error) {
+	var (
+		groups      []shareGroup
+		groupByBkt  = make(map[int]int)
+		groupByKeys = make(map[string]int)
+	)
+	for _, c := range constraints {
+		var fixed []int
+		for _, name := range c.Buckets {
+			i := bucketIndex(params.buckets, name)
+			if i < 0 {
+				return params, fmt.Errorf("share constraint '%s': unknown bucket '%s'", c, name)
+			}
+			if params.buckets[i].Target == "" {
+				fixed = append(fixed, i)
+			}
+		}
+		if len(fixed) == 0 {
+			continue
+		}
+		slices.Sort(fixed)
+		key := fmt.Sprint(fixed)
+		if _, ok := groupByKeys[key]; ok {
+			continue
+		}
+		for _, i := range fixed {
+			if _, ok := groupByBkt[i]; ok {
+				return params, fmt.Errorf("bucket '%s' is in share constraints with different buckets", params.buckets[i].Name)
+			}
+			groupByBkt[i] = len(groups)
+		}
+		groupByKeys[key] = len(groups)
+		groups = append(groups, shareGroup{
+			buckets: fixed,
+			current: params.buckets[fixed[0]].Multiplier.MustFloat64(),
+		})
+	}
+	if len(groups) == 0 {
+		return params, errors.New("share constraints require buckets with a fixed multiplier")
+	}
+
+	coefs, err := bucketCoefficients(accounts, params, rules)
+	if err != nil {
+		return params, err
+	}
+	// Split the coefficients of a value (bucket or supply) into the variable
+	// part of each group and the constant part of the other fixed buckets.
+	var (
+		nvars = 3 * len(groups) // multiplier and its positive and negative deviations
+		split = func(coef []float64) ([]float64, float64) {
+			row := make([]float64, nvars)
+			constant := 0.
+			for i, v := range coef {
+				if g, ok := groupByBkt[i]; ok {
+					row[g] += v
+				} else if params.buckets[i].Target == "" {
+					constant += v * params.buckets[i].Multiplier.MustFloat64()
+				}
+			}
+			return row, constant
+		}
+		supplyCoef = make([]float64, len(params.buckets))
+	)
+	for _, coef := range coefs {
+		for i, v := range coef {
+			supplyCoef[i] += v
+		}
+	}
+	supplyRow, supplyConst := split(supplyCoef)
+	var lpConstraints []lpConstraint
+	for _, c := range constraints {
+		// sum(values) op share x supply
+		valueCoef := make([]float64, len(params.buckets))
+		for _, name := range c.Buckets {
+			for i, v := range coefs[bucketIndex(params.buckets, name)] {
+				valueCoef[i] += v
+			}
+		}
+		row, constant := split(valueCoef)
+		share := c.Share.MustFloat64()
+		for g := range groups {
+			row[g] -= share * supplyRow[g]
+		}
+		lpConstraints = append(lpConstraints, lpConstraint{
+			coefs: row,
+			op:    c.Op,
+			rhs:   share*supplyConst - constant,
+		})
+	}
+	objective := make([]float64, nvars)
+	for g, group := range groups {
+		// multiplier - positive deviation + negative deviation = current
+		row := make([]float64, nvars)
+		row[g], row[len(groups)+2*g], row[len(groups)+2*g+1] = 1, -1, 1
+		lpConstraints = append(lpConstraints, lpConstraint{coefs: row, op: shareEqual, rhs: group.current})
+		weight := 1.
+		if group.current > 0 {
+			weight = 1 / group.current
+		}
+		objective[len(groups)+2*g], objective[len(groups)+2*g+1] = weight, weight
+	}
+	if supplyConst == 0 {
+		// The shares don't depend on the scale of the multipliers, keep the
+		// supply to exclude the null solution.
+		current := 0.
+		for g, group := range groups {
+			current += supplyRow[g] * group.current
+		}
+		lpConstraints = append(lpConstraints, lpConstraint{coefs: supplyRow, op: shareEqual, rhs: current})
+	}
+	solution, ok := solveLP(objective, lpConstraints)
+	if !ok {
+		return params, errors.New("share constraints can't all be met")
+	}
+	for g, group := range groups {
+		m, err := math.LegacyNewDecFromStr(strconv.FormatFloat(solution[g], 'f', solverPrecision, 64))
+		if err != nil {
+			return params, err
+		}
+		names := make([]string, len(group.buckets))
+		for j, i := range group.buckets {
+			names[j] = params.buckets[i].Name
+		}
+		if params, err = params.withMultiplier(m, names...); err != nil {
+			return params, err
+		}
+	}
+	return params, nil
+}
+
+// bucketCoefficients returns for each bucket of params the coefficients of
+// its $ATONE amount (supply factor excluded) in the multipliers of the fixed
+// buckets, the amount being linear in these multipliers when there are no
+// caps.
+func bucketCoefficients(accounts []Account, params distriParams, rules *accountRules) ([][]float64, error) {
+	for _, b := range params.buckets {
+		if _, ok := params.targets[b.Target]; b.Target != "" && !ok {
+			return nil, fmt.Errorf("bucket '%s': unknown target '%s'", b.Name, b.Target)
+		}
+	}
+	// Compute the airdrop with all multipliers to 1, without the caps and
+	// without touching the audit log of rules.
+	unitParams := distriParams{
+		buckets:            slices.Clone(params.buckets),
+		supplyFactor:       math.LegacyOneDec(),
+		supplyMintFactor:   math.LegacyZeroDec(),
+		communityPoolShare: math.LegacyZeroDec(),
+	}
+	for i := range unitParams.buckets {
+		unitParams.buckets[i].Multiplier = math.LegacyOneDec()
+		unitParams.buckets[i].Target = ""
+	}
+	unitRules := rules.withoutAudit()
+	for i := range unitRules.Rules {
+		if unitRules.Rules[i].Action == actionCap {
+			unitRules.Rules[i].Action = ""
+		}
+	}
+	unit, err := distribution(accounts, unitParams, "", unitRules)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		atomAmts    = make([]float64, len(params.buckets))
+		targetAmts  = make(map[string]float64)
+		totalShare  = 0.
+		coefs       = make([][]float64, len(params.buckets))
+		targetShare = func(name string) float64 { return params.targets[name].MustFloat64() }
+	)
+	for name := range params.targets {
+		totalShare += targetShare(name)
+	}
+	for i, b := range params.buckets {
+		atomAmts[i] = unit.atom.buckets[i].MustFloat64()
+		if b.Target != "" {
+			targetAmts[b.Target] += atomAmts[i]
+		}
+	}
+	for i, b := range params.buckets {
+		coefs[i] = make([]float64, len(params.buckets))
+		amt := unit.atone.buckets[i].MustFloat64()
+		if b.Target == "" {
+			coefs[i][i] = amt
+			continue
+		}
+		if targetAmts[b.Target] == 0 {
+			continue
+		}
+		// See solveTargetMultipliers
+		ratio := targetShare(b.Target) * amt / ((1 - totalShare) * targetAmts[b.Target])
+		for j, fb := range params.buckets {
+			if fb.Target == "" {
+				coefs[i][j] = ratio * atomAmts[j]
+			}
+		}
+	}
+	return coefs, nil
+}
+
+// lpConstraint is a constraint of a linear program: coefs.x op rhs.
+type lpConstraint struct {
+	coefs []float64
+	op    shareOp
+	rhs   float64
+}
+
+const lpEpsilon = 1e-9
+
+// solveLP returns the x >= 0 minimizing objective.x under constraints, using
+// the two-phase simplex method with the Bland's rule. It returns false if
+// there is no solution.
+func solveLP(objective []float64, constraints []lpConstraint) ([]float64, bool) {
+	var (
+		n     = len(objective)
+		m     = len(constraints)
+		nslk  = 0
+		nart  = 0
+		basis = make([]int, m)
+	)
+	for _, c := range constraints {
+		if c.op != shareEqual {
+			nslk++
+		}
+		if c.op != shareAtMost || c.rhs < 0 {
+			nart++
+		}
+	}
+	var (
+		ncols   = n + nslk + nart
+		tableau = make([][]float64, m)
+		slk     = n
+		art     = n + nslk
+	)
+	for i, c := range constraints {
+		row := make([]float64, ncols+1)
+		// Scale the row to limit the rounding errors
+		scale := stdmath.Abs(c.rhs)
+		for _, v := range c.coefs {
+			scale = stdmath.Max(scale, stdmath.Abs(v))
+		}
+		if scale == 0 {
+			scale = 1
+		}
+		copy(row, c.coefs)
+		row[ncols] = c.rhs
+		switch c.op {
+		case shareAtMost:
+			row[slk] = 1
+		case shareAtLeast:
+			row[slk] = -1
+		}
+		for j := range row {
+			row[j] /= scale
+		}
+		if c.op != shareEqual {
+			slk++
+		}
+		if row[ncols] < 0 {
+			for j := range row {
+				row[j] = -row[j]
+			}
+		}
+		if c.op == shareAtMost && c.rhs >= 0 {
+			basis[i] = slk - 1
+		} else {
+			row[art] = 1
+			basis[i] = art
+			art++
+		}
+		tableau[i] = row
+	}
+	isArt := func(j int) bool { return j >= n+nslk }
+	// Phase 1: minimize the artificial variables
+	cost := make([]float64, ncols)
+	for j := n + nslk; j < ncols; j++ {
+		cost[j] = 1
+	}
+	if !simplex(tableau, basis, cost, func(int) bool { return true }) {
+		return nil, false
+	}
+	for i, b := range basis {
+		if isArt(b) && tableau[i][ncols] > lpEpsilon {
+			return nil, false
+		}
+	}
+	// Drive the remaining artificial variables out of the basis
+	for i, b := range basis {
+		if !isArt(b) {
+			continue
+		}
+		for j := 0; j < n+nslk; j++ {
+			if stdmath.Abs(tableau[i][j]) > lpEpsilon {
+				pivot(tableau, basis, i, j)
+				break
+			}
+		}
+	}
+	// Phase 2: minimize objective
+	cost = make([]float64, ncols)
+	copy(cost, objective)
+	if !simplex(tableau, basis, cost, func(j int) bool { return !isArt(j) }) {
+		return nil, false
+	}
+	x := make([]float64, n)
+	for i, b := range basis {
+		if b < n {
+			x[b] = tableau[i][ncols]
+		}
+	}
+	return x, true
+}
+
+// simplex minimizes cost from the feasible basis, only the columns allowed
+// can enter the basis. It returns false if the problem is unbounded.
+func simplex(tableau [][]float64, basis []int, cost []float64, allowed func(int) bool) bool {
+	ncols := len(cost)
+	for {
+		// Bland's rule: the first column with a negative reduced cost enters
+		enter := -1
+		for j := 0; j < ncols && enter < 0; j++ {
+			if !allowed(j) || slices.Contains(basis, j) {
+				continue
+			}
+			reduced := cost[j]
+			for i, b := range basis {
+				reduced -= cost[b] * tableau[i][j]
+			}
+			if reduced < -lpEpsilon {
+				enter = j
+			}
+		}
+		if enter < 0 {
+			return true
+		}
+		leave := -1
+		for i, row := range tableau {
+			if row[enter] <= lpEpsilon {
+				continue
+			}
+			if leave < 0 {
+				leave = i
+				continue
+			}
+			ratio, best := row[ncols]/row[enter], tableau[leave][ncols]/tableau[leave][enter]
+			if ratio < best-lpEpsilon || (ratio <= best+lpEpsilon && basis[i] < basis[leave]) {
+				leave = i
+			}
+		}
+		if leave < 0 {
+			return false
+		}
+		pivot(tableau, basis, leave, enter)
+	}
+}
+
+func pivot(tableau [][]float64, basis []int, row, col int) {
+	p := tableau[row][col]
+	for j := range tableau[row] {
+		tableau[row][j] /= p
+	}
+	for i := range tableau {
+		if i == row || tableau[i][col] == 0 {
+			continue
+		}
+		f := tableau[i][col]
+		for j := range tableau[i] {
+			tableau[i][j] -= f * tableau[row][j]
+		}
+	}
+	basis[row] = col
+}
+
+// printShareConstraints prints the multipliers of the fixed buckets of a and
+// its shares of the buckets of constraints.
+func printShareConstraints(constraints []shareConstraint, a airdrop) {
+	var multipliers []string
+	for _, b := range a.params.buckets {
+		if b.Target == "" {
+			multipliers = append(multipliers, fmt.Sprintf("%s x%v", b.Name, b.Multiplier.MustFloat64()))
+		}
+	}
+	fmt.Printf("Share constraints (multipliers: %s)\n", strings.Join(multipliers, " / "))
+	table := newMarkdownTable("Constraint", "Share", "Met")
+	for _, c := range constraints {
+		share := c.share(a)
+		met := "yes"
+		if !c.met(share) {
+			met = "NO"
+		}
+		table.Append([]string{c.String(), humanPercent(share), met})
+	}
+	table.Render()
+	fmt.Println()
+}
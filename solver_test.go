@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cosmossdk.io/math"
+
+	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types/v1beta1"
+)
+
+func TestParseShareConstraints(t *testing.T) {
+	tests := []struct {
+		name                string
+		s                   string
+		expectedConstraints []shareConstraint
+		expectedError       string
+	}{
+		{
+			name: "ok",
+			s:    "yes<=20%, no + nwv>=0.4,abs=0",
+			expectedConstraints: []shareConstraint{
+				{Buckets: []string{"yes"}, Op: shareAtMost, Share: math.LegacyNewDecWithPrec(2, 1)},
+				{Buckets: []string{"no", "nwv"}, Op: shareAtLeast, Share: math.LegacyNewDecWithPrec(4, 1)},
+				{Buckets: []string{"abs"}, Op: shareEqual, Share: math.LegacyZeroDec()},
+			},
+		},
+		{
+			name:          "missing op",
+			s:             "yes",
+			expectedError: "invalid share constraint 'yes', expected <buckets> <=|>=|= <share>",
+		},
+		{
+			name:          "missing buckets",
+			s:             "<=0.2",
+			expectedError: "share constraint '<=0.2': missing bucket name",
+		},
+		{
+			name:          "share above 1",
+			s:             "yes>=120%",
+			expectedError: "share constraint 'yes>=120%': share must be between 0 and 1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			constraints, err := parseShareConstraints(tt.s)
+
+			if tt.expectedError != "" {
+				require.ErrorContains(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedConstraints, constraints)
+		})
+	}
+}
+
+func TestSolveLP(t *testing.T) {
+	// min x + y with x + 2y >= 4, x - y <= 1, y <= 3
+	x, ok := solveLP([]float64{1, 1}, []lpConstraint{
+		{coefs: []float64{1, 2}, op: shareAtLeast, rhs: 4},
+		{coefs: []float64{1, -1}, op: shareAtMost, rhs: 1},
+		{coefs: []float64{0, 1}, op: shareAtMost, rhs: 3},
+	})
+
+	require.True(t, ok)
+	assert.InDeltaSlice(t, []float64{0, 2}, x, 1e-9)
+
+	_, ok = solveLP([]float64{1}, []lpConstraint{
+		{coefs: []float64{1}, op: shareAtLeast, rhs: 2},
+		{coefs: []float64{1}, op: shareAtMost, rhs: 1},
+	})
+
+	assert.False(t, ok)
+}
+
+func TestSolveShareConstraints(t *testing.T) {
+	var (
+		staked = func(addr string, vote govtypes.VoteOption) Account {
+			return Account{
+				Address:      addr,
+				LiquidAmount: math.LegacyZeroDec(),
+				StakedAmount: math.LegacyNewDec(100),
+				Vote:         govtypes.NewNonSplitVoteOption(vote),
+			}
+		}
+		accounts = []Account{
+			staked("yes", govtypes.OptionYes),
+			staked("no", govtypes.OptionNo),
+			staked("nwv", govtypes.OptionNoWithVeto),
+			staked("abs", govtypes.OptionAbstain),
+			{Address: "liquid", LiquidAmount: math.LegacyNewDec(100), StakedAmount: math.LegacyZeroDec()},
+		}
+		multiplier = func(params distriParams, name string) math.LegacyDec {
+			return params.buckets[bucketIndex(params.buckets, name)].Multiplier
+		}
+	)
+	tests := []struct {
+		name                string
+		constraints         string
+		expectedMultipliers map[string]math.LegacyDec
+		expectedError       string
+	}{
+		{
+			name:        "already met",
+			constraints: "yes<=50%",
+			expectedMultipliers: map[string]math.LegacyDec{
+				"yes": math.LegacyOneDec(),
+				"no":  math.LegacyNewDec(9),
+				"nwv": math.LegacyNewDec(9),
+			},
+		},
+		{
+			name:        "yes at least",
+			constraints: "yes>=20%",
+		},
+		{
+			// The constraint binds exactly, the multiplier rounded to
+			// solverPrecision decimals must still meet it with shareTolerance.
+			name:        "yes at its bound",
+			constraints: "yes=20%",
+		},
+		{
+			name:        "yes and no",
+			constraints: "yes<=20%,no+nwv>=40%,no+nwv<=50%",
+		},
+		{
+			name:          "unknown bucket",
+			constraints:   "foo<=20%",
+			expectedError: "share constraint 'foo <= 20.00 %': unknown bucket 'foo'",
+		},
+		{
+			name:          "overlapping buckets",
+			constraints:   "yes+no<=50%,no+nwv>=40%",
+			expectedError: "bucket 'no' is in share constraints with different buckets",
+		},
+		{
+			name:          "only targets",
+			constraints:   "abs+liquid<=20%",
+			expectedError: "share constraints require buckets with a fixed multiplier",
+		},
+		{
+			name:          "infeasible",
+			constraints:   "yes>=50%,no+nwv>=50%",
+			expectedError: "share constraints can't all be met",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+			assert := assert.New(t)
+			constraints, err := parseShareConstraints(tt.constraints)
+			require.NoError(err)
+
+			params, err := solveShareConstraints(accounts, defaultDistriParams(), defaultRules(), constraints)
+
+			if tt.expectedError != "" {
+				require.EqualError(err, tt.expectedError)
+				return
+			}
+			require.NoError(err)
+			for name, m := range tt.expectedMultipliers {
+				assert.Equal(m.String(), multiplier(params, name).String(), "multiplier of %s", name)
+			}
+			assert.Equal(multiplier(params, "no"), multiplier(params, "nwv"))
+			airdrop, err := distribution(accounts, params, "", defaultRules())
+			require.NoError(err)
+			for _, c := range constraints {
+				share := c.share(airdrop)
+				assert.True(c.met(share), "%s not met: %s", c, share)
+			}
+		})
+	}
+}
+
+func TestBucketCoefficientsUnknownTarget(t *testing.T) {
+	params := defaultDistriParams()
+	params.buckets = slices.Clone(params.buckets)
+	params.buckets[0].Target = "foo"
+
+	_, err := bucketCoefficients(nil, params, defaultRules())
+
+	require.EqualError(t, err, fmt.Sprintf("bucket '%s': unknown target 'foo'", params.buckets[0].Name))
+}
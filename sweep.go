@@ -0,0 +1,338 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"cosmossdk.io/math"
+)
+
+// sweepParam is a policy parameter varied by a sweep, named like the fields of
+// the policy file:
+//   - buckets.<name>[+<name>...].multiplier
+//   - buckets.<name>[+<name>...].bonus_malus
+//   - normalization_targets.<name>
+//   - supply_factor, supply_mint_factor, community_pool_share or account_cap
+type sweepParam struct {
+	Name   string
+	Values []math.LegacyDec
+}
+
+const (
+	// maxSweepValues is the maximum number of values of a sweep parameter.
+	maxSweepValues = 1000
+	// maxSweepRuns is the maximum number of combinations of the sweep
+	// parameter values, each of them computing an airdrop.
+	maxSweepRuns = 10000
+)
+
+// parseSweepParams parses semicolon separated parameter ranges, like
+// "buckets.yes.multiplier=1:5:0.5;supply_factor=0.1,0.2". Values are either
+// comma separated, or <start>:<end>:<step> with end included. The number of
+// values is limited to maxSweepValues per parameter and the number of
+// combinations to maxSweepRuns.
+func parseSweepParams(s string) ([]sweepParam, error) {
+	var (
+		params []sweepParam
+		runs   = 1
+	)
+	for _, item := range strings.Split(s, ";") {
+		name, values, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid sweep parameter '%s', expected <name>=<values>", item)
+		}
+		p := sweepParam{Name: name}
+		if start, rest, ok := strings.Cut(values, ":"); ok {
+			end, step, _ := strings.Cut(rest, ":")
+			var (
+				bounds = make([]math.LegacyDec, 3)
+				err    error
+			)
+			for i, v := range []string{start, end, step} {
+				if bounds[i], err = math.LegacyNewDecFromStr(v); err != nil {
+					return nil, fmt.Errorf("sweep parameter '%s': invalid range '%s', expected <start>:<end>:<step>", name, values)
+				}
+			}
+			if !bounds[2].IsPositive() || bounds[1].LT(bounds[0]) {
+				return nil, fmt.Errorf("sweep parameter '%s': invalid range '%s', expected a positive step and end >= start", name, values)
+			}
+			for v := bounds[0]; v.LTE(bounds[1]); v = v.Add(bounds[2]) {
+				if len(p.Values) == maxSweepValues {
+					return nil, fmt.Errorf("sweep parameter '%s': more than %d values", name, maxSweepValues)
+				}
+				p.Values = append(p.Values, v)
+			}
+		} else {
+			items := strings.Split(values, ",")
+			if len(items) > maxSweepValues {
+				return nil, fmt.Errorf("sweep parameter '%s': more than %d values", name, maxSweepValues)
+			}
+			for _, v := range items {
+				d, err := math.LegacyNewDecFromStr(v)
+				if err != nil {
+					return nil, fmt.Errorf("sweep parameter '%s': invalid value '%s'", name, v)
+				}
+				p.Values = append(p.Values, d)
+			}
+		}
+		if runs *= len(p.Values); runs > maxSweepRuns {
+			return nil, fmt.Errorf("sweep parameters: more than %d runs", maxSweepRuns)
+		}
+		params = append(params, p)
+	}
+	return params, nil
+}
+
+// apply returns params with the parameter p set to v.
+func (p sweepParam) apply(params distriParams, v math.LegacyDec) (distriParams, error) {
+	if v.IsNegative() {
+		return params, fmt.Errorf("sweep parameter '%s': negative value %s", p.Name, v)
+	}
+	switch p.Name {
+	case "supply_factor":
+		params.supplyFactor = v
+	case "supply_mint_factor":
+		params.supplyMintFactor = v
+	case "community_pool_share":
+		params.communityPoolShare = v
+	case "account_cap":
+		if !v.IsInteger() || !v.IsPositive() {
+			return params, fmt.Errorf("sweep parameter '%s': invalid value %s, expected a positive integer", p.Name, v)
+		}
+		params.accountCap = v.TruncateInt()
+	default:
+		if name, ok := strings.CutPrefix(p.Name, "normalization_targets."); ok {
+			if _, ok := params.targets[name]; !ok {
+				return params, fmt.Errorf("sweep parameter '%s': unknown target '%s'", p.Name, name)
+			}
+			params.targets = maps.Clone(params.targets)
+			params.targets[name] = v
+			break
+		}
+		names, ok := strings.CutPrefix(p.Name, "buckets.")
+		if !ok {
+			return params, fmt.Errorf("unknown sweep parameter '%s'", p.Name)
+		}
+		names, field, _ := strings.Cut(names, ".")
+		switch field {
+		case "multiplier":
+			return params.withMultiplier(v, strings.Split(names, "+")...)
+		case "bonus_malus":
+			params.buckets = slices.Clone(params.buckets)
+			for _, name := range strings.Split(names, "+") {
+				i := bucketIndex(params.buckets, name)
+				if i < 0 {
+					return params, fmt.Errorf("sweep parameter '%s': unknown bucket '%s'", p.Name, name)
+				}
+				params.buckets[i].BonusMalus = v
+			}
+		default:
+			return params, fmt.Errorf("sweep parameter '%s': unknown bucket field '%s', expected multiplier or bonus_malus", p.Name, field)
+		}
+	}
+	return params, nil
+}
+
+// sweepRun is a combination of the values of the sweep parameters.
+type sweepRun struct {
+	Values []math.LegacyDec
+	params distriParams
+}
+
+// sweepRuns returns all the combinations of the values of sweepParams applied
+// to policy.
+func sweepRuns(policy distriParams, sweepParams []sweepParam) ([]sweepRun, error) {
+	runs := []sweepRun{{params: policy}}
+	for _, sp := range sweepParams {
+		var next []sweepRun
+		for _, r := range runs {
+			for _, v := range sp.Values {
+				params, err := sp.apply(r.params, v)
+				if err != nil {
+					return nil, err
+				}
+				next = append(next, sweepRun{
+					Values: append(slices.Clone(r.Values), v),
+					params: params,
+				})
+			}
+		}
+		runs = next
+	}
+	for _, r := range runs {
+		if err := validateBuckets(r.params.buckets, r.params.targets); err != nil {
+			return nil, fmt.Errorf("sweep values %v: %w", r.Values, err)
+		}
+		if r.params.communityPoolShare.GT(math.LegacyOneDec()) {
+			return nil, fmt.Errorf("sweep values %v: community_pool_share must be between 0 and 1", r.Values)
+		}
+	}
+	return runs, nil
+}
+
+// sweepRow is the result of a sweepRun.
+type sweepRow struct {
+	// Params holds the values of the sweep parameters, by name.
+	Params map[string]math.LegacyDec `json:"params"`
+	// Distributed is the airdropped supply, Supply includes the minted part.
+	Distributed math.LegacyDec `json:"distributed"`
+	Supply      math.LegacyDec `json:"supply"`
+	// Shares holds the share of the distributed supply of each bucket.
+	Shares map[string]math.LegacyDec `json:"shares"`
+	// Gini is the Gini coefficient of the airdrop amounts.
+	Gini math.LegacyDec `json:"gini"`
+	// TopShares holds the share of the airdrop held by the top N recipients,
+	// by N.
+	TopShares  map[int]math.LegacyDec `json:"top_shares"`
+	Recipients int                    `json:"recipients"`
+}
+
+// runSweep computes the airdrop of accounts for each of runs, with workers
+// in parallel, and returns one sweepRow per run.
+func runSweep(accounts []Account, rules *accountRules, sweepParams []sweepParam, runs []sweepRun, workers int, topN []int) ([]sweepRow, error) {
+	var (
+		rows    = make([]sweepRow, len(runs))
+		errs    = make([]error, len(runs))
+		wg      sync.WaitGroup
+		indexes = make(chan int)
+	)
+	for range max(workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// distribution writes into the rules audit log
+			rules := rules.withoutAudit()
+			for i := range indexes {
+				airdrop, err := distribution(accounts, runs[i].params, "", rules)
+				if err != nil {
+					errs[i] = err
+					continue
+				}
+				rows[i] = newSweepRow(sweepParams, runs[i], airdrop, topN)
+			}
+		}()
+	}
+	for i := range runs {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return rows, errors.Join(errs...)
+}
+
+func newSweepRow(sweepParams []sweepParam, run sweepRun, a airdrop, topN []int) sweepRow {
+	var (
+		amounts = sortedAmounts(a.addresses)
+		total   = sumAmounts(amounts)
+		row     = sweepRow{
+			Params:      make(map[string]math.LegacyDec, len(sweepParams)),
+			Distributed: a.atone.supply,
+			Supply:      a.atone.supply.Add(a.communityPool).Add(a.reservedAddr),
+			Shares:      make(map[string]math.LegacyDec, len(a.params.buckets)),
+			Gini:        a.atoneConcentration.Gini,
+			TopShares:   make(map[int]math.LegacyDec, len(topN)),
+			Recipients:  len(amounts),
+		}
+	)
+	for i, p := range sweepParams {
+		row.Params[p.Name] = run.Values[i]
+	}
+	for i, b := range a.params.buckets {
+		row.Shares[b.Name] = math.LegacyZeroDec()
+		if a.atone.supply.IsPositive() {
+			row.Shares[b.Name] = a.atone.buckets[i].Quo(a.atone.supply)
+		}
+	}
+	for _, n := range topN {
+		row.TopShares[n] = topShare(amounts, total, n)
+	}
+	return row
+}
+
+// writeSweepReport writes rows into path, in JSON if the file extension is
+// .json, or else in CSV with one column per parameter, bucket share and top N
+// share.
+func writeSweepReport(path string, sweepParams []sweepParam, buckets []bucket, topN []int, rows []sweepRow) error {
+	if filepath.Ext(path) == ".json" {
+		bz, err := json.MarshalIndent(rows, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, append(bz, '\n'), 0o644); err != nil {
+			return err
+		}
+		fmt.Printf("%s file created.\n", path)
+		return nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	var header []string
+	for _, p := range sweepParams {
+		header = append(header, p.Name)
+	}
+	header = append(header, "distributed", "supply")
+	for _, b := range buckets {
+		header = append(header, b.Name+"_share")
+	}
+	header = append(header, "gini")
+	for _, n := range topN {
+		header = append(header, fmt.Sprintf("top_%d_share", n))
+	}
+	if err := w.Write(append(header, "recipients")); err != nil {
+		f.Close()
+		return err
+	}
+	for _, r := range rows {
+		var record []string
+		for _, p := range sweepParams {
+			record = append(record, r.Params[p.Name].String())
+		}
+		record = append(record, r.Distributed.String(), r.Supply.String())
+		for _, b := range buckets {
+			record = append(record, r.Shares[b.Name].String())
+		}
+		record = append(record, r.Gini.String())
+		for _, n := range topN {
+			record = append(record, r.TopShares[n].String())
+		}
+		if err := w.Write(append(record, strconv.Itoa(r.Recipients))); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("%s file created.\n", path)
+	return nil
+}
+
+// parseTopN parses comma separated positive integers.
+func parseTopN(s string) ([]int, error) {
+	var topN []int
+	for _, v := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid top N '%s', expected a positive integer", v)
+		}
+		topN = append(topN, n)
+	}
+	return topN, nil
+}
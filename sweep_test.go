@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cosmossdk.io/math"
+
+	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types/v1beta1"
+)
+
+func TestParseSweepParams(t *testing.T) {
+	decs := func(vs ...string) []math.LegacyDec {
+		ds := make([]math.LegacyDec, len(vs))
+		for i, v := range vs {
+			ds[i] = math.LegacyMustNewDecFromStr(v)
+		}
+		return ds
+	}
+	tests := []struct {
+		name           string
+		s              string
+		expectedParams []sweepParam
+		expectedError  string
+	}{
+		{
+			name: "ok",
+			s:    "buckets.yes.multiplier=1:2:0.5; supply_factor=0.1,0.2",
+			expectedParams: []sweepParam{
+				{Name: "buckets.yes.multiplier", Values: decs("1", "1.5", "2")},
+				{Name: "supply_factor", Values: decs("0.1", "0.2")},
+			},
+		},
+		{
+			name:          "missing values",
+			s:             "supply_factor",
+			expectedError: "invalid sweep parameter 'supply_factor', expected <name>=<values>",
+		},
+		{
+			name:          "invalid range",
+			s:             "supply_factor=1:0:1",
+			expectedError: "sweep parameter 'supply_factor': invalid range '1:0:1', expected a positive step and end >= start",
+		},
+		{
+			name:          "invalid value",
+			s:             "supply_factor=x",
+			expectedError: "sweep parameter 'supply_factor': invalid value 'x'",
+		},
+		{
+			name:          "too many range values",
+			s:             "supply_factor=0:1:0.0001",
+			expectedError: "sweep parameter 'supply_factor': more than 1000 values",
+		},
+		{
+			name:          "too many values",
+			s:             "supply_factor=" + strings.Repeat("0.1,", 1000) + "0.1",
+			expectedError: "sweep parameter 'supply_factor': more than 1000 values",
+		},
+		{
+			name:          "too many runs",
+			s:             "supply_factor=0:0.99:0.01;supply_mint_factor=0:1:0.01",
+			expectedError: "sweep parameters: more than 10000 runs",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := parseSweepParams(tt.s)
+
+			if tt.expectedError != "" {
+				require.EqualError(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedParams, params)
+		})
+	}
+}
+
+func TestSweepRuns(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	sweepParams, err := parseSweepParams("buckets.no+nwv.multiplier=5,9;normalization_targets.non_voters=0.2,0.3;account_cap=1000")
+	require.NoError(err)
+
+	policy := defaultDistriParams()
+
+	runs, err := sweepRuns(policy, sweepParams)
+
+	require.NoError(err)
+	require.Len(runs, 4)
+	last := runs[3].params
+	assert.Equal(math.LegacyNewDec(9), last.buckets[bucketIndex(last.buckets, "no")].Multiplier)
+	assert.Equal(math.LegacyNewDec(9), last.buckets[bucketIndex(last.buckets, "nwv")].Multiplier)
+	assert.Equal(math.LegacyNewDecWithPrec(3, 1), last.targets["non_voters"])
+	assert.Equal(math.NewInt(1000), last.accountCap)
+	first := runs[0].params
+	assert.Equal(math.LegacyNewDec(5), first.buckets[bucketIndex(first.buckets, "no")].Multiplier)
+	assert.Equal(math.LegacyNewDecWithPrec(2, 1), first.targets["non_voters"])
+	// the policy is unchanged
+	assert.Equal(defaultDistriParams(), policy)
+
+	for _, s := range []string{"foo=1", "buckets.foo.multiplier=1", "buckets.abs.multiplier=1", "normalization_targets.foo=0.1", "normalization_targets.non_voters=1"} {
+		sweepParams, err := parseSweepParams(s)
+		require.NoError(err)
+		_, err = sweepRuns(defaultDistriParams(), sweepParams)
+		assert.Error(err, s)
+	}
+}
+
+func TestRunSweep(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	var (
+		accounts = []Account{
+			{
+				Address:      "yes",
+				LiquidAmount: math.LegacyZeroDec(),
+				StakedAmount: math.LegacyNewDec(300),
+				Vote:         govtypes.NewNonSplitVoteOption(govtypes.OptionYes),
+			},
+			{Address: "liquid", LiquidAmount: math.LegacyNewDec(100), StakedAmount: math.LegacyZeroDec()},
+		}
+		topN   = []int{1}
+		policy = defaultDistriParams()
+	)
+	policy.supplyFactor = math.LegacyOneDec()
+	sweepParams, err := parseSweepParams("buckets.yes.multiplier=1,2")
+	require.NoError(err)
+	runs, err := sweepRuns(policy, sweepParams)
+	require.NoError(err)
+
+	rows, err := runSweep(accounts, defaultRules(), sweepParams, runs, 2, topN)
+
+	require.NoError(err)
+	require.Len(rows, 2)
+	for i, r := range rows {
+		// non-voters get 33% of the airdrop, minus the malus
+		yes := math.LegacyNewDec(300 * int64(i+1))
+		liquid := yes.Mul(math.LegacyNewDecWithPrec(33, 2)).Quo(math.LegacyNewDecWithPrec(67, 2)).Mul(math.LegacyNewDecWithPrec(97, 2))
+		assert.Equal(math.LegacyNewDec(int64(i+1)), r.Params["buckets.yes.multiplier"])
+		assert.InDelta(yes.Add(liquid).MustFloat64(), r.Distributed.MustFloat64(), 1e-9)
+		assert.InDelta(yes.Quo(yes.Add(liquid)).MustFloat64(), r.Shares["yes"].MustFloat64(), 1e-9)
+		assert.Equal(math.LegacyZeroDec(), r.Shares["no"])
+		assert.Equal(2, r.Recipients)
+		assert.Equal(yes.RoundInt().ToLegacyDec().Quo(yes.RoundInt().Add(liquid.RoundInt()).ToLegacyDec()), r.TopShares[1])
+		assert.True(r.Gini.IsPositive())
+	}
+
+	path := filepath.Join(t.TempDir(), "sweep.csv")
+	require.NoError(writeSweepReport(path, sweepParams, policy.buckets, topN, rows))
+	f, err := os.Open(path)
+	require.NoError(err)
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	require.NoError(err)
+	require.Len(records, 3)
+	assert.Equal([]string{
+		"buckets.yes.multiplier", "distributed", "supply", "yes_share", "no_share", "nwv_share",
+		"abs_share", "dnv_share", "liquid_share", "gini", "top_1_share", "recipients",
+	}, records[0])
+	assert.Equal("2.000000000000000000", records[2][0])
+	assert.Equal("2", records[2][11])
+}
+
+func TestSweepParamApplyAccountCap(t *testing.T) {
+	p := sweepParam{Name: "account_cap"}
+
+	params, err := p.apply(defaultDistriParams(), math.LegacyNewDec(1000))
+	require.NoError(t, err)
+	assert.Equal(t, math.NewInt(1000), params.accountCap)
+
+	_, err = p.apply(defaultDistriParams(), math.LegacyZeroDec())
+	require.EqualError(t, err, "sweep parameter 'account_cap': invalid value 0.000000000000000000, expected a positive integer")
+
+	_, err = p.apply(defaultDistriParams(), math.LegacyNewDecWithPrec(15, 1))
+	require.EqualError(t, err, "sweep parameter 'account_cap': invalid value 1.500000000000000000, expected a positive integer")
+}
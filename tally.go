@@ -1,34 +1,138 @@
 package main
 
 import (
+	"cmp"
+	"context"
+	"encoding/csv"
 	"fmt"
+	"os"
+	"slices"
+	"strings"
 
 	h "github.com/dustin/go-humanize"
 
 	"cosmossdk.io/math"
 
+	sdk "github.com/cosmos/cosmos-sdk/types"
 	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types/v1beta1"
-	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
 )
 
-func tally(
-	votesByAddr map[string]govtypes.WeightedVoteOptions, valsByAddr map[string]govtypes.ValidatorGovInfo,
-	delegsByAddr map[string][]stakingtypes.Delegation,
-) (map[govtypes.VoteOption]math.LegacyDec, math.LegacyDec) {
+// tallyMode defines how the votes are counted.
+type tallyMode int
+
+const (
+	// modeInheritance counts the direct votes, and the votes of the validators
+	// for the delegators who didn't vote (cosmos-sdk x/gov).
+	modeInheritance tallyMode = iota
+	// modeNoInheritance counts only the direct votes, validators vote only
+	// with their self-delegation (AtomOne x/gov).
+	modeNoInheritance
+	// modeDirectOnly counts only the direct votes of the delegators, the votes
+	// of the validators are ignored.
+	modeDirectOnly
+)
+
+var tallyModes = []tallyMode{modeInheritance, modeNoInheritance, modeDirectOnly}
+
+func (m tallyMode) String() string {
+	switch m {
+	case modeInheritance:
+		return "inheritance"
+	case modeNoInheritance:
+		return "no-inheritance"
+	case modeDirectOnly:
+		return "direct-only"
+	}
+	return "unknown"
+}
+
+func parseTallyMode(s string) (tallyMode, error) {
+	for _, m := range tallyModes {
+		if m.String() == s {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown tally mode '%s'", s)
+}
+
+// loadTallySnapshot returns the proposal of the snapshot directory path and
+// the snapshot parts required by tally.
+func loadTallySnapshot(ctx context.Context, path string, noCache bool) (govProposal, *Snapshot, error) {
+	if err := verifyManifest(path, "prop.json"); err != nil {
+		return govProposal{}, nil, err
+	}
+	prop, err := parseProposal(path)
+	if err != nil {
+		return govProposal{}, nil, err
+	}
+	if prop.Format == govAtomOne {
+		setAtomOneBech32Prefixes()
+	}
+	snap, err := loadSnapshot(ctx, path, snapshotOptions{
+		parts:   partVotes | partValidators | partDelegations,
+		noCache: noCache,
+	})
+	if err != nil {
+		return govProposal{}, nil, err
+	}
+	return prop, snap, nil
+}
+
+// validatorTally is the tally detail of an active validator.
+type validatorTally struct {
+	OperatorAddress string
+	Moniker         string
+	Vote            govtypes.WeightedVoteOptions
+	BondedTokens    math.Int
+	// OverriddenPower is the voting power of the delegations of the delegators
+	// who voted themselves (including the validator self-delegation if the
+	// validator voted).
+	OverriddenPower math.LegacyDec
+	// InheritedPower is the voting power of the other delegations, counted
+	// with the validator vote. It is zero if the validator didn't vote or
+	// if mode isn't modeInheritance.
+	InheritedPower math.LegacyDec
+}
+
+// tallyResult is the result of tally.
+type tallyResult struct {
+	Results          map[govtypes.VoteOption]math.LegacyDec
+	TotalVotingPower math.LegacyDec
+	// Validators holds the tally detail of the active validators, sorted by
+	// descending bonded tokens.
+	Validators []validatorTally
+}
+
+// tally computes the tally of the votes of snap, following the x/gov tally
+// rules with the given mode. snap isn't modified.
+func tally(snap *Snapshot, mode tallyMode) tallyResult {
 	var (
-		results = map[govtypes.VoteOption]math.LegacyDec{
+		votesByAddr  = snap.VotesByAddr
+		valsByAddr   = snap.ValsByAddr
+		delegsByAddr = snap.DelegsByAddr
+		results      = map[govtypes.VoteOption]math.LegacyDec{
 			govtypes.OptionYes:        math.LegacyZeroDec(),
 			govtypes.OptionAbstain:    math.LegacyZeroDec(),
 			govtypes.OptionNo:         math.LegacyZeroDec(),
 			govtypes.OptionNoWithVeto: math.LegacyZeroDec(),
 		}
 		totalVotingPower = math.LegacyZeroDec()
+		// delegator shares of the validators that have voted, by validator
+		deductions = make(map[string]math.LegacyDec)
+		// account addresses of the validators, ignored in modeDirectOnly
+		valAccAddrs = make(map[string]bool)
 	)
+	if mode == modeDirectOnly {
+		for _, val := range valsByAddr {
+			valAccAddrs[sdk.AccAddress(val.Address).String()] = true
+		}
+	}
 	for voterAddr, vote := range votesByAddr {
+		if valAccAddrs[voterAddr] {
+			continue
+		}
 		// Check voter delegations
 		dels := delegsByAddr[voterAddr]
-		// Initialize voter balance
-		// balance := sdk.NewDec(0)
 		for _, del := range dels {
 			val, ok := valsByAddr[del.ValidatorAddress]
 			if !ok {
@@ -36,8 +140,11 @@ func tally(
 				continue
 			}
 			// Reduce validator voting power with delegation that has voted
-			val.DelegatorDeductions = val.DelegatorDeductions.Add(del.GetShares())
-			valsByAddr[del.ValidatorAddress] = val
+			deduction, ok := deductions[del.ValidatorAddress]
+			if !ok {
+				deduction = math.LegacyZeroDec()
+			}
+			deductions[del.ValidatorAddress] = deduction.Add(del.GetShares())
 
 			// delegation shares * bonded / total shares
 			votingPower := del.GetShares().MulInt(val.BondedTokens).Quo(val.DelegatorShares)
@@ -50,50 +157,361 @@ func tally(
 		}
 	}
 	// iterate over the validators again to tally their voting power
-	for _, val := range valsByAddr {
-		if len(val.Vote) == 0 {
-			continue
+	validators := make([]validatorTally, 0, len(valsByAddr))
+	for addr, val := range valsByAddr {
+		deduction, ok := deductions[addr]
+		if !ok {
+			deduction = math.LegacyZeroDec()
 		}
-		sharesAfterDeductions := val.DelegatorShares.Sub(val.DelegatorDeductions)
-		votingPower := sharesAfterDeductions.MulInt(val.BondedTokens).Quo(val.DelegatorShares)
+		vt := validatorTally{
+			OperatorAddress: addr,
+			Moniker:         snap.ValMonikersByAddr[addr],
+			Vote:            val.Vote,
+			BondedTokens:    val.BondedTokens,
+			OverriddenPower: math.LegacyZeroDec(),
+			InheritedPower:  math.LegacyZeroDec(),
+		}
+		if !val.DelegatorShares.IsZero() {
+			vt.OverriddenPower = deduction.MulInt(val.BondedTokens).Quo(val.DelegatorShares)
+		}
+		if mode == modeInheritance && len(val.Vote) > 0 {
+			sharesAfterDeductions := val.DelegatorShares.Sub(deduction)
+			votingPower := sharesAfterDeductions.MulInt(val.BondedTokens).Quo(val.DelegatorShares)
 
-		for _, option := range val.Vote {
-			subPower := votingPower.Mul(option.Weight)
-			results[option.Option] = results[option.Option].Add(subPower)
+			for _, option := range val.Vote {
+				subPower := votingPower.Mul(option.Weight)
+				results[option.Option] = results[option.Option].Add(subPower)
+			}
+			totalVotingPower = totalVotingPower.Add(votingPower)
+			vt.InheritedPower = votingPower
 		}
-		totalVotingPower = totalVotingPower.Add(votingPower)
+		validators = append(validators, vt)
+	}
+	slices.SortFunc(validators, func(a, b validatorTally) int {
+		return cmp.Or(b.BondedTokens.BigInt().Cmp(a.BondedTokens.BigInt()), cmp.Compare(a.OperatorAddress, b.OperatorAddress))
+	})
+	return tallyResult{
+		Results:          results,
+		TotalVotingPower: totalVotingPower,
+		Validators:       validators,
 	}
-	return results, totalVotingPower
 }
 
-func printTallyResults(results map[govtypes.VoteOption]math.LegacyDec, totalVotingPower math.LegacyDec, prop govtypes.Proposal) {
+func printTallyResults(results map[govtypes.VoteOption]math.LegacyDec, totalVotingPower math.LegacyDec, prop govProposal) {
+	fmt.Println("Proposal", prop.ID, "format", prop.Format)
 	fmt.Println("Computed total voting power", h.Comma(totalVotingPower.TruncateInt64()))
-	yesPercent := results[govtypes.OptionYes].
-		Quo(totalVotingPower.Sub(results[govtypes.OptionAbstain]))
+	yesPercent := math.LegacyZeroDec()
+	if nonAbstain := totalVotingPower.Sub(results[govtypes.OptionAbstain]); nonAbstain.IsPositive() {
+		yesPercent = results[govtypes.OptionYes].Quo(nonAbstain)
+	}
 	fmt.Println("Yes percent:", yesPercent)
-	tallyResult := govtypes.NewTallyResultFromMap(results)
+	options := voteOptions(prop.Format)
 
 	fmt.Println("--- TALLY RESULT ---")
-	table := newMarkdownTable("", "Yes", "No", "NoWithVeto", "Abstain", "Total")
-	appendTable := func(source string, t govtypes.TallyResult) {
-		total := t.Yes.Add(t.No).Add(t.Abstain).Add(t.NoWithVeto)
+	header := []string{""}
+	for _, o := range options {
+		header = append(header, voteOptionName(o))
+	}
+	table := newMarkdownTable(append(header, "Total")...)
+	appendTable := func(source string, amount func(govtypes.VoteOption) math.Int) {
+		var (
+			row   = []string{source}
+			total = math.ZeroInt()
+		)
+		for _, o := range options {
+			row = append(row, human(amount(o)))
+			total = total.Add(amount(o))
+		}
+		table.Append(append(row, human(total)))
+	}
+	computed := func(o govtypes.VoteOption) math.Int { return results[o].TruncateInt() }
+	fromProp := func(o govtypes.VoteOption) math.Int {
+		if amt, ok := prop.FinalTallyResult[o]; ok {
+			return amt
+		}
+		return math.ZeroInt()
+	}
+	appendTable("computed", computed)
+	appendTable("from prop", fromProp)
+	appendTable("diff", func(o govtypes.VoteOption) math.Int { return computed(o).Sub(fromProp(o)) })
+	table.Render()
+}
+
+// voteOptions returns the vote options of format, in display order.
+func voteOptions(format govFormat) []govtypes.VoteOption {
+	options := []govtypes.VoteOption{govtypes.OptionYes, govtypes.OptionNo}
+	if format.hasVeto() {
+		options = append(options, govtypes.OptionNoWithVeto)
+	}
+	return append(options, govtypes.OptionAbstain)
+}
+
+// modeTally is the tally of a proposal with a tally mode, and its outcome if
+// the gov params are known.
+type modeTally struct {
+	Mode    tallyMode
+	Result  tallyResult
+	Verdict *tallyVerdict
+}
+
+// printTallyComparison prints side by side the tallies of prop computed with
+// different modes, and the flips of outcome compared to the first tally.
+func printTallyComparison(tallies []modeTally, prop govProposal) {
+	fmt.Println("--- TALLY BY MODE ---")
+	options := voteOptions(prop.Format)
+	header := []string{"Mode"}
+	for _, o := range options {
+		header = append(header, voteOptionName(o))
+	}
+	table := newMarkdownTable(append(header, "Total", "Yes percent", "Outcome")...)
+	for i, t := range tallies {
+		mode := t.Mode.String()
+		if i == 0 {
+			mode += " (actual)"
+		}
+		row := []string{mode}
+		for _, o := range options {
+			row = append(row, humand(t.Result.Results[o]))
+		}
+		yesPercent := math.LegacyZeroDec()
+		if nonAbstain := t.Result.TotalVotingPower.Sub(t.Result.Results[govtypes.OptionAbstain]); nonAbstain.IsPositive() {
+			yesPercent = t.Result.Results[govtypes.OptionYes].Quo(nonAbstain)
+		}
+		outcome := "-"
+		if t.Verdict != nil {
+			outcome = t.Verdict.Outcome
+		}
+		table.Append(append(row, humand(t.Result.TotalVotingPower), humanPercent(yesPercent), outcome))
+	}
+	table.Render()
+	actual := tallies[0]
+	if actual.Verdict == nil {
+		return
+	}
+	for _, t := range tallies[1:] {
+		if t.Verdict.Passed != actual.Verdict.Passed {
+			fmt.Printf("Outcome flips with %s: %s instead of %s\n", t.Mode, t.Verdict.Outcome, actual.Verdict.Outcome)
+		} else {
+			fmt.Printf("No outcome flip with %s\n", t.Mode)
+		}
+	}
+}
+
+var validatorTallyHeader = []string{
+	"Moniker", "Operator address", "Vote", "Bonded tokens", "Overridden power", "Inherited power",
+}
+
+// printValidatorTallies prints the tally detail of validators as a markdown
+// table, with amounts in millions.
+func printValidatorTallies(validators []validatorTally) {
+	fmt.Println("--- TALLY BY VALIDATOR ---")
+	table := newMarkdownTable(append(validatorTallyHeader, "Inherited percent")...)
+	for _, v := range validators {
+		inheritedPercent := math.LegacyZeroDec()
+		if v.BondedTokens.IsPositive() {
+			inheritedPercent = v.InheritedPower.QuoInt(v.BondedTokens)
+		}
 		table.Append([]string{
-			source,
-			human(t.Yes),
-			human(t.No),
-			human(t.NoWithVeto),
-			human(t.Abstain),
-			human(total),
+			v.Moniker, v.OperatorAddress, formatVote(v.Vote), human(v.BondedTokens),
+			humand(v.OverriddenPower), humand(v.InheritedPower), humanPercent(inheritedPercent),
+		})
+	}
+	table.Render()
+}
+
+// writeValidatorTalliesCSV writes the tally detail of validators into the CSV
+// file at path.
+func writeValidatorTalliesCSV(path string, validators []validatorTally) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	w.Write(validatorTallyHeader)
+	for _, v := range validators {
+		w.Write([]string{
+			v.Moniker, v.OperatorAddress, formatVote(v.Vote), v.BondedTokens.String(),
+			v.OverriddenPower.TruncateInt().String(), v.InheritedPower.TruncateInt().String(),
 		})
 	}
-	appendTable("computed", tallyResult)
-	appendTable("from prop", prop.FinalTallyResult)
-	diff := govtypes.TallyResult{
-		Yes:        tallyResult.Yes.Sub(prop.FinalTallyResult.Yes),
-		Abstain:    tallyResult.Abstain.Sub(prop.FinalTallyResult.Abstain),
-		No:         tallyResult.No.Sub(prop.FinalTallyResult.No),
-		NoWithVeto: tallyResult.NoWithVeto.Sub(prop.FinalTallyResult.NoWithVeto),
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	fmt.Printf("%s file created.\n", path)
+	return nil
+}
+
+// formatVote returns a short form of vote, like "Yes" or "Yes:0.4 No:0.6",
+// "-" if vote is empty.
+func formatVote(vote govtypes.WeightedVoteOptions) string {
+	if len(vote) == 0 {
+		return "-"
+	}
+	if len(vote) == 1 {
+		return voteOptionName(vote[0].Option)
+	}
+	parts := make([]string, len(vote))
+	for i, o := range vote {
+		parts[i] = fmt.Sprintf("%s:%s", voteOptionName(o.Option), strings.TrimRight(strings.TrimRight(o.Weight.String(), "0"), "."))
+	}
+	return strings.Join(parts, " ")
+}
+
+// tallyCheck is a condition of the x/gov tally that a proposal must satisfy
+// to pass.
+type tallyCheck struct {
+	Name     string
+	Value    math.LegacyDec
+	Required string
+	// Margin is the voting power that can be moved before the result of the
+	// check changes, negative if the check fails.
+	Margin math.LegacyDec
+	OK     bool
+}
+
+// Outcomes of a tally, see tallyVerdict.
+const (
+	outcomePassed      = "passed"
+	outcomeNoQuorum    = "rejected, quorum not reached"
+	outcomeOnlyAbstain = "rejected, only abstain votes"
+	outcomeVetoed      = "rejected, vetoed"
+	outcomeNoThreshold = "rejected, threshold not reached"
+)
+
+var outcomes = []string{outcomePassed, outcomeNoQuorum, outcomeOnlyAbstain, outcomeVetoed, outcomeNoThreshold}
+
+// tallyVerdict is the outcome of a tally.
+type tallyVerdict struct {
+	Kind   proposalKind
+	Checks []tallyCheck
+	// Outcome is one of outcomes.
+	Outcome string
+	Passed  bool
+}
+
+// evaluateTally returns the outcome of the tally results of prop, following
+// the order of the checks of the x/gov tally: quorum, veto and threshold.
+// bondedTokens is the total voting power of the chain.
+func evaluateTally(results map[govtypes.VoteOption]math.LegacyDec, totalVotingPower, bondedTokens math.LegacyDec,
+	params govParams, prop govProposal,
+) tallyVerdict {
+	var (
+		v = tallyVerdict{Kind: params.kind(prop)}
+
+		quorum     = params.Quorums[v.Kind]
+		threshold  = params.Thresholds[v.Kind]
+		nonAbstain = totalVotingPower.Sub(results[govtypes.OptionAbstain])
+		quo        = func(a, b math.LegacyDec) math.LegacyDec {
+			if b.IsZero() {
+				return math.LegacyZeroDec()
+			}
+			return a.Quo(b)
+		}
+	)
+	quorumCheck := tallyCheck{
+		Name:     "Quorum",
+		Value:    quo(totalVotingPower, bondedTokens),
+		Required: ">= " + humanPercent(quorum),
+		Margin:   totalVotingPower.Sub(quorum.Mul(bondedTokens)),
+	}
+	quorumCheck.OK = !quorumCheck.Value.LT(quorum)
+	v.Checks = append(v.Checks, quorumCheck)
+	if prop.Format.hasVeto() {
+		vetoCheck := tallyCheck{
+			Name:     "Veto",
+			Value:    quo(results[govtypes.OptionNoWithVeto], totalVotingPower),
+			Required: "<= " + humanPercent(params.VetoThreshold),
+			Margin:   params.VetoThreshold.Mul(totalVotingPower).Sub(results[govtypes.OptionNoWithVeto]),
+		}
+		vetoCheck.OK = !vetoCheck.Value.GT(params.VetoThreshold)
+		v.Checks = append(v.Checks, vetoCheck)
+	}
+	thresholdCheck := tallyCheck{
+		Name:     "Threshold",
+		Value:    quo(results[govtypes.OptionYes], nonAbstain),
+		Required: "> " + humanPercent(threshold),
+		Margin:   results[govtypes.OptionYes].Sub(threshold.Mul(nonAbstain)),
+	}
+	thresholdCheck.OK = !nonAbstain.IsZero() && thresholdCheck.Value.GT(threshold)
+	v.Checks = append(v.Checks, thresholdCheck)
+
+	switch {
+	case !quorumCheck.OK:
+		v.Outcome = outcomeNoQuorum
+	case nonAbstain.IsZero():
+		v.Outcome = outcomeOnlyAbstain
+	case prop.Format.hasVeto() && !v.Checks[1].OK:
+		v.Outcome = outcomeVetoed
+	case !thresholdCheck.OK:
+		v.Outcome = outcomeNoThreshold
+	default:
+		v.Outcome = outcomePassed
+		v.Passed = true
+	}
+	return v
+}
+
+// matchesStatus returns true if v matches status, the status of the proposal
+// after its voting period. A passed proposal whose messages failed has the
+// FAILED status.
+func (v tallyVerdict) matchesStatus(status string) bool {
+	switch status {
+	case "PROPOSAL_STATUS_PASSED", "PROPOSAL_STATUS_FAILED":
+		return v.Passed
+	case "PROPOSAL_STATUS_REJECTED":
+		return !v.Passed
+	}
+	return false
+}
+
+func printTallyVerdict(v tallyVerdict, prop govProposal) {
+	fmt.Println("--- VERDICT ---")
+	if v.Kind != kindDefault {
+		fmt.Printf("Quorum and threshold of %s proposals\n", v.Kind)
+	}
+	table := newMarkdownTable("Condition", "Computed", "Required", "Margin", "Result")
+	for _, c := range v.Checks {
+		result := "OK"
+		if !c.OK {
+			result = "FAIL"
+		}
+		table.Append([]string{c.Name, humanPercent(c.Value), c.Required, humand(c.Margin), result})
 	}
-	appendTable("diff", diff)
 	table.Render()
+	fmt.Println("Computed outcome:", v.Outcome)
+	switch {
+	case prop.Status == "PROPOSAL_STATUS_VOTING_PERIOD" || prop.Status == "PROPOSAL_STATUS_DEPOSIT_PERIOD":
+		fmt.Printf("Proposal status: %s, the outcome isn't final\n", prop.Status)
+	case v.matchesStatus(prop.Status):
+		fmt.Printf("Proposal status: %s, matches the computed outcome\n", prop.Status)
+	default:
+		fmt.Printf("Proposal status: %s, MISMATCH with the computed outcome\n", prop.Status)
+	}
+}
+
+// totalBondedTokens returns the sum of the bonded tokens of the validators of
+// snap, which is the total voting power used by the quorum.
+func totalBondedTokens(snap *Snapshot) math.LegacyDec {
+	total := math.ZeroInt()
+	for _, val := range snap.ValsByAddr {
+		total = total.Add(val.BondedTokens)
+	}
+	return math.LegacyNewDecFromInt(total)
+}
+
+// voteOptionName returns the short name of o, like "NoWithVeto".
+func voteOptionName(o govtypes.VoteOption) string {
+	switch o {
+	case govtypes.OptionYes:
+		return "Yes"
+	case govtypes.OptionNo:
+		return "No"
+	case govtypes.OptionNoWithVeto:
+		return "NoWithVeto"
+	case govtypes.OptionAbstain:
+		return "Abstain"
+	}
+	return o.String()
 }
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"cosmossdk.io/math"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types/v1beta1"
+	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
+)
+
+func TestTally(t *testing.T) {
+	var (
+		accAddrs    = createAccountAddrs(2)
+		accAddr1    = accAddrs[0].String()
+		accAddr2    = accAddrs[1].String()
+		valAddrs    = createValidatorAddrs(2)
+		valAddr1    = valAddrs[0].String()
+		valAddr2    = valAddrs[1].String()
+		valAccAddr1 = sdk.AccAddress(valAddrs[0]).String()
+		voteYes     = govtypes.NewNonSplitVoteOption(govtypes.OptionYes)
+		voteNo      = govtypes.NewNonSplitVoteOption(govtypes.OptionNo)
+		newDeleg    = func(delAddr, valAddr string, shares int64) stakingtypes.Delegation {
+			return stakingtypes.Delegation{
+				DelegatorAddress: delAddr,
+				ValidatorAddress: valAddr,
+				Shares:           math.LegacyNewDec(shares),
+			}
+		}
+		newSnapshot = func() *Snapshot {
+			return &Snapshot{
+				VotesByAddr: map[string]govtypes.WeightedVoteOptions{
+					valAccAddr1: voteYes,
+					accAddr1:    voteNo,
+				},
+				ValsByAddr: map[string]govtypes.ValidatorGovInfo{
+					valAddr1: govtypes.NewValidatorGovInfo(valAddrs[0], math.NewInt(100),
+						math.LegacyNewDec(100), math.LegacyZeroDec(), voteYes),
+					valAddr2: govtypes.NewValidatorGovInfo(valAddrs[1], math.NewInt(200),
+						math.LegacyNewDec(100), math.LegacyZeroDec(), nil),
+				},
+				ValMonikersByAddr: map[string]string{valAddr1: "val1", valAddr2: "val2"},
+				DelegsByAddr: map[string][]stakingtypes.Delegation{
+					valAccAddr1: {newDeleg(valAccAddr1, valAddr1, 10)},
+					accAddr1:    {newDeleg(accAddr1, valAddr1, 50), newDeleg(accAddr1, valAddr2, 20)},
+					accAddr2:    {newDeleg(accAddr2, valAddr1, 40)},
+				},
+			}
+		}
+	)
+	tests := []struct {
+		name                string
+		mode                tallyMode
+		expectedYes         int64
+		expectedNo          int64
+		expectedTotal       int64
+		expectedOverridden  int64
+		expectedInheritance int64
+	}{
+		{
+			name: "inheritance",
+			mode: modeInheritance,
+			// val1 self-delegation + val1 inherited power
+			expectedYes:         10 + 40,
+			expectedNo:          50 + 40,
+			expectedTotal:       140,
+			expectedOverridden:  60,
+			expectedInheritance: 40,
+		},
+		{
+			name:               "no inheritance",
+			mode:               modeNoInheritance,
+			expectedYes:        10,
+			expectedNo:         50 + 40,
+			expectedTotal:      100,
+			expectedOverridden: 60,
+		},
+		{
+			name:               "direct only",
+			mode:               modeDirectOnly,
+			expectedYes:        0,
+			expectedNo:         50 + 40,
+			expectedTotal:      90,
+			expectedOverridden: 50,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snap := newSnapshot()
+
+			tr := tally(snap, tt.mode)
+
+			assert.Equal(t, math.LegacyNewDec(tt.expectedYes), tr.Results[govtypes.OptionYes])
+			assert.Equal(t, math.LegacyNewDec(tt.expectedNo), tr.Results[govtypes.OptionNo])
+			assert.Equal(t, math.LegacyNewDec(tt.expectedTotal), tr.TotalVotingPower)
+			assert.Equal(t, []validatorTally{
+				{
+					OperatorAddress: valAddr2,
+					Moniker:         "val2",
+					BondedTokens:    math.NewInt(200),
+					OverriddenPower: math.LegacyNewDec(40),
+					InheritedPower:  math.LegacyZeroDec(),
+				},
+				{
+					OperatorAddress: valAddr1,
+					Moniker:         "val1",
+					Vote:            voteYes,
+					BondedTokens:    math.NewInt(100),
+					OverriddenPower: math.LegacyNewDec(tt.expectedOverridden),
+					InheritedPower:  math.LegacyNewDec(tt.expectedInheritance),
+				},
+			}, tr.Validators)
+			// snap isn't modified
+			assert.Equal(t, newSnapshot(), snap)
+		})
+	}
+}
+
+func TestEvaluateTally(t *testing.T) {
+	var (
+		dec          = math.LegacyMustNewDecFromStr
+		cosmosParams = govParams{
+			Quorums:       map[proposalKind]math.LegacyDec{kindDefault: dec("0.4")},
+			Thresholds:    map[proposalKind]math.LegacyDec{kindDefault: dec("0.5")},
+			VetoThreshold: dec("0.334"),
+		}
+		atomOneParams = govParams{
+			Quorums: map[proposalKind]math.LegacyDec{
+				kindDefault:               dec("0.25"),
+				kindLaw:                   dec("0.3"),
+				kindConstitutionAmendment: dec("0.35"),
+			},
+			Thresholds: map[proposalKind]math.LegacyDec{
+				kindDefault:               dec("0.667"),
+				kindLaw:                   dec("0.9"),
+				kindConstitutionAmendment: dec("0.9"),
+			},
+			VetoThreshold: math.LegacyZeroDec(),
+		}
+		cosmosProp = govProposal{Format: govV1beta1}
+		lawProp    = govProposal{Format: govAtomOne, Messages: []string{"/atomone.gov.v1.MsgProposeLaw"}}
+		amendProp  = govProposal{Format: govAtomOne, Messages: []string{
+			"/atomone.gov.v1.MsgProposeLaw", "/atomone.gov.v1.MsgProposeConstitutionAmendment",
+		}}
+	)
+	newResults := func(yes, no, veto, abstain int64) map[govtypes.VoteOption]math.LegacyDec {
+		return map[govtypes.VoteOption]math.LegacyDec{
+			govtypes.OptionYes:        math.LegacyNewDec(yes),
+			govtypes.OptionNo:         math.LegacyNewDec(no),
+			govtypes.OptionNoWithVeto: math.LegacyNewDec(veto),
+			govtypes.OptionAbstain:    math.LegacyNewDec(abstain),
+		}
+	}
+	tests := []struct {
+		name            string
+		results         map[govtypes.VoteOption]math.LegacyDec
+		bonded          int64
+		params          govParams
+		prop            govProposal
+		expectedKind    proposalKind
+		expectedOutcome string
+		expectedMargins []string
+	}{
+		{
+			name:            "passed",
+			results:         newResults(30, 10, 5, 5),
+			bonded:          100,
+			params:          cosmosParams,
+			prop:            cosmosProp,
+			expectedOutcome: "passed",
+			// quorum: 50-40, veto: 0.334*50-5, threshold: 30-0.5*45
+			expectedMargins: []string{"10", "11.7", "7.5"},
+		},
+		{
+			name:            "no quorum",
+			results:         newResults(30, 0, 0, 0),
+			bonded:          100,
+			params:          cosmosParams,
+			prop:            cosmosProp,
+			expectedOutcome: "rejected, quorum not reached",
+			expectedMargins: []string{"-10", "10.02", "15"},
+		},
+		{
+			name:            "only abstain",
+			results:         newResults(0, 0, 0, 50),
+			bonded:          100,
+			params:          cosmosParams,
+			prop:            cosmosProp,
+			expectedOutcome: "rejected, only abstain votes",
+			expectedMargins: []string{"10", "16.7", "0"},
+		},
+		{
+			name:            "vetoed",
+			results:         newResults(30, 0, 20, 0),
+			bonded:          100,
+			params:          cosmosParams,
+			prop:            cosmosProp,
+			expectedOutcome: "rejected, vetoed",
+			expectedMargins: []string{"10", "-3.3", "5"},
+		},
+		{
+			name:            "threshold not reached",
+			results:         newResults(20, 25, 0, 5),
+			bonded:          100,
+			params:          cosmosParams,
+			prop:            cosmosProp,
+			expectedOutcome: "rejected, threshold not reached",
+			expectedMargins: []string{"10", "16.7", "-2.5"},
+		},
+		{
+			name:            "atomone default",
+			results:         newResults(21, 9, 0, 0),
+			bonded:          100,
+			params:          atomOneParams,
+			prop:            govProposal{Format: govAtomOne},
+			expectedOutcome: "passed",
+			expectedMargins: []string{"5", "0.99"},
+		},
+		{
+			name:            "atomone law",
+			results:         newResults(20, 10, 0, 0),
+			bonded:          100,
+			params:          atomOneParams,
+			prop:            lawProp,
+			expectedKind:    kindLaw,
+			expectedOutcome: "rejected, threshold not reached",
+			expectedMargins: []string{"0", "-7"},
+		},
+		{
+			name:            "atomone constitution amendment",
+			results:         newResults(30, 0, 0, 0),
+			bonded:          100,
+			params:          atomOneParams,
+			prop:            amendProp,
+			expectedKind:    kindConstitutionAmendment,
+			expectedOutcome: "rejected, quorum not reached",
+			expectedMargins: []string{"-5", "3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			total := math.LegacyZeroDec()
+			for _, amt := range tt.results {
+				total = total.Add(amt)
+			}
+
+			v := evaluateTally(tt.results, total, math.LegacyNewDec(tt.bonded), tt.params, tt.prop)
+
+			assert.Equal(t, tt.expectedKind, v.Kind)
+			assert.Equal(t, tt.expectedOutcome, v.Outcome)
+			assert.Equal(t, tt.expectedOutcome == "passed", v.Passed)
+			var margins []string
+			for _, c := range v.Checks {
+				margins = append(margins, c.Margin.String())
+			}
+			expectedMargins := make([]string, len(tt.expectedMargins))
+			for i, m := range tt.expectedMargins {
+				expectedMargins[i] = math.LegacyMustNewDecFromStr(m).String()
+			}
+			assert.Equal(t, expectedMargins, margins)
+		})
+	}
+}
+
+func TestParseTallyMode(t *testing.T) {
+	for _, m := range tallyModes {
+		mode, err := parseTallyMode(m.String())
+		assert.NoError(t, err)
+		assert.Equal(t, m, mode)
+	}
+	_, err := parseTallyMode("governors")
+	assert.EqualError(t, err, "unknown tally mode 'governors'")
+}
+
+func TestPrintTallyResultsAllAbstain(t *testing.T) {
+	results := map[govtypes.VoteOption]math.LegacyDec{
+		govtypes.OptionYes:        math.LegacyZeroDec(),
+		govtypes.OptionNo:         math.LegacyZeroDec(),
+		govtypes.OptionNoWithVeto: math.LegacyZeroDec(),
+		govtypes.OptionAbstain:    math.LegacyNewDec(10),
+	}
+
+	assert.NotPanics(t, func() {
+		printTallyResults(results, math.LegacyNewDec(10), govProposal{ID: 1})
+	})
+}
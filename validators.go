@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"cosmossdk.io/math"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types/v1beta1"
+)
+
+// validatorReport is the treatment of an active validator and of its operator
+// account.
+type validatorReport struct {
+	OperatorAddress string
+	Moniker         string
+	// AccountAddress is the account address of the validator operator.
+	AccountAddress string
+	Vote           govtypes.WeightedVoteOptions
+	BondedTokens   math.Int
+	// SelfDelegation is the amount delegated by the operator account to the
+	// validator.
+	SelfDelegation math.LegacyDec
+	// Delegators is the number of accounts delegating to the validator,
+	// including the operator account.
+	Delegators int
+	// Account is the entry of the operator account in accounts.json, nil if
+	// the account isn't there.
+	Account *Account
+	// Airdrop is the airdrop of the operator account.
+	Airdrop math.Int
+}
+
+// buildValidatorsReport returns the report of the active validators of snap,
+// sorted by descending bonded tokens, with the entries of their operator
+// accounts in accounts (sorted by address) and their airdrop.
+func buildValidatorsReport(snap *Snapshot, accounts []Account, airdrop airdrop) []validatorReport {
+	reportsByAddr := make(map[string]*validatorReport, len(snap.ValsByAddr))
+	for addr, val := range snap.ValsByAddr {
+		accAddr := sdk.AccAddress(val.Address).String()
+		r := &validatorReport{
+			OperatorAddress: addr,
+			Moniker:         snap.ValMonikersByAddr[addr],
+			AccountAddress:  accAddr,
+			Vote:            val.Vote,
+			BondedTokens:    val.BondedTokens,
+			SelfDelegation:  math.LegacyZeroDec(),
+			Airdrop:         math.ZeroInt(),
+		}
+		if i, ok := slices.BinarySearchFunc(accounts, accAddr, func(a Account, addr string) int {
+			return strings.Compare(a.Address, addr)
+		}); ok {
+			r.Account = &accounts[i]
+		}
+		if amt, ok := airdrop.addresses[accAddr]; ok {
+			r.Airdrop = amt
+		}
+		reportsByAddr[addr] = r
+	}
+	for delAddr, delegs := range snap.DelegsByAddr {
+		for _, deleg := range delegs {
+			r, ok := reportsByAddr[deleg.ValidatorAddress]
+			if !ok {
+				// Validator isn't in active set or jailed, ignore
+				continue
+			}
+			r.Delegators++
+			if delAddr == r.AccountAddress {
+				val := snap.ValsByAddr[deleg.ValidatorAddress]
+				r.SelfDelegation = r.SelfDelegation.Add(deleg.GetShares().MulInt(val.BondedTokens).Quo(val.DelegatorShares))
+			}
+		}
+	}
+	reports := make([]validatorReport, 0, len(reportsByAddr))
+	for _, r := range reportsByAddr {
+		reports = append(reports, *r)
+	}
+	slices.SortFunc(reports, func(a, b validatorReport) int {
+		if c := b.BondedTokens.BigInt().Cmp(a.BondedTokens.BigInt()); c != 0 {
+			return c
+		}
+		return strings.Compare(a.OperatorAddress, b.OperatorAddress)
+	})
+	return reports
+}
+
+var validatorReportHeader = []string{
+	"Moniker", "Operator address", "Account address", "Vote", "Bonded tokens", "Self-delegation",
+	"Delegators", "Account liquid", "Account staked", "$ATONE",
+}
+
+// accountAmounts returns the liquid and staked amounts of the operator
+// account, "-" if it isn't in accounts.json.
+func (r validatorReport) accountAmounts(format func(math.LegacyDec) string) (liquid, staked string) {
+	if r.Account == nil {
+		return "-", "-"
+	}
+	return format(r.Account.LiquidAmount), format(r.Account.StakedAmount)
+}
+
+// printValidatorsReport prints reports as a markdown table.
+func printValidatorsReport(reports []validatorReport) {
+	table := newMarkdownTable(validatorReportHeader...)
+	for _, r := range reports {
+		liquid, staked := r.accountAmounts(humand)
+		table.Append([]string{
+			r.Moniker, r.OperatorAddress, r.AccountAddress, formatVote(r.Vote), human(r.BondedTokens),
+			humand(r.SelfDelegation), fmt.Sprint(r.Delegators), liquid, staked, human(r.Airdrop),
+		})
+	}
+	table.Render()
+}
+
+// writeValidatorsReportCSV writes reports into the CSV file at path.
+func writeValidatorsReportCSV(path string, reports []validatorReport) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	w.Write(validatorReportHeader)
+	truncate := func(d math.LegacyDec) string { return d.TruncateInt().String() }
+	for _, r := range reports {
+		liquid, staked := r.accountAmounts(truncate)
+		w.Write([]string{
+			r.Moniker, r.OperatorAddress, r.AccountAddress, formatVote(r.Vote), r.BondedTokens.String(),
+			truncate(r.SelfDelegation), fmt.Sprint(r.Delegators), liquid, staked, r.Airdrop.String(),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	fmt.Printf("%s file created.\n", path)
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cosmossdk.io/math"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types/v1beta1"
+	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
+)
+
+func TestBuildValidatorsReport(t *testing.T) {
+	var (
+		accAddr     = createAccountAddrs(1)[0].String()
+		valAddrs    = createValidatorAddrs(2)
+		valAccAddrs = []string{sdk.AccAddress(valAddrs[0]).String(), sdk.AccAddress(valAddrs[1]).String()}
+		yes         = govtypes.NewNonSplitVoteOption(govtypes.OptionYes)
+		newDeleg    = func(delAddr string, val int, shares int64) stakingtypes.Delegation {
+			return stakingtypes.Delegation{
+				DelegatorAddress: delAddr,
+				ValidatorAddress: valAddrs[val].String(),
+				Shares:           math.LegacyNewDec(shares),
+			}
+		}
+		snap = &Snapshot{
+			ValsByAddr: map[string]govtypes.ValidatorGovInfo{
+				// Half of the tokens have been slashed
+				valAddrs[0].String(): govtypes.NewValidatorGovInfo(valAddrs[0], math.NewInt(50),
+					math.LegacyNewDec(100), math.LegacyZeroDec(), yes),
+				valAddrs[1].String(): govtypes.NewValidatorGovInfo(valAddrs[1], math.NewInt(200),
+					math.LegacyNewDec(200), math.LegacyZeroDec(), nil),
+			},
+			ValMonikersByAddr: map[string]string{
+				valAddrs[0].String(): "val0",
+				valAddrs[1].String(): "val1",
+			},
+			DelegsByAddr: map[string][]stakingtypes.Delegation{
+				valAccAddrs[0]: {newDeleg(valAccAddrs[0], 0, 20)},
+				accAddr:        {newDeleg(accAddr, 0, 80), newDeleg(accAddr, 1, 200)},
+			},
+		}
+		accounts = []Account{{
+			Address:      valAccAddrs[0],
+			LiquidAmount: math.LegacyNewDec(5),
+			StakedAmount: math.LegacyNewDec(10),
+		}}
+		airdrop = airdrop{addresses: map[string]math.Int{valAccAddrs[0]: math.NewInt(3)}}
+	)
+
+	reports := buildValidatorsReport(snap, accounts, airdrop)
+
+	require.Len(t, reports, 2)
+	assert.Equal(t, validatorReport{
+		OperatorAddress: valAddrs[1].String(),
+		Moniker:         "val1",
+		AccountAddress:  valAccAddrs[1],
+		BondedTokens:    math.NewInt(200),
+		SelfDelegation:  math.LegacyZeroDec(),
+		Delegators:      1,
+		Airdrop:         math.ZeroInt(),
+	}, reports[0])
+	assert.Equal(t, validatorReport{
+		OperatorAddress: valAddrs[0].String(),
+		Moniker:         "val0",
+		AccountAddress:  valAccAddrs[0],
+		Vote:            yes,
+		BondedTokens:    math.NewInt(50),
+		SelfDelegation:  math.LegacyNewDec(10),
+		Delegators:      2,
+		Account:         &accounts[0],
+		Airdrop:         math.NewInt(3),
+	}, reports[1])
+}
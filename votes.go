@@ -0,0 +1,139 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types/v1beta1"
+)
+
+// voteRecord is a vote read from one of the vote sources of a snapshot
+// directory.
+type voteRecord struct {
+	Voter   string
+	Options govtypes.WeightedVoteOptions
+	// Height is the height of the block of the vote tx, 0 for the votes read
+	// from the state (votes.json).
+	Height int64
+	// TxIndex is the index of the vote tx in its block.
+	TxIndex int
+	// Source is the name of the file the vote was read from.
+	Source string
+}
+
+func (v voteRecord) String() string {
+	if v.Height == 0 {
+		return fmt.Sprintf("%s (%s)", v.Options, v.Source)
+	}
+	return fmt.Sprintf("%s (%s, height %d, tx %d)", v.Options, v.Source, v.Height, v.TxIndex)
+}
+
+// blockVote is the format of the records of block_votes.json, which holds the
+// votes of txs that are not part of the state export, like the ones included
+// in the tally block.
+type blockVote struct {
+	Height  int64           `json:"height"`
+	TxIndex int             `json:"tx_index"`
+	Vote    json.RawMessage `json:"vote"`
+}
+
+// decode returns the vote of bv, ensuring bv has a height.
+func (bv blockVote) decode() (govtypes.Vote, error) {
+	var vj voteJSON
+	if err := json.Unmarshal(bv.Vote, &vj); err != nil {
+		return govtypes.Vote{}, err
+	}
+	vote, err := vj.toVote()
+	if err != nil {
+		return govtypes.Vote{}, err
+	}
+	if bv.Height <= 0 {
+		return govtypes.Vote{}, fmt.Errorf("vote of %s has no height", vote.Voter)
+	}
+	return vote, nil
+}
+
+// voteOverride reports a vote replaced by a later vote of the same voter.
+type voteOverride struct {
+	Old, New voteRecord
+}
+
+// parseVoteRecords returns the votes of the snapshot directory path, read from
+// votes.json, which holds the votes of the state, and from the optional
+// block_votes.json, which holds the votes cast in blocks.
+func parseVoteRecords(ctx context.Context, path string, useCache bool) ([]voteRecord, error) {
+	var records []voteRecord
+	for vote, err := range readCachedRecords(ctx, filepath.Join(path, "votes.json"), "", voteDecodeNext, useCache) {
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, voteRecord{
+			Voter:   vote.Voter,
+			Options: vote.Options,
+			Source:  "votes.json",
+		})
+	}
+	blockVotesFile := filepath.Join(path, "block_votes.json")
+	if _, err := os.Stat(blockVotesFile); errors.Is(err, fs.ErrNotExist) {
+		return records, nil
+	}
+	for bv, err := range readRecords(ctx, blockVotesFile, "", jsonDecodeNext[blockVote]) {
+		if err != nil {
+			return nil, err
+		}
+		vote, err := bv.decode()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", blockVotesFile, err)
+		}
+		records = append(records, voteRecord{
+			Voter:   vote.Voter,
+			Options: vote.Options,
+			Height:  bv.Height,
+			TxIndex: bv.TxIndex,
+			Source:  "block_votes.json",
+		})
+	}
+	return records, nil
+}
+
+// resolveVotes returns the final vote of each voter of records, which is the
+// vote with the highest height and tx index. Votes of the same tx (or without
+// height) are ordered by their position in records. The returned overrides
+// lists all the votes replaced by a later vote, in the order of the later
+// votes.
+func resolveVotes(records []voteRecord) (map[string]voteRecord, []voteOverride) {
+	sorted := slices.Clone(records)
+	// Stable sort to keep the order of records for the votes of the same tx
+	slices.SortStableFunc(sorted, func(a, b voteRecord) int {
+		return cmp.Or(cmp.Compare(a.Height, b.Height), cmp.Compare(a.TxIndex, b.TxIndex))
+	})
+	var (
+		votesByAddr = make(map[string]voteRecord, len(sorted))
+		overrides   []voteOverride
+	)
+	for _, v := range sorted {
+		if old, ok := votesByAddr[v.Voter]; ok {
+			overrides = append(overrides, voteOverride{Old: old, New: v})
+		}
+		votesByAddr[v.Voter] = v
+	}
+	return votesByAddr, overrides
+}
+
+// printVoteOverrides prints the report of the votes replaced by a later vote.
+func printVoteOverrides(overrides []voteOverride) {
+	if len(overrides) == 0 {
+		return
+	}
+	fmt.Printf("%d vote(s) overridden by a later vote:\n", len(overrides))
+	for _, o := range overrides {
+		fmt.Printf("- %s: %s replaced by %s\n", o.New.Voter, o.Old, o.New)
+	}
+}
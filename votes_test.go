@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types/v1beta1"
+)
+
+func TestResolveVotes(t *testing.T) {
+	var (
+		yes     = govtypes.NewNonSplitVoteOption(govtypes.OptionYes)
+		no      = govtypes.NewNonSplitVoteOption(govtypes.OptionNo)
+		abstain = govtypes.NewNonSplitVoteOption(govtypes.OptionAbstain)
+		vote    = func(voter string, opt govtypes.WeightedVoteOptions, height int64, txIndex int) voteRecord {
+			source := "votes.json"
+			if height > 0 {
+				source = "block_votes.json"
+			}
+			return voteRecord{Voter: voter, Options: opt, Height: height, TxIndex: txIndex, Source: source}
+		}
+	)
+	tests := []struct {
+		name              string
+		records           []voteRecord
+		expectedVotes     map[string]govtypes.WeightedVoteOptions
+		expectedOverrides []voteOverride
+	}{
+		{
+			name: "no votes",
+		},
+		{
+			name: "no duplicates",
+			records: []voteRecord{
+				vote("addr1", yes, 0, 0),
+				vote("addr2", no, 10, 1),
+			},
+			expectedVotes: map[string]govtypes.WeightedVoteOptions{
+				"addr1": yes,
+				"addr2": no,
+			},
+		},
+		{
+			name: "block vote overrides state vote",
+			records: []voteRecord{
+				vote("addr1", no, 10, 0),
+				vote("addr1", yes, 0, 0),
+			},
+			expectedVotes: map[string]govtypes.WeightedVoteOptions{
+				"addr1": no,
+			},
+			expectedOverrides: []voteOverride{
+				{Old: vote("addr1", yes, 0, 0), New: vote("addr1", no, 10, 0)},
+			},
+		},
+		{
+			name: "block votes ordered by height and tx index",
+			records: []voteRecord{
+				vote("addr1", abstain, 11, 0),
+				vote("addr1", no, 10, 2),
+				vote("addr1", yes, 10, 1),
+			},
+			expectedVotes: map[string]govtypes.WeightedVoteOptions{
+				"addr1": abstain,
+			},
+			expectedOverrides: []voteOverride{
+				{Old: vote("addr1", yes, 10, 1), New: vote("addr1", no, 10, 2)},
+				{Old: vote("addr1", no, 10, 2), New: vote("addr1", abstain, 11, 0)},
+			},
+		},
+		{
+			name: "votes of the same tx ordered by position",
+			records: []voteRecord{
+				vote("addr1", yes, 10, 1),
+				vote("addr1", no, 10, 1),
+			},
+			expectedVotes: map[string]govtypes.WeightedVoteOptions{
+				"addr1": no,
+			},
+			expectedOverrides: []voteOverride{
+				{Old: vote("addr1", yes, 10, 1), New: vote("addr1", no, 10, 1)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			votes, overrides := resolveVotes(tt.records)
+
+			votesByAddr := make(map[string]govtypes.WeightedVoteOptions)
+			for addr, v := range votes {
+				votesByAddr[addr] = v.Options
+			}
+			if tt.expectedVotes == nil {
+				tt.expectedVotes = map[string]govtypes.WeightedVoteOptions{}
+			}
+			assert.Equal(t, tt.expectedVotes, votesByAddr)
+			assert.Equal(t, tt.expectedOverrides, overrides)
+		})
+	}
+}